@@ -8,12 +8,14 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"reflect"
 	"syscall"
 	"time"
 
 	"github.com/chrissnell/crabby/pkg/config"
 	"github.com/chrissnell/crabby/pkg/job"
 	"github.com/chrissnell/crabby/pkg/storage"
+	"gopkg.in/yaml.v3"
 )
 
 var version = "dev"
@@ -35,12 +37,9 @@ func run() error {
 		return nil
 	}
 
-	c, err := config.Load(*cfgFile)
+	c, err := loadConfig(*cfgFile)
 	if err != nil {
-		return fmt.Errorf("loading config: %w", err)
-	}
-	if err := c.ResolveSecrets(); err != nil {
-		return fmt.Errorf("resolving secrets: %w", err)
+		return err
 	}
 
 	ctx, cancel := context.WithCancel(context.Background())
@@ -56,42 +55,15 @@ func run() error {
 	}
 	defer dist.Close()
 
-	// Set up HTTP client for jobs
-	var requestTimeout time.Duration
-	if c.General.RequestTimeout == "" {
-		requestTimeout = 15 * time.Second
-	} else {
-		requestTimeout, err = time.ParseDuration(c.General.RequestTimeout)
-		if err != nil {
-			return fmt.Errorf("parsing request timeout: %w", err)
-		}
-	}
-
-	userAgent := c.General.UserAgent
-	if userAgent == "" {
-		userAgent = "crabby/" + version
-	}
-
-	httpClient := &http.Client{
-		Transport: &http.Transport{
-			Proxy:                 http.ProxyFromEnvironment,
-			TLSHandshakeTimeout:   10 * time.Second,
-			ExpectContinueTimeout: 1 * time.Second,
-			DisableKeepAlives:     true,
-		},
-		Timeout: requestTimeout,
+	opts, err := jobOptions(c)
+	if err != nil {
+		return err
 	}
 
 	// Set up job manager
 	jm := job.NewJobManager(dist)
-	jm.RegisterFactory(&job.SimpleFactory{Client: httpClient})
-	jm.RegisterFactory(&job.APIFactory{Client: httpClient})
-	jm.RegisterFactory(&job.BrowserFactory{})
-
-	opts := job.JobOptions{
-		GlobalTags:     c.General.Tags,
-		RequestTimeout: requestTimeout,
-		UserAgent:      userAgent,
+	for _, f := range jobFactories(newHTTPClient(opts.RequestTimeout)) {
+		jm.RegisterFactory(f)
 	}
 
 	if err := jm.BuildJobs(c.Jobs, opts); err != nil {
@@ -100,7 +72,7 @@ func run() error {
 
 	// Start internal metrics if configured
 	if c.General.ReportInternalMetrics {
-		internalJob := job.NewInternalMetricsJob(c.General.InternalMetricsInterval)
+		internalJob := job.NewInternalMetricsJob(c.General.InternalMetricsInterval, jm, dist)
 		go func() {
 			ticker := time.NewTicker(internalJob.Interval())
 			defer ticker.Stop()
@@ -118,10 +90,15 @@ func run() error {
 
 	jm.Run(ctx)
 
-	// Wait for shutdown signal
+	// Reload on SIGHUP until a shutdown signal arrives
 	sigs := make(chan os.Signal, 1)
-	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
-	<-sigs
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	for sig := range sigs {
+		if sig != syscall.SIGHUP {
+			break
+		}
+		reload(jm, *cfgFile, c)
+	}
 
 	slog.Info("shutting down")
 	cancel()
@@ -129,58 +106,215 @@ func run() error {
 	return nil
 }
 
-func setupBackends(dist *storage.Distributor, c config.ServiceConfig) error {
-	if c.Storage.Dogstatsd.Host != "" {
-		b, err := storage.NewDogstatsdBackend(c.Storage.Dogstatsd)
+// loadConfig reads the config file and resolves its secrets.
+func loadConfig(path string) (config.ServiceConfig, error) {
+	c, err := config.Load(path)
+	if err != nil {
+		return c, fmt.Errorf("loading config: %w", err)
+	}
+	if err := c.ResolveSecrets(); err != nil {
+		return c, fmt.Errorf("resolving secrets: %w", err)
+	}
+	return c, nil
+}
+
+// jobOptions derives the options shared by all jobs from the general config.
+func jobOptions(c config.ServiceConfig) (job.JobOptions, error) {
+	requestTimeout := 15 * time.Second
+	if c.General.RequestTimeout != "" {
+		var err error
+		requestTimeout, err = time.ParseDuration(c.General.RequestTimeout)
 		if err != nil {
-			return fmt.Errorf("dogstatsd: %w", err)
+			return job.JobOptions{}, fmt.Errorf("parsing request timeout: %w", err)
 		}
-		dist.AddBackend(b)
 	}
 
-	if c.Storage.Prometheus.ListenAddr != "" {
-		dist.AddBackend(storage.NewPrometheusBackend(c.Storage.Prometheus))
+	userAgent := c.General.UserAgent
+	if userAgent == "" {
+		userAgent = "crabby/" + version
 	}
 
-	if c.Storage.InfluxDB.Host != "" {
-		b, err := storage.NewInfluxDBBackend(c.Storage.InfluxDB)
+	sched := job.ScheduleOptions{RunOnStart: c.General.Scheduling.RunOnStart}
+	if s := c.General.Scheduling.Splay; s != "" {
+		d, err := time.ParseDuration(s)
 		if err != nil {
-			return fmt.Errorf("influxdb: %w", err)
+			return job.JobOptions{}, fmt.Errorf("parsing scheduling splay: %w", err)
 		}
-		dist.AddBackend(b)
+		if d < 0 {
+			return job.JobOptions{}, fmt.Errorf("scheduling splay must not be negative")
+		}
+		sched.Splay = d
 	}
-
-	if c.Storage.Log.File != "" {
-		b, err := storage.NewLogBackend(c.Storage.Log)
+	if s := c.General.Scheduling.Jitter; s != "" {
+		d, err := time.ParseDuration(s)
 		if err != nil {
-			return fmt.Errorf("log: %w", err)
+			return job.JobOptions{}, fmt.Errorf("parsing scheduling jitter: %w", err)
+		}
+		if d < 0 {
+			return job.JobOptions{}, fmt.Errorf("scheduling jitter must not be negative")
 		}
-		dist.AddBackend(b)
+		sched.Jitter = d
 	}
 
-	if c.Storage.PagerDuty.RoutingKey != "" {
-		b, err := storage.NewPagerDutyBackend(c.Storage.PagerDuty)
+	a := c.General.Alerting
+	alerting := job.AlertPolicy{
+		Failures:      a.Failures,
+		Window:        a.Window,
+		Recoveries:    a.Recoveries,
+		FlapThreshold: a.FlapThreshold,
+	}
+	if a.FlapWindow != "" {
+		d, err := time.ParseDuration(a.FlapWindow)
 		if err != nil {
-			return fmt.Errorf("pagerduty: %w", err)
+			return job.JobOptions{}, fmt.Errorf("parsing alerting flap-window: %w", err)
 		}
-		dist.AddBackend(b)
+		alerting.FlapWindow = d
+	}
+	if a.FlapSuppression != "" {
+		d, err := time.ParseDuration(a.FlapSuppression)
+		if err != nil {
+			return job.JobOptions{}, fmt.Errorf("parsing alerting flap-suppression: %w", err)
+		}
+		alerting.FlapSuppression = d
 	}
 
-	if c.Storage.SplunkHec.HecURL != "" {
-		var timeout time.Duration
-		if c.General.RequestTimeout != "" {
-			var err error
-			timeout, err = time.ParseDuration(c.General.RequestTimeout)
-			if err != nil {
-				return fmt.Errorf("parsing splunk timeout: %w", err)
-			}
+	return job.JobOptions{
+		GlobalTags:     c.General.Tags,
+		RequestTimeout: requestTimeout,
+		UserAgent:      userAgent,
+		Schedule:       sched,
+		Alerting:       alerting,
+	}, nil
+}
+
+// newHTTPClient creates the HTTP client shared by HTTP-based jobs.
+func newHTTPClient(timeout time.Duration) *http.Client {
+	return &http.Client{
+		Transport: &http.Transport{
+			Proxy:                 http.ProxyFromEnvironment,
+			TLSHandshakeTimeout:   10 * time.Second,
+			ExpectContinueTimeout: 1 * time.Second,
+			DisableKeepAlives:     true,
+		},
+		Timeout: timeout,
+	}
+}
+
+// jobFactories returns a factory for every job type.
+func jobFactories(httpClient *http.Client) []job.JobFactory {
+	return []job.JobFactory{
+		&job.SimpleFactory{Client: httpClient},
+		&job.APIFactory{Client: httpClient},
+		&job.BrowserFactory{},
+		&job.TCPFactory{},
+		&job.DNSFactory{Client: httpClient},
+		&job.TLSFactory{},
+	}
+}
+
+// reload re-reads the config file and applies job changes. Jobs and the
+// general job options (tags, request timeout, user agent, scheduling,
+// alerting) are reloaded; storage, browser and internal metrics settings only
+// take effect on restart.
+// The whole new config is validated, and every job built, before anything
+// is swapped in; if that fails, the running jobs and factories are left
+// untouched.
+func reload(jm *job.JobManager, path string, started config.ServiceConfig) {
+	slog.Info("reloading configuration", "file", path)
+
+	c, err := loadConfig(path)
+	if err != nil {
+		slog.Error("reload failed, keeping current configuration", "error", err)
+		return
+	}
+	opts, err := jobOptions(c)
+	if err != nil {
+		slog.Error("reload failed, keeping current configuration", "error", err)
+		return
+	}
+
+	res, err := jm.Reload(c.Jobs, opts, jobFactories(newHTTPClient(opts.RequestTimeout))...)
+	if err != nil {
+		slog.Error("reload failed, keeping current configuration", "error", err)
+		return
+	}
+
+	if storageChanged(c.Storage, started.Storage) || c.Browser != started.Browser ||
+		c.General.ReportInternalMetrics != started.General.ReportInternalMetrics ||
+		c.General.InternalMetricsInterval != started.General.InternalMetricsInterval {
+		slog.Warn("storage, browser and internal metrics changes require a restart to take effect")
+	}
+	slog.Info("configuration reloaded",
+		"added", res.Added, "removed", res.Removed, "changed", res.Changed, "unchanged", len(res.Unchanged))
+}
+
+// storageChanged reports whether two storage configs differ. Backend list
+// entries are compared by content, ignoring where they are in the file.
+func storageChanged(a, b config.StorageConfig) bool {
+	decode := func(nodes []yaml.Node) []any {
+		out := make([]any, len(nodes))
+		for i, n := range nodes {
+			// An undecodable entry stays nil; Load has already parsed it.
+			_ = n.Decode(&out[i])
 		}
-		b, err := storage.NewSplunkHECBackend(c.Storage.SplunkHec, timeout)
+		return out
+	}
+	if !reflect.DeepEqual(decode(a.Backends), decode(b.Backends)) {
+		return true
+	}
+	a.Backends, b.Backends = nil, nil
+	return !reflect.DeepEqual(a, b)
+}
+
+// setupBackends sets the global relabel rules and registers the backends
+// configured by the single-instance storage fields and those listed under
+// storage.backends.
+func setupBackends(dist *storage.Distributor, c config.ServiceConfig) error {
+	var opts storage.FactoryOptions
+	if c.General.RequestTimeout != "" {
+		var err error
+		opts.RequestTimeout, err = time.ParseDuration(c.General.RequestTimeout)
 		if err != nil {
-			return fmt.Errorf("splunk_hec: %w", err)
+			return fmt.Errorf("parsing request timeout: %w", err)
 		}
-		dist.AddBackend(b)
+	}
+	for _, f := range storage.Factories() {
+		dist.RegisterFactory(f)
+	}
+	if err := dist.SetRelabeling(c.Storage.Relabel); err != nil {
+		return fmt.Errorf("storage: %w", err)
 	}
 
-	return nil
+	// Each single-instance field is enabled by its required setting.
+	single := []struct {
+		typ     string
+		enabled bool
+		cfg     any
+	}{
+		{"dogstatsd", c.Storage.Dogstatsd.Host != "", c.Storage.Dogstatsd},
+		{"prometheus", c.Storage.Prometheus.ListenAddr != "", c.Storage.Prometheus},
+		{"influxdb", c.Storage.InfluxDB.Host != "", c.Storage.InfluxDB},
+		{"log", c.Storage.Log.File != "", c.Storage.Log},
+		{"pagerduty", c.Storage.PagerDuty.RoutingKey != "", c.Storage.PagerDuty},
+		{"splunk-hec", c.Storage.SplunkHec.HecURL != "", c.Storage.SplunkHec},
+		{"otlp", c.Storage.OTLP.Endpoint != "", c.Storage.OTLP},
+		{"graphite", c.Storage.Graphite.Host != "", c.Storage.Graphite},
+		{"prometheus-remote-write", c.Storage.RemoteWrite.URL != "", c.Storage.RemoteWrite},
+		{"prometheus-pushgateway", c.Storage.Pushgateway.URL != "", c.Storage.Pushgateway},
+		{"webhook", c.Storage.Webhook.URL != "", c.Storage.Webhook},
+	}
+	for _, s := range single {
+		if !s.enabled {
+			continue
+		}
+		var node yaml.Node
+		if err := node.Encode(s.cfg); err != nil {
+			return fmt.Errorf("%s: encoding config: %w", s.typ, err)
+		}
+		if err := dist.AddBackendFromConfig(s.typ, node, opts); err != nil {
+			return fmt.Errorf("%s: %w", s.typ, err)
+		}
+	}
+
+	return dist.BuildBackends(c.Storage.Backends, opts)
 }
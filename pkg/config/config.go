@@ -32,6 +32,25 @@ type GeneralConfig struct {
 	ReportInternalMetrics   bool              `yaml:"report-internal-metrics,omitempty"`
 	InternalMetricsInterval uint              `yaml:"internal-metrics-gathering-interval,omitempty"`
 	UserAgent               string            `yaml:"user-agent,omitempty"`
+	Scheduling              SchedulingConfig  `yaml:"scheduling,omitempty"`
+	Alerting                AlertingConfig    `yaml:"alerting,omitempty"`
+}
+
+// SchedulingConfig holds the default scheduling options for all jobs.
+type SchedulingConfig struct {
+	Splay      string `yaml:"splay,omitempty"`
+	Jitter     string `yaml:"jitter,omitempty"`
+	RunOnStart bool   `yaml:"run-on-start,omitempty"`
+}
+
+// AlertingConfig holds the default alerting policy for all jobs.
+type AlertingConfig struct {
+	Failures        int    `yaml:"failures,omitempty"`
+	Window          int    `yaml:"window,omitempty"`
+	Recoveries      int    `yaml:"recoveries,omitempty"`
+	FlapThreshold   int    `yaml:"flap-threshold,omitempty"`
+	FlapWindow      string `yaml:"flap-window,omitempty"`
+	FlapSuppression string `yaml:"flap-suppression,omitempty"`
 }
 
 // StorageConfig holds configuration for storage backends.
@@ -42,46 +61,159 @@ type StorageConfig struct {
 	Prometheus PrometheusConfig `yaml:"prometheus,omitempty"`
 	Log        LogConfig        `yaml:"log,omitempty"`
 	SplunkHec  SplunkHecConfig  `yaml:"splunk-hec,omitempty"`
+	OTLP       OTLPConfig       `yaml:"otlp,omitempty"`
+	Graphite   GraphiteConfig   `yaml:"graphite,omitempty"`
+	// RemoteWrite and Pushgateway push metrics to Prometheus-compatible
+	// receivers, for networks Prometheus can't scrape.
+	RemoteWrite PrometheusRemoteWriteConfig `yaml:"prometheus-remote-write,omitempty"`
+	Pushgateway PushgatewayConfig           `yaml:"prometheus-pushgateway,omitempty"`
+	Webhook     WebhookConfig               `yaml:"webhook,omitempty"`
+	// Backends lists named backend instances, each with a `type` field
+	// naming its kind and that kind's fields. It allows several instances
+	// of the same kind alongside the single-instance fields above.
+	Backends []yaml.Node `yaml:"backends,omitempty"`
+	// Relabel rewrites or drops metrics before they reach any backend.
+	Relabel []RelabelConfig `yaml:"relabel,omitempty"`
+}
+
+// DeliveryConfig holds the delivery settings shared by every storage
+// backend. Each backend config inlines it, so these blocks sit alongside
+// the backend's own fields.
+type DeliveryConfig struct {
+	Queue QueueConfig `yaml:"queue,omitempty"`
+	Retry RetryConfig `yaml:"retry,omitempty"`
+	Spool SpoolConfig `yaml:"spool,omitempty"`
+	Route RouteConfig `yaml:"route,omitempty"`
+	// Relabel rewrites or drops the metrics the backend's route includes.
+	Relabel []RelabelConfig `yaml:"relabel,omitempty"`
+}
+
+// QueueConfig controls how sends to a storage backend are buffered.
+type QueueConfig struct {
+	Size         int    `yaml:"size,omitempty"`
+	Workers      int    `yaml:"workers,omitempty"`
+	Overflow     string `yaml:"overflow,omitempty"`
+	FlushTimeout string `yaml:"flush-timeout,omitempty"`
+}
+
+// RetryConfig controls how failed sends to a storage backend are retried.
+type RetryConfig struct {
+	Attempts       int      `yaml:"attempts,omitempty"`
+	InitialBackoff string   `yaml:"initial-backoff,omitempty"`
+	MaxBackoff     string   `yaml:"max-backoff,omitempty"`
+	RetryOn        []string `yaml:"retry-on,omitempty"`
+}
+
+// SpoolConfig enables a disk-backed spool for metrics and events that a
+// storage backend couldn't accept.
+type SpoolConfig struct {
+	Dir            string `yaml:"dir,omitempty"`
+	MaxItems       int    `yaml:"max-items,omitempty"`
+	ReplayInterval string `yaml:"replay-interval,omitempty"`
+}
+
+// RouteConfig selects which metrics and events a storage backend receives.
+type RouteConfig struct {
+	Include []RouteMatcher `yaml:"include,omitempty"`
+	Exclude []RouteMatcher `yaml:"exclude,omitempty"`
+	// Default makes the backend receive only what no other backend of its
+	// kind includes.
+	Default bool `yaml:"default,omitempty"`
+}
+
+// RouteMatcher matches metrics and events. The job, timing and tag values
+// are regular expressions matching the whole value; all set fields must
+// match.
+type RouteMatcher struct {
+	Job    string            `yaml:"job,omitempty"`
+	Timing string            `yaml:"timing,omitempty"`
+	Tags   map[string]string `yaml:"tags,omitempty"`
+	Status string            `yaml:"status,omitempty"`
+}
+
+// RelabelConfig is one step of a metric relabel pipeline, modelled on
+// Prometheus's relabel_config.
+type RelabelConfig struct {
+	SourceLabels []string `yaml:"source-labels,omitempty"`
+	Separator    *string  `yaml:"separator,omitempty"`
+	Regex        string   `yaml:"regex,omitempty"`
+	TargetLabel  string   `yaml:"target-label,omitempty"`
+	Replacement  *string  `yaml:"replacement,omitempty"`
+	Modulus      uint64   `yaml:"modulus,omitempty"`
+	Action       string   `yaml:"action,omitempty"`
 }
 
 // DogstatsdConfig holds Datadog DogStatsD configuration.
 type DogstatsdConfig struct {
-	Host      string `yaml:"host"`
-	Port      int    `yaml:"port"`
-	Namespace string `yaml:"metric-namespace"`
+	Host           string `yaml:"host"`
+	Port           int    `yaml:"port"`
+	Namespace      string `yaml:"metric-namespace"`
+	DeliveryConfig `yaml:",inline"`
 }
 
 // PrometheusConfig holds Prometheus configuration.
 type PrometheusConfig struct {
-	ListenAddr string `yaml:"listen-addr"`
-	Namespace  string `yaml:"metric-namespace,omitempty"`
+	ListenAddr        string                            `yaml:"listen-addr"`
+	Namespace         string                            `yaml:"metric-namespace,omitempty"`
+	TimingType        string                            `yaml:"timing-type,omitempty"`
+	Buckets           []float64                         `yaml:"buckets,omitempty"`
+	NativeHistograms  bool                              `yaml:"native-histograms,omitempty"`
+	SummaryObjectives map[float64]float64               `yaml:"summary-objectives,omitempty"`
+	Timings           map[string]PrometheusTimingConfig `yaml:"timings,omitempty"`
+	SeriesTTL         string                            `yaml:"series-ttl,omitempty"`
+	DeliveryConfig    `yaml:",inline"`
+}
+
+// PrometheusTimingConfig overrides how one timing metric is exposed.
+type PrometheusTimingConfig struct {
+	Type    string    `yaml:"type,omitempty"`
+	Buckets []float64 `yaml:"buckets,omitempty"`
 }
 
 // InfluxDBConfig holds InfluxDB v2 configuration.
 type InfluxDBConfig struct {
-	Host      string `yaml:"host"`
-	Token     string `yaml:"token"`
-	TokenFile string `yaml:"token-file,omitempty"`
-	Org       string `yaml:"org"`
-	Bucket    string `yaml:"bucket"`
-	Namespace string `yaml:"metric-namespace,omitempty"`
+	Host           string `yaml:"host"`
+	Token          string `yaml:"token"`
+	TokenFile      string `yaml:"token-file,omitempty"`
+	Org            string `yaml:"org"`
+	Bucket         string `yaml:"bucket"`
+	Namespace      string `yaml:"metric-namespace,omitempty"`
+	DeliveryConfig `yaml:",inline"`
 }
 
 // LogConfig holds log file configuration.
 type LogConfig struct {
-	File   string       `yaml:"file"`
-	Format FormatConfig `yaml:"format"`
-	Time   TimeConfig   `yaml:"time"`
+	File           string       `yaml:"file"`
+	Format         FormatConfig `yaml:"format"`
+	Time           TimeConfig   `yaml:"time"`
+	DeliveryConfig `yaml:",inline"`
 }
 
-// FormatConfig holds log format configuration.
+// FormatConfig holds log format configuration. It is either a mapping of
+// format strings or, for a structured format, just the format's name, as in
+// "format: json".
 type FormatConfig struct {
+	// Mode names a structured format. The format strings are ignored when
+	// it is set.
+	Mode         string `yaml:"mode,omitempty"`
 	Metric       string `yaml:"metric"`
 	Event        string `yaml:"event"`
 	Tag          string `yaml:"tag"`
 	TagSeparator string `yaml:"tag-seperator"`
 }
 
+// UnmarshalYAML decodes either a format mode name or a mapping of format
+// strings.
+func (f *FormatConfig) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		*f = FormatConfig{}
+		return node.Decode(&f.Mode)
+	}
+	// The alias type has no UnmarshalYAML, so this doesn't recurse.
+	type formatConfig FormatConfig
+	return node.Decode((*formatConfig)(f))
+}
+
 // TimeConfig holds timestamp configuration.
 type TimeConfig struct {
 	Location string `yaml:"location"`
@@ -95,6 +227,11 @@ type PagerDutyConfig struct {
 	RoutingKeyFile string        `yaml:"routing-key-file,omitempty"`
 	Client         string        `yaml:"client"`
 	EventDuration  time.Duration `yaml:"event-duration,omitempty"`
+	StateFile      string        `yaml:"state-file,omitempty"`
+	// AcknowledgeSeverities lists event severities that acknowledge a
+	// job's open incident instead of triggering it.
+	AcknowledgeSeverities []string `yaml:"acknowledge-severities,omitempty"`
+	DeliveryConfig        `yaml:",inline"`
 }
 
 // SplunkHecConfig holds Splunk HEC configuration.
@@ -110,6 +247,81 @@ type SplunkHecConfig struct {
 	EventsIndex               string `yaml:"events-index"`
 	SkipCertificateValidation bool   `yaml:"skip-cert-validation"`
 	CaCert                    string `yaml:"ca-cert"`
+	DeliveryConfig            `yaml:",inline"`
+}
+
+// OTLPConfig holds OpenTelemetry OTLP exporter configuration.
+type OTLPConfig struct {
+	Endpoint                  string            `yaml:"endpoint"`
+	Protocol                  string            `yaml:"protocol,omitempty"`
+	Headers                   map[string]string `yaml:"headers,omitempty"`
+	Insecure                  bool              `yaml:"insecure,omitempty"`
+	CaCert                    string            `yaml:"ca-cert,omitempty"`
+	SkipCertificateValidation bool              `yaml:"skip-cert-validation,omitempty"`
+	ServiceName               string            `yaml:"service-name,omitempty"`
+	Namespace                 string            `yaml:"metric-namespace,omitempty"`
+	BatchSize                 int               `yaml:"batch-size,omitempty"`
+	DeliveryConfig            `yaml:",inline"`
+}
+
+// GraphiteConfig holds Graphite (Carbon) configuration.
+type GraphiteConfig struct {
+	Host           string `yaml:"host"`
+	Port           int    `yaml:"port,omitempty"`
+	Protocol       string `yaml:"protocol,omitempty"`
+	Format         string `yaml:"format,omitempty"`
+	Namespace      string `yaml:"metric-namespace,omitempty"`
+	PathTemplate   string `yaml:"path-template,omitempty"`
+	TaggedSeries   bool   `yaml:"tagged-series,omitempty"`
+	BatchSize      int    `yaml:"batch-size,omitempty"`
+	DeliveryConfig `yaml:",inline"`
+}
+
+// HTTPAuthConfig holds the headers, credentials and TLS options shared by
+// the HTTP push backends. It is inlined into their config blocks.
+type HTTPAuthConfig struct {
+	Headers                   map[string]string `yaml:"headers,omitempty"`
+	Username                  string            `yaml:"username,omitempty"`
+	Password                  string            `yaml:"password,omitempty"`
+	PasswordFile              string            `yaml:"password-file,omitempty"`
+	BearerToken               string            `yaml:"bearer-token,omitempty"`
+	BearerTokenFile           string            `yaml:"bearer-token-file,omitempty"`
+	CaCert                    string            `yaml:"ca-cert,omitempty"`
+	SkipCertificateValidation bool              `yaml:"skip-cert-validation,omitempty"`
+}
+
+// PrometheusRemoteWriteConfig holds Prometheus remote-write configuration.
+type PrometheusRemoteWriteConfig struct {
+	URL            string `yaml:"url"`
+	Namespace      string `yaml:"metric-namespace,omitempty"`
+	BatchSize      int    `yaml:"batch-size,omitempty"`
+	HTTPAuthConfig `yaml:",inline"`
+	DeliveryConfig `yaml:",inline"`
+}
+
+// PushgatewayConfig holds Prometheus Pushgateway configuration.
+type PushgatewayConfig struct {
+	URL            string            `yaml:"url"`
+	Job            string            `yaml:"job,omitempty"`
+	Grouping       map[string]string `yaml:"grouping,omitempty"`
+	Namespace      string            `yaml:"metric-namespace,omitempty"`
+	BatchSize      int               `yaml:"batch-size,omitempty"`
+	HTTPAuthConfig `yaml:",inline"`
+	DeliveryConfig `yaml:",inline"`
+}
+
+// WebhookConfig holds webhook configuration.
+type WebhookConfig struct {
+	URL                       string            `yaml:"url"`
+	Method                    string            `yaml:"method,omitempty"`
+	Headers                   map[string]string `yaml:"headers,omitempty"`
+	Body                      string            `yaml:"body,omitempty"`
+	RateLimit                 int               `yaml:"rate-limit,omitempty"`
+	RateLimitInterval         string            `yaml:"rate-limit-interval,omitempty"`
+	StateChangesOnly          bool              `yaml:"state-changes-only,omitempty"`
+	SkipCertificateValidation bool              `yaml:"skip-cert-validation"`
+	CaCert                    string            `yaml:"ca-cert"`
+	DeliveryConfig            `yaml:",inline"`
 }
 
 // readSecretFile reads a secret from a file path, trimming whitespace.
@@ -127,27 +339,67 @@ func readSecretFile(path, fallback string) (string, error) {
 
 // ResolveSecrets resolves file-based secret references into their inline fields.
 // When both inline and file variants are set, the file takes precedence.
+// Backends listed under storage.backends resolve their own secrets when
+// they are created.
 func (c *ServiceConfig) ResolveSecrets() error {
-	if c.Storage.InfluxDB.TokenFile != "" {
-		token, err := readSecretFile(c.Storage.InfluxDB.TokenFile, c.Storage.InfluxDB.Token)
-		if err != nil {
+	for _, r := range []interface{ ResolveSecrets() error }{
+		&c.Storage.InfluxDB,
+		&c.Storage.SplunkHec,
+		&c.Storage.PagerDuty,
+		&c.Storage.RemoteWrite,
+		&c.Storage.Pushgateway,
+	} {
+		if err := r.ResolveSecrets(); err != nil {
 			return err
 		}
-		c.Storage.InfluxDB.Token = token
 	}
-	if c.Storage.SplunkHec.TokenFile != "" {
-		token, err := readSecretFile(c.Storage.SplunkHec.TokenFile, c.Storage.SplunkHec.Token)
-		if err != nil {
-			return err
-		}
-		c.Storage.SplunkHec.Token = token
+	return nil
+}
+
+// ResolveSecrets reads the token file, if set.
+func (c *InfluxDBConfig) ResolveSecrets() error {
+	token, err := readSecretFile(c.TokenFile, c.Token)
+	if err != nil {
+		return err
+	}
+	c.Token = token
+	return nil
+}
+
+// ResolveSecrets reads the token file, if set.
+func (c *SplunkHecConfig) ResolveSecrets() error {
+	token, err := readSecretFile(c.TokenFile, c.Token)
+	if err != nil {
+		return err
+	}
+	c.Token = token
+	return nil
+}
+
+// ResolveSecrets reads the routing key file, if set.
+func (c *PagerDutyConfig) ResolveSecrets() error {
+	key, err := readSecretFile(c.RoutingKeyFile, c.RoutingKey)
+	if err != nil {
+		return err
 	}
-	if c.Storage.PagerDuty.RoutingKeyFile != "" {
-		key, err := readSecretFile(c.Storage.PagerDuty.RoutingKeyFile, c.Storage.PagerDuty.RoutingKey)
+	c.RoutingKey = key
+	return nil
+}
+
+// ResolveSecrets reads the password and bearer token files, if set.
+func (a *HTTPAuthConfig) ResolveSecrets() error {
+	for _, s := range []struct {
+		file  string
+		value *string
+	}{
+		{a.PasswordFile, &a.Password},
+		{a.BearerTokenFile, &a.BearerToken},
+	} {
+		v, err := readSecretFile(s.file, *s.value)
 		if err != nil {
 			return err
 		}
-		c.Storage.PagerDuty.RoutingKey = key
+		*s.value = v
 	}
 	return nil
 }
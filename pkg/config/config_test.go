@@ -83,6 +83,10 @@ general:
   report-internal-metrics: true
   internal-metrics-gathering-interval: 15
   user-agent: crabby/test
+  scheduling:
+    splay: 30s
+    jitter: 2s
+    run-on-start: true
   tags:
     env: production
     region: us-east-1
@@ -110,6 +114,10 @@ jobs:
 				if c.General.Tags["region"] != "us-east-1" {
 					t.Errorf("expected tag region=us-east-1, got %q", c.General.Tags["region"])
 				}
+				want := SchedulingConfig{Splay: "30s", Jitter: "2s", RunOnStart: true}
+				if c.General.Scheduling != want {
+					t.Errorf("expected scheduling %+v, got %+v", want, c.General.Scheduling)
+				}
 			},
 		},
 		{
@@ -222,6 +230,106 @@ storage:
 				}
 			},
 		},
+		{
+			name: "storage backend list alongside single-instance fields",
+			yaml: `
+jobs:
+  - name: test
+    type: simple
+    url: https://example.com
+    interval: 10
+storage:
+  influxdb:
+    host: https://influx.example.com:8086
+  backends:
+    - name: influx-archive
+      type: influxdb
+      host: https://archive.example.com:8086
+      bucket: crabby-1y
+    - name: pd-payments
+      type: pagerduty
+      routing-key-file: /etc/crabby/payments-key
+`,
+			check: func(t *testing.T, c ServiceConfig) {
+				if c.Storage.InfluxDB.Host != "https://influx.example.com:8086" {
+					t.Errorf("expected influxdb host, got %q", c.Storage.InfluxDB.Host)
+				}
+				if len(c.Storage.Backends) != 2 {
+					t.Fatalf("expected 2 backends, got %d", len(c.Storage.Backends))
+				}
+				var b InfluxDBConfig
+				if err := c.Storage.Backends[0].Decode(&b); err != nil {
+					t.Fatal(err)
+				}
+				if b.Bucket != "crabby-1y" {
+					t.Errorf("expected archive bucket crabby-1y, got %q", b.Bucket)
+				}
+			},
+		},
+		{
+			name: "structured log format by name",
+			yaml: `
+jobs:
+  - name: test
+    type: simple
+    url: https://example.com
+    interval: 10
+storage:
+  log:
+    file: stdout
+    format: logfmt
+  backends:
+    - type: log
+      file: stderr
+      format:
+        metric: "%job %timing"
+`,
+			check: func(t *testing.T, c ServiceConfig) {
+				if c.Storage.Log.Format != (FormatConfig{Mode: "logfmt"}) {
+					t.Errorf("expected logfmt mode, got %+v", c.Storage.Log.Format)
+				}
+				var b LogConfig
+				if err := c.Storage.Backends[0].Decode(&b); err != nil {
+					t.Fatal(err)
+				}
+				if b.Format.Mode != "" || b.Format.Metric != "%job %timing" {
+					t.Errorf("expected metric format string, got %+v", b.Format)
+				}
+			},
+		},
+		{
+			name: "global and per-backend relabel rules",
+			yaml: `
+jobs:
+  - name: test
+    type: simple
+    url: https://example.com
+    interval: 10
+storage:
+  relabel:
+    - source-labels: [__name__]
+      regex: "(.*)_milliseconds"
+      target-label: __name__
+      replacement: "${1}_ms"
+  dogstatsd:
+    host: localhost
+    relabel:
+      - action: labeldrop
+        regex: url
+`,
+			check: func(t *testing.T, c ServiceConfig) {
+				if len(c.Storage.Relabel) != 1 {
+					t.Fatalf("expected 1 global relabel rule, got %d", len(c.Storage.Relabel))
+				}
+				r := c.Storage.Relabel[0]
+				if r.TargetLabel != "__name__" || r.Replacement == nil || *r.Replacement != "${1}_ms" {
+					t.Errorf("unexpected relabel rule %+v", r)
+				}
+				if len(c.Storage.Dogstatsd.Relabel) != 1 || c.Storage.Dogstatsd.Relabel[0].Action != "labeldrop" {
+					t.Errorf("unexpected dogstatsd relabel rules %+v", c.Storage.Dogstatsd.Relabel)
+				}
+			},
+		},
 	}
 
 	for _, tt := range tests {
@@ -387,6 +495,28 @@ func TestResolveSecrets(t *testing.T) {
 		}
 	})
 
+	t.Run("push backend credentials from files", func(t *testing.T) {
+		c := ServiceConfig{
+			Storage: StorageConfig{
+				RemoteWrite: PrometheusRemoteWriteConfig{
+					HTTPAuthConfig: HTTPAuthConfig{Username: "crabby", PasswordFile: writeSecret(t, "rw-password\n")},
+				},
+				Pushgateway: PushgatewayConfig{
+					HTTPAuthConfig: HTTPAuthConfig{BearerTokenFile: writeSecret(t, "pgw-token")},
+				},
+			},
+		}
+		if err := c.ResolveSecrets(); err != nil {
+			t.Fatal(err)
+		}
+		if c.Storage.RemoteWrite.Password != "rw-password" {
+			t.Errorf("remote-write password = %q, want rw-password", c.Storage.RemoteWrite.Password)
+		}
+		if c.Storage.Pushgateway.BearerToken != "pgw-token" {
+			t.Errorf("pushgateway bearer token = %q, want pgw-token", c.Storage.Pushgateway.BearerToken)
+		}
+	})
+
 	t.Run("missing secret file returns error", func(t *testing.T) {
 		c := ServiceConfig{
 			Storage: StorageConfig{
@@ -0,0 +1,200 @@
+package job
+
+import (
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// AlertPolicy decides which of a job's events reach the event backends.
+// A job starts healthy and begins alerting after Failures failed runs; it
+// recovers after Recoveries consecutive successful runs. While a job is
+// healthy its failed runs' events are held back, and while it is alerting its
+// successful runs' events are held back, so backends such as PagerDuty only
+// see confirmed state changes. Metrics are never filtered.
+//
+// The zero AlertPolicy forwards every event.
+type AlertPolicy struct {
+	// Failures is the number of failed runs that starts an alert (default 1).
+	Failures int
+	// Window, if set, starts an alert when Failures of the last Window runs
+	// failed instead of requiring consecutive failures.
+	Window int
+	// Recoveries is the number of consecutive successful runs that ends an
+	// alert (default 1).
+	Recoveries int
+	// FlapThreshold, if set, is the number of state changes within
+	// FlapWindow that marks a job as flapping. A flapping job's events are
+	// held back for FlapSuppression.
+	FlapThreshold   int
+	FlapWindow      time.Duration
+	FlapSuppression time.Duration
+}
+
+// alertOverrides holds the per-job `alerting` block.
+type alertOverrides struct {
+	Failures        *int   `yaml:"failures,omitempty"`
+	Window          *int   `yaml:"window,omitempty"`
+	Recoveries      *int   `yaml:"recoveries,omitempty"`
+	FlapThreshold   *int   `yaml:"flap-threshold,omitempty"`
+	FlapWindow      string `yaml:"flap-window,omitempty"`
+	FlapSuppression string `yaml:"flap-suppression,omitempty"`
+}
+
+// apply returns defaults with any overrides set in the job's config, with
+// unset thresholds defaulted and the result validated.
+func (o alertOverrides) apply(defaults AlertPolicy) (AlertPolicy, error) {
+	p := defaults
+	for _, f := range []struct {
+		v   *int
+		dst *int
+	}{
+		{o.Failures, &p.Failures},
+		{o.Window, &p.Window},
+		{o.Recoveries, &p.Recoveries},
+		{o.FlapThreshold, &p.FlapThreshold},
+	} {
+		if f.v != nil {
+			*f.dst = *f.v
+		}
+	}
+	for _, f := range []struct {
+		name string
+		s    string
+		dst  *time.Duration
+	}{
+		{"flap-window", o.FlapWindow, &p.FlapWindow},
+		{"flap-suppression", o.FlapSuppression, &p.FlapSuppression},
+	} {
+		if f.s == "" {
+			continue
+		}
+		d, err := time.ParseDuration(f.s)
+		if err != nil {
+			return p, fmt.Errorf("invalid alerting %s %q", f.name, f.s)
+		}
+		*f.dst = d
+	}
+	return p.normalize()
+}
+
+// normalize fills in the default thresholds and validates p.
+func (p AlertPolicy) normalize() (AlertPolicy, error) {
+	if p.Failures == 0 {
+		p.Failures = 1
+	}
+	if p.Recoveries == 0 {
+		p.Recoveries = 1
+	}
+	switch {
+	case p.Failures < 0 || p.Recoveries < 0 || p.Window < 0 || p.FlapThreshold < 0:
+		return p, fmt.Errorf("alerting thresholds must not be negative")
+	case p.Window > 0 && p.Window < p.Failures:
+		return p, fmt.Errorf("alerting window (%d) must be at least failures (%d)", p.Window, p.Failures)
+	case p.FlapThreshold > 0 && (p.FlapWindow <= 0 || p.FlapSuppression <= 0):
+		return p, fmt.Errorf("alerting flap-threshold requires a positive flap-window and flap-suppression")
+	}
+	return p, nil
+}
+
+// alertState tracks one job's runs against its AlertPolicy.
+type alertState struct {
+	policy AlertPolicy
+
+	mu              sync.Mutex
+	alerting        bool
+	history         []bool // most recent runs, true for failed; at most Window long
+	consecutive     int    // consecutive runs contradicting the current state
+	changes         []time.Time
+	suppressedUntil time.Time
+}
+
+func newAlertState(p AlertPolicy) *alertState {
+	return &alertState{policy: p}
+}
+
+// filter records a run that produced events and returns the events that
+// should be sent. A run failed if any of its events did.
+func (s *alertState) filter(name string, events []Event, now time.Time) []Event {
+	if s == nil || len(events) == 0 {
+		return events
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	failed := false
+	for _, e := range events {
+		if e.Failed() {
+			failed = true
+			break
+		}
+	}
+
+	if s.policy.Window > 0 {
+		s.history = append(s.history, failed)
+		if len(s.history) > s.policy.Window {
+			s.history = s.history[1:]
+		}
+	}
+	if failed == s.alerting {
+		s.consecutive = 0
+	} else {
+		s.consecutive++
+	}
+
+	changed := false
+	switch {
+	case !s.alerting && failed && s.shouldAlert():
+		s.alerting, changed = true, true
+	case s.alerting && !failed && s.consecutive >= s.policy.Recoveries:
+		s.alerting, changed = false, true
+	}
+	if changed {
+		s.consecutive = 0
+		s.history = s.history[:0]
+		slog.Info("job alert state changed", "job", name, "alerting", s.alerting)
+		s.recordChange(name, now)
+	}
+
+	if now.Before(s.suppressedUntil) || failed != s.alerting {
+		return nil
+	}
+	return events
+}
+
+// shouldAlert reports whether a healthy job's recent failures reach the
+// policy's threshold. s.mu must be held.
+func (s *alertState) shouldAlert() bool {
+	if s.policy.Window == 0 {
+		return s.consecutive >= s.policy.Failures
+	}
+	n := 0
+	for _, f := range s.history {
+		if f {
+			n++
+		}
+	}
+	return n >= s.policy.Failures
+}
+
+// recordChange notes a state change and starts suppression if the job has
+// changed state FlapThreshold times within FlapWindow. s.mu must be held.
+func (s *alertState) recordChange(name string, now time.Time) {
+	if s.policy.FlapThreshold == 0 {
+		return
+	}
+	cutoff := now.Add(-s.policy.FlapWindow)
+	kept := s.changes[:0]
+	for _, t := range s.changes {
+		if t.After(cutoff) {
+			kept = append(kept, t)
+		}
+	}
+	s.changes = append(kept, now)
+	if len(s.changes) >= s.policy.FlapThreshold {
+		s.suppressedUntil = now.Add(s.policy.FlapSuppression)
+		s.changes = s.changes[:0]
+		slog.Warn("job is flapping, suppressing events", "job", name, "until", s.suppressedUntil)
+	}
+}
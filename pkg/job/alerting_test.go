@@ -0,0 +1,153 @@
+package job
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAlertOverrides_apply(t *testing.T) {
+	three, five := 3, 5
+	tests := []struct {
+		name     string
+		defaults AlertPolicy
+		o        alertOverrides
+		want     AlertPolicy
+		wantErr  string
+	}{
+		{name: "zero defaults", want: AlertPolicy{Failures: 1, Recoveries: 1}},
+		{
+			name:     "general defaults",
+			defaults: AlertPolicy{Failures: 2, Recoveries: 2},
+			want:     AlertPolicy{Failures: 2, Recoveries: 2},
+		},
+		{
+			name:     "overrides",
+			defaults: AlertPolicy{Failures: 2},
+			o:        alertOverrides{Failures: &three, Window: &five, FlapThreshold: &three, FlapWindow: "10m", FlapSuppression: "30m"},
+			want: AlertPolicy{
+				Failures: 3, Window: 5, Recoveries: 1,
+				FlapThreshold: 3, FlapWindow: 10 * time.Minute, FlapSuppression: 30 * time.Minute,
+			},
+		},
+		{name: "window too small", o: alertOverrides{Failures: &five, Window: &three}, wantErr: "window (3) must be at least failures (5)"},
+		{name: "flapping without window", o: alertOverrides{FlapThreshold: &three}, wantErr: "flap-threshold requires"},
+		{name: "bad duration", o: alertOverrides{FlapWindow: "often"}, wantErr: `invalid alerting flap-window "often"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.o.apply(tt.defaults)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("apply() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAlertState_filter(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy AlertPolicy
+		// runs is a sequence of run results: F for failed, S for succeeded.
+		runs string
+		// want marks the runs whose events are forwarded.
+		want string
+	}{
+		{name: "default forwards everything", policy: AlertPolicy{Failures: 1, Recoveries: 1}, runs: "SFSFFS", want: "111111"},
+		{name: "consecutive failures", policy: AlertPolicy{Failures: 3, Recoveries: 1}, runs: "SFFSFFFFS", want: "100100111"},
+		{name: "recoveries", policy: AlertPolicy{Failures: 1, Recoveries: 2}, runs: "FSFSSS", want: "101011"},
+		{name: "m of k", policy: AlertPolicy{Failures: 2, Window: 4, Recoveries: 1}, runs: "FSSSFSFF", want: "01110111"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newAlertState(tt.policy)
+			now := time.Now()
+			var got strings.Builder
+			for i, r := range tt.runs {
+				status := 200
+				if r == 'F' {
+					status = 503
+				}
+				events := s.filter("web", []Event{{Name: "web", ServerStatus: status}}, now.Add(time.Duration(i)*time.Minute))
+				if len(events) > 0 {
+					got.WriteByte('1')
+				} else {
+					got.WriteByte('0')
+				}
+			}
+			if got.String() != tt.want {
+				t.Errorf("runs %s forwarded %s, want %s", tt.runs, got.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestAlertState_filter_flapping(t *testing.T) {
+	s := newAlertState(AlertPolicy{
+		Failures: 1, Recoveries: 1,
+		FlapThreshold: 3, FlapWindow: 10 * time.Minute, FlapSuppression: 30 * time.Minute,
+	})
+	start := time.Now()
+	run := func(minute int, status int) bool {
+		return len(s.filter("web", []Event{{Name: "web", ServerStatus: status}}, start.Add(time.Duration(minute)*time.Minute))) > 0
+	}
+
+	// Two state changes are forwarded; the third within the window starts
+	// suppression.
+	if !run(0, 500) || !run(1, 200) {
+		t.Fatal("state changes before flapping should be forwarded")
+	}
+	if run(2, 500) {
+		t.Error("third state change within the flap window should be suppressed")
+	}
+	if run(20, 200) || run(25, 500) {
+		t.Error("events during suppression should be held back")
+	}
+	// After suppression ends, the current state is forwarded again.
+	if !run(33, 500) {
+		t.Error("events after suppression should be forwarded")
+	}
+}
+
+func TestAlertState_nilForwardsEverything(t *testing.T) {
+	var s *alertState
+	events := []Event{{Name: "web", ServerStatus: 503}}
+	if got := s.filter("web", events, time.Now()); len(got) != 1 {
+		t.Errorf("nil alertState filtered events: %v", got)
+	}
+}
+
+func TestBuildJobs_Alerting(t *testing.T) {
+	jm := NewJobManager(nil)
+	jm.RegisterFactory(&mockFactory{typeName: "http"})
+
+	opts := JobOptions{Alerting: AlertPolicy{Failures: 2}}
+	if err := jm.BuildJobs(makeYAMLNodes(t,
+		"type: http",
+		"type: http\nalerting:\n  failures: 4\n  recoveries: 2",
+	), opts); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := jm.jobs[0].alert.policy, (AlertPolicy{Failures: 2, Recoveries: 1}); got != want {
+		t.Errorf("job 0 policy = %+v, want %+v", got, want)
+	}
+	if got, want := jm.jobs[1].alert.policy, (AlertPolicy{Failures: 4, Recoveries: 2}); got != want {
+		t.Errorf("job 1 policy = %+v, want %+v", got, want)
+	}
+
+	err := jm.BuildJobs(makeYAMLNodes(t, "type: http\nalerting:\n  failures: 3\n  window: 2"), opts)
+	if err == nil || !strings.Contains(err.Error(), "window") {
+		t.Errorf("error = %v, want window error", err)
+	}
+}
@@ -11,6 +11,7 @@ package job
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -34,6 +35,23 @@ type JobStep struct {
 	Header      map[string]string `yaml:"header,omitempty"`
 	ContentType string            `yaml:"content-type,omitempty"`
 	Body        string            `yaml:"body,omitempty"`
+	Assert      []string          `yaml:"assert,omitempty"`
+	Extract     map[string]string `yaml:"extract,omitempty"`
+}
+
+// AssertionError reports that a step's response didn't satisfy one of its
+// assert rules. The step still produced a response, metrics and an event.
+type AssertionError struct {
+	Err error
+}
+
+func (e *AssertionError) Error() string { return e.Err.Error() }
+func (e *AssertionError) Unwrap() error { return e.Err }
+
+// stepChecks holds the compiled assert and extract rules for one step.
+type stepChecks struct {
+	asserts  []*jsonAssertion
+	extracts map[string]*jsonPath
 }
 
 // StepResult holds the outcome of a single API step execution.
@@ -66,23 +84,34 @@ type APIJob struct {
 	tags      map[string]string
 	template  TemplateEngine
 	userAgent string
+	checks    []stepChecks
 }
 
 func (j *APIJob) Name() string            { return j.config.Steps[0].Name }
 func (j *APIJob) Interval() time.Duration { return time.Duration(j.config.Interval) * time.Second }
+func (j *APIJob) URL() string             { return j.config.Steps[0].URL }
+func (j *APIJob) Tags() map[string]string { return j.tags }
 
 // Run executes all API steps and returns collected metrics and events.
 func (j *APIJob) Run(ctx context.Context) ([]Metric, []Event, error) {
 	results, err := j.RunSteps(ctx, j.config.Steps)
-	if err != nil {
+	var assertErr *AssertionError
+	if err != nil && !errors.As(err, &assertErr) {
 		return nil, nil, err
 	}
 
+	// A failed assertion is reported through the failing step's event, so the
+	// metrics and events gathered up to that point are still delivered.
 	var allMetrics []Metric
 	var allEvents []Event
-	for _, r := range results {
+	for i, r := range results {
 		allMetrics = append(allMetrics, r.Metrics...)
-		allEvents = append(allEvents, r.Events...)
+		for _, e := range r.Events {
+			// Like metrics, events carry the configured URL.
+			e.URL = j.config.Steps[i].URL
+			e.Duration = r.Duration
+			allEvents = append(allEvents, e)
+		}
 	}
 	return allMetrics, allEvents, nil
 }
@@ -125,6 +154,13 @@ func (j *APIJob) runStep(ctx context.Context, stepNum int, responses StepRespons
 		method = http.MethodGet
 	}
 
+	reqURL, err := j.template.Resolve(step.URL, responses)
+	if err != nil {
+		result.Error = fmt.Errorf("substituting URL variables: %w", err)
+		result.Duration = time.Since(start)
+		return result
+	}
+
 	body, err := j.template.Resolve(step.Body, responses)
 	if err != nil {
 		result.Error = fmt.Errorf("substituting body variables: %w", err)
@@ -132,7 +168,7 @@ func (j *APIJob) runStep(ctx context.Context, stepNum int, responses StepRespons
 		return result
 	}
 
-	req, err := http.NewRequestWithContext(ctx, method, step.URL, strings.NewReader(body))
+	req, err := http.NewRequestWithContext(ctx, method, reqURL, strings.NewReader(body))
 	if err != nil {
 		result.Error = fmt.Errorf("creating request: %w", err)
 		result.Duration = time.Since(start)
@@ -196,12 +232,14 @@ func (j *APIJob) runStep(ctx context.Context, stepNum int, responses StepRespons
 		t0 = t1
 	}
 
-	u, err := url.Parse(step.URL)
+	u, err := url.Parse(reqURL)
 	if err != nil {
 		result.Error = fmt.Errorf("parsing URL: %w", err)
 		return result
 	}
 
+	// Metrics carry the configured URL rather than the resolved one, so that
+	// per-run values such as {{ uuid }} don't create a new series every run.
 	mk := func(timing string, value float64) Metric {
 		return MakeMetric(timing, value, step.Name, step.URL, j.tags)
 	}
@@ -226,9 +264,48 @@ func (j *APIJob) runStep(ctx context.Context, stepNum int, responses StepRespons
 		}
 	}
 
+	if err := j.checkResponse(stepNum, respBody, responses); err != nil {
+		result.Error = &AssertionError{Err: err}
+		result.Events = []Event{MakeFailureEvent(step.Name, resp.StatusCode, err.Error(), step.Tags)}
+	}
+
 	return result
 }
 
+// checkResponse applies the step's assert rules to its JSON response and
+// stores any extracted variables in responses for later steps.
+func (j *APIJob) checkResponse(stepNum int, body []byte, responses StepResponses) error {
+	if stepNum >= len(j.checks) {
+		return nil
+	}
+	c := j.checks[stepNum]
+	if len(c.asserts) == 0 && len(c.extracts) == 0 {
+		return nil
+	}
+
+	doc, err := decodeJSON(body)
+	if err != nil {
+		return fmt.Errorf("response is not valid JSON: %w", err)
+	}
+	for _, a := range c.asserts {
+		if err := a.Check(doc); err != nil {
+			return err
+		}
+	}
+	for name, path := range c.extracts {
+		v, err := path.Eval(doc)
+		if err != nil {
+			return fmt.Errorf("extracting %q: %w", name, err)
+		}
+		raw, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Errorf("extracting %q: %w", name, err)
+		}
+		responses[name] = raw
+	}
+	return nil
+}
+
 func (j *APIJob) addHeaders(req *http.Request, step JobStep, responses StepResponses) error {
 	req.Header = http.Header{}
 	for key, value := range step.Header {
@@ -263,21 +340,91 @@ func (f *APIFactory) Create(cfg yaml.Node, opts JobOptions) (Job, error) {
 	if err := validateStepNames(c.Steps); err != nil {
 		return nil, err
 	}
+	if err := validateStepTemplates(c.Steps); err != nil {
+		return nil, err
+	}
+	checks, err := compileStepChecks(c.Steps)
+	if err != nil {
+		return nil, err
+	}
 	return &APIJob{
 		config:    c,
 		client:    f.Client,
 		tags:      MergeTags(c.Tags, opts.GlobalTags),
 		userAgent: opts.UserAgent,
+		checks:    checks,
 	}, nil
 }
 
-// validateStepNames ensures all step names within an API job are unique.
+// compileStepChecks parses every step's assert and extract rules. Extracted
+// variable names share a namespace with step names and must not collide.
+func compileStepChecks(steps []JobStep) ([]stepChecks, error) {
+	names := make(map[string]bool, len(steps))
+	for _, s := range steps {
+		names[s.Name] = true
+	}
+
+	checks := make([]stepChecks, len(steps))
+	for i, s := range steps {
+		for _, expr := range s.Assert {
+			a, err := parseJSONAssertion(expr)
+			if err != nil {
+				return nil, fmt.Errorf("step %d (%s): %w", i, s.Name, err)
+			}
+			checks[i].asserts = append(checks[i].asserts, a)
+		}
+		if len(s.Extract) > 0 {
+			checks[i].extracts = make(map[string]*jsonPath, len(s.Extract))
+		}
+		for name, expr := range s.Extract {
+			if names[name] {
+				return nil, fmt.Errorf("step %d (%s): extract variable %q collides with a step or variable name", i, s.Name, name)
+			}
+			if _, ok := templateFuncs[name]; ok {
+				return nil, fmt.Errorf("step %d (%s): extract variable %q collides with a template function", i, s.Name, name)
+			}
+			names[name] = true
+			p, err := parseJSONPath(expr)
+			if err != nil {
+				return nil, fmt.Errorf("step %d (%s): extract %q: %w", i, s.Name, name, err)
+			}
+			checks[i].extracts[name] = p
+		}
+	}
+	return checks, nil
+}
+
+// validateStepTemplates checks the placeholder syntax in every step's URL,
+// headers and body.
+func validateStepTemplates(steps []JobStep) error {
+	var te TemplateEngine
+	for i, s := range steps {
+		if err := te.Validate(s.URL); err != nil {
+			return fmt.Errorf("step %d (%s): url: %w", i, s.Name, err)
+		}
+		for key, value := range s.Header {
+			if err := te.Validate(value); err != nil {
+				return fmt.Errorf("step %d (%s): header %s: %w", i, s.Name, key, err)
+			}
+		}
+		if err := te.Validate(s.Body); err != nil {
+			return fmt.Errorf("step %d (%s): body: %w", i, s.Name, err)
+		}
+	}
+	return nil
+}
+
+// validateStepNames ensures all step names within an API job are unique
+// and can be referenced, which a template function's name can't.
 func validateStepNames(steps []JobStep) error {
 	seen := make(map[string]int, len(steps))
 	for i, s := range steps {
 		if s.Name == "" {
 			return fmt.Errorf("step %d: name is required", i)
 		}
+		if _, ok := templateFuncs[s.Name]; ok {
+			return fmt.Errorf("step %d: name %q collides with a template function", i, s.Name)
+		}
 		if prev, ok := seen[s.Name]; ok {
 			return fmt.Errorf("step %d: duplicate name %q (first used at step %d)", i, s.Name, prev)
 		}
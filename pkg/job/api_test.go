@@ -0,0 +1,222 @@
+package job
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func newTestAPIJob(t *testing.T, client *http.Client, steps string) *APIJob {
+	t.Helper()
+	var node yaml.Node
+	if err := yaml.Unmarshal([]byte("type: api\ninterval: 30\nsteps:\n"+steps), &node); err != nil {
+		t.Fatal(err)
+	}
+	j, err := (&APIFactory{Client: client}).Create(*node.Content[0], JobOptions{})
+	if err != nil {
+		t.Fatalf("Create() error: %v", err)
+	}
+	return j.(*APIJob)
+}
+
+func TestAPIJob_AssertAndExtract(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/login":
+			w.Write([]byte(`{"status":"ok","auth":{"token":"abc123"}}`))
+		case "/items":
+			if r.Header.Get("Authorization") != "Bearer abc123" {
+				http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+				return
+			}
+			w.Write([]byte(`{"items":[]}`))
+		}
+	}))
+	defer srv.Close()
+
+	j := newTestAPIJob(t, srv.Client(), `
+  - name: login
+    url: `+srv.URL+`/login
+    assert:
+      - $.status == "ok"
+    extract:
+      token: $.auth.token
+  - name: items
+    url: `+srv.URL+`/items
+    header:
+      Authorization: Bearer {{ token }}
+    assert:
+      - $.items.length > 0
+`)
+
+	results, err := j.RunSteps(context.Background(), j.config.Steps)
+	var assertErr *AssertionError
+	if !errors.As(err, &assertErr) {
+		t.Fatalf("RunSteps() error = %v, want AssertionError", err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("got %d results, want 2", len(results))
+	}
+	if results[0].Error != nil {
+		t.Errorf("login step error: %v", results[0].Error)
+	}
+	if results[1].StatusCode != http.StatusOK {
+		t.Errorf("items status = %d, want 200 (token not extracted?)", results[1].StatusCode)
+	}
+	if !strings.Contains(results[1].Error.Error(), `$.items.length is 0`) {
+		t.Errorf("items step error = %v", results[1].Error)
+	}
+
+	metrics, events, err := j.Run(context.Background())
+	if err != nil {
+		t.Fatalf("Run() error = %v, want failure reported through events", err)
+	}
+	if len(metrics) == 0 {
+		t.Error("expected metrics from both steps")
+	}
+	if len(events) != 2 {
+		t.Fatalf("got %d events, want 2", len(events))
+	}
+	if events[0].Reason != "" {
+		t.Errorf("login event Reason = %q, want empty", events[0].Reason)
+	}
+	if !strings.Contains(events[1].Reason, `assertion "$.items.length > 0" failed`) {
+		t.Errorf("items event Reason = %q", events[1].Reason)
+	}
+}
+
+func TestAPIJob_TemplatedRequest(t *testing.T) {
+	t.Setenv("CRABBY_TEST_CREDENTIALS", "probe:secret")
+
+	var gotPath, gotAuth, gotRequestID string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/items":
+			w.Write([]byte(`{"items":[{"id":41,"name":"foo"},{"id":42,"name":"bar"}]}`))
+		default:
+			gotPath = r.URL.Path
+			gotAuth = r.Header.Get("Authorization")
+			gotRequestID = r.Header.Get("X-Request-ID")
+			w.Write([]byte(`{}`))
+		}
+	}))
+	defer srv.Close()
+
+	j := newTestAPIJob(t, srv.Client(), `
+  - name: list
+    url: `+srv.URL+`/items
+  - name: detail
+    url: `+srv.URL+`/items/{{ list.items[?name=="bar"].id }}
+    header:
+      Authorization: Basic {{ env "CRABBY_TEST_CREDENTIALS" | base64 }}
+      X-Request-ID: "{{ uuid }}"
+`)
+
+	metrics, _, err := j.Run(context.Background())
+	if err != nil {
+		t.Fatalf("Run() error: %v", err)
+	}
+	if gotPath != "/items/42" {
+		t.Errorf("path = %q, want /items/42", gotPath)
+	}
+	if gotAuth != "Basic cHJvYmU6c2VjcmV0" {
+		t.Errorf("Authorization = %q", gotAuth)
+	}
+	if len(gotRequestID) != 36 {
+		t.Errorf("X-Request-ID = %q, want a UUID", gotRequestID)
+	}
+
+	wantURL := srv.URL + `/items/{{ list.items[?name=="bar"].id }}`
+	for _, m := range metrics {
+		if m.Job == "detail" && m.URL != wantURL {
+			t.Errorf("metric URL = %q, want the configured template %q", m.URL, wantURL)
+			break
+		}
+	}
+}
+
+func TestAPIFactory_Create_InvalidChecks(t *testing.T) {
+	tests := []struct {
+		name    string
+		steps   string
+		wantErr string
+	}{
+		{
+			name: "bad assertion",
+			steps: `
+  - name: a
+    url: http://example.com
+    assert: ["$.status === 1"]
+`,
+			wantErr: "not a JSON literal",
+		},
+		{
+			name: "bad extract path",
+			steps: `
+  - name: a
+    url: http://example.com
+    extract:
+      token: auth.token
+`,
+			wantErr: "must start with",
+		},
+		{
+			name: "extract collides with step name",
+			steps: `
+  - name: a
+    url: http://example.com
+    extract:
+      b: $.id
+  - name: b
+    url: http://example.com
+`,
+			wantErr: `extract variable "b" collides`,
+		},
+		{
+			name: "extract collides with function",
+			steps: `
+  - name: a
+    url: http://example.com
+    extract:
+      uuid: $.id
+`,
+			wantErr: `extract variable "uuid" collides with a template function`,
+		},
+		{
+			name: "bad url template",
+			steps: `
+  - name: a
+    url: http://example.com/{{ env }}
+`,
+			wantErr: "url: parsing \"env\": env expects 1 argument, got 0",
+		},
+		{
+			name: "bad header template",
+			steps: `
+  - name: a
+    url: http://example.com
+    header:
+      X-Sig: '{{ login.body | nosuchfunc }}'
+`,
+			wantErr: "header X-Sig",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var node yaml.Node
+			if err := yaml.Unmarshal([]byte("type: api\nsteps:\n"+tt.steps), &node); err != nil {
+				t.Fatal(err)
+			}
+			_, err := (&APIFactory{}).Create(*node.Content[0], JobOptions{})
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error = %v, want containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,172 @@
+package job
+
+import (
+	"fmt"
+	"maps"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// ResponseAssertions describes checks applied to an HTTP response.
+type ResponseAssertions struct {
+	Status          []string          `yaml:"status,omitempty"`
+	BodyContains    []string          `yaml:"body-contains,omitempty"`
+	BodyNotContains []string          `yaml:"body-not-contains,omitempty"`
+	BodyRegex       []string          `yaml:"body-regex,omitempty"`
+	Headers         map[string]string `yaml:"headers,omitempty"`
+	HeaderRegex     map[string]string `yaml:"header-regex,omitempty"`
+	MaxBodyBytes    int64             `yaml:"max-body-bytes,omitempty"`
+}
+
+// statusRange is an inclusive range of HTTP status codes.
+type statusRange struct {
+	min, max int
+}
+
+// responseChecker is the compiled form of ResponseAssertions.
+type responseChecker struct {
+	assertions  ResponseAssertions
+	statuses    []statusRange
+	bodyRegex   []*regexp.Regexp
+	headerRegex map[string]*regexp.Regexp
+}
+
+// compile validates the assertions and precompiles status ranges and regexes.
+func (a ResponseAssertions) compile() (*responseChecker, error) {
+	c := &responseChecker{
+		assertions:  a,
+		headerRegex: make(map[string]*regexp.Regexp, len(a.HeaderRegex)),
+	}
+	for _, s := range a.Status {
+		r, err := parseStatusRange(s)
+		if err != nil {
+			return nil, err
+		}
+		c.statuses = append(c.statuses, r)
+	}
+	for _, expr := range a.BodyRegex {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("compiling body-regex %q: %w", expr, err)
+		}
+		c.bodyRegex = append(c.bodyRegex, re)
+	}
+	for name, expr := range a.HeaderRegex {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("compiling header-regex for %s %q: %w", name, expr, err)
+		}
+		c.headerRegex[name] = re
+	}
+	if a.MaxBodyBytes < 0 {
+		return nil, fmt.Errorf("max-body-bytes must not be negative")
+	}
+	return c, nil
+}
+
+// parseStatusRange parses "200", "2xx" or "200-299".
+func parseStatusRange(s string) (statusRange, error) {
+	s = strings.TrimSpace(strings.ToLower(s))
+	if len(s) == 3 && strings.HasSuffix(s, "xx") && s[0] >= '1' && s[0] <= '5' {
+		base := int(s[0]-'0') * 100
+		return statusRange{base, base + 99}, nil
+	}
+	if lo, hi, ok := strings.Cut(s, "-"); ok {
+		from, err1 := strconv.Atoi(strings.TrimSpace(lo))
+		to, err2 := strconv.Atoi(strings.TrimSpace(hi))
+		if err1 != nil || err2 != nil || from > to {
+			return statusRange{}, fmt.Errorf("invalid status range %q", s)
+		}
+		return statusRange{from, to}, nil
+	}
+	code, err := strconv.Atoi(s)
+	if err != nil {
+		return statusRange{}, fmt.Errorf("invalid status %q", s)
+	}
+	return statusRange{code, code}, nil
+}
+
+// checksStatus reports whether the assertions list the allowed statuses.
+func (c *responseChecker) checksStatus() bool {
+	return len(c.statuses) > 0
+}
+
+// needsBody reports whether any assertion inspects the response body.
+func (c *responseChecker) needsBody() bool {
+	a := c.assertions
+	return len(a.BodyContains) > 0 || len(a.BodyNotContains) > 0 || len(a.BodyRegex) > 0 || a.MaxBodyBytes > 0
+}
+
+// defaultBodyLimit caps how much of the body is read when max-body-bytes
+// isn't set.
+const defaultBodyLimit = 10 << 20
+
+// bodyLimit returns how many bytes of the body to read: one byte past
+// MaxBodyBytes, so that an oversized body can be detected, or
+// defaultBodyLimit if it isn't set.
+func (c *responseChecker) bodyLimit() int64 {
+	if c.assertions.MaxBodyBytes > 0 {
+		return c.assertions.MaxBodyBytes + 1
+	}
+	return defaultBodyLimit
+}
+
+// Check applies every assertion and returns the failures, if any, joined into
+// a single human-readable reason.
+func (c *responseChecker) Check(status int, header http.Header, body []byte) string {
+	var failures []string
+	a := c.assertions
+
+	if len(c.statuses) > 0 {
+		ok := false
+		for _, r := range c.statuses {
+			if status >= r.min && status <= r.max {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			failures = append(failures, fmt.Sprintf("status %d not in %s", status, strings.Join(a.Status, ", ")))
+		}
+	}
+
+	if a.MaxBodyBytes > 0 && int64(len(body)) > a.MaxBodyBytes {
+		failures = append(failures, fmt.Sprintf("body exceeds %d bytes", a.MaxBodyBytes))
+	}
+	for _, s := range a.BodyContains {
+		if !strings.Contains(string(body), s) {
+			failures = append(failures, fmt.Sprintf("body does not contain %q", s))
+		}
+	}
+	for _, s := range a.BodyNotContains {
+		if strings.Contains(string(body), s) {
+			failures = append(failures, fmt.Sprintf("body contains %q", s))
+		}
+	}
+	for _, re := range c.bodyRegex {
+		if !re.Match(body) {
+			failures = append(failures, fmt.Sprintf("body does not match /%s/", re))
+		}
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(a.Headers)) {
+		want := a.Headers[name]
+		if got := header.Get(name); got != want {
+			failures = append(failures, fmt.Sprintf("header %s = %q, want %q", name, got, want))
+		}
+	}
+	for _, name := range slices.Sorted(maps.Keys(c.headerRegex)) {
+		re := c.headerRegex[name]
+		if got := header.Get(name); !re.MatchString(got) {
+			failures = append(failures, fmt.Sprintf("header %s = %q does not match /%s/", name, got, re))
+		}
+	}
+
+	if len(failures) == 0 {
+		return ""
+	}
+	return "assertion failed: " + strings.Join(failures, "; ")
+}
@@ -0,0 +1,164 @@
+package job
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestParseStatusRange(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    statusRange
+		wantErr bool
+	}{
+		{input: "200", want: statusRange{200, 200}},
+		{input: "2xx", want: statusRange{200, 299}},
+		{input: "3XX", want: statusRange{300, 399}},
+		{input: "200-204", want: statusRange{200, 204}},
+		{input: " 401 - 403 ", want: statusRange{401, 403}},
+		{input: "6xx", wantErr: true},
+		{input: "204-200", wantErr: true},
+		{input: "ok", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := parseStatusRange(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseStatusRange(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("parseStatusRange(%q) = %+v, want %+v", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResponseAssertions_compile_errors(t *testing.T) {
+	tests := []struct {
+		name string
+		a    ResponseAssertions
+	}{
+		{name: "bad status", a: ResponseAssertions{Status: []string{"abc"}}},
+		{name: "bad body regex", a: ResponseAssertions{BodyRegex: []string{"("}}},
+		{name: "bad header regex", a: ResponseAssertions{HeaderRegex: map[string]string{"Server": "["}}},
+		{name: "negative max body", a: ResponseAssertions{MaxBodyBytes: -1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tt.a.compile(); err == nil {
+				t.Error("expected compile error")
+			}
+		})
+	}
+}
+
+func TestResponseChecker_Check(t *testing.T) {
+	header := http.Header{}
+	header.Set("Content-Type", "text/html; charset=utf-8")
+	header.Set("Server", "nginx/1.25")
+	body := []byte(`<html><body>Welcome back, build 1234</body></html>`)
+
+	tests := []struct {
+		name       string
+		a          ResponseAssertions
+		status     int
+		wantReason string
+	}{
+		{
+			name:   "all pass",
+			status: 200,
+			a: ResponseAssertions{
+				Status:          []string{"2xx"},
+				BodyContains:    []string{"Welcome"},
+				BodyNotContains: []string{"maintenance"},
+				BodyRegex:       []string{`build \d+`},
+				Headers:         map[string]string{"Content-Type": "text/html; charset=utf-8"},
+				HeaderRegex:     map[string]string{"Server": `^nginx/`},
+				MaxBodyBytes:    1024,
+			},
+		},
+		{
+			name:       "status not allowed",
+			status:     503,
+			a:          ResponseAssertions{Status: []string{"200", "301-302"}},
+			wantReason: "assertion failed: status 503 not in 200, 301-302",
+		},
+		{
+			name:       "maintenance page",
+			status:     200,
+			a:          ResponseAssertions{BodyNotContains: []string{"Welcome"}},
+			wantReason: `assertion failed: body contains "Welcome"`,
+		},
+		{
+			name:       "missing substring",
+			status:     200,
+			a:          ResponseAssertions{BodyContains: []string{"Dashboard"}},
+			wantReason: `assertion failed: body does not contain "Dashboard"`,
+		},
+		{
+			name:       "regex mismatch",
+			status:     200,
+			a:          ResponseAssertions{BodyRegex: []string{`version \d+`}},
+			wantReason: `assertion failed: body does not match /version \d+/`,
+		},
+		{
+			name:       "header mismatch",
+			status:     200,
+			a:          ResponseAssertions{Headers: map[string]string{"Content-Type": "application/json"}},
+			wantReason: `assertion failed: header Content-Type = "text/html; charset=utf-8", want "application/json"`,
+		},
+		{
+			name:       "header regex mismatch",
+			status:     200,
+			a:          ResponseAssertions{HeaderRegex: map[string]string{"Server": `^envoy`}},
+			wantReason: `assertion failed: header Server = "nginx/1.25" does not match /^envoy/`,
+		},
+		{
+			name:       "body too large",
+			status:     200,
+			a:          ResponseAssertions{MaxBodyBytes: 10},
+			wantReason: "assertion failed: body exceeds 10 bytes",
+		},
+		{
+			name:   "multiple failures joined",
+			status: 500,
+			a: ResponseAssertions{
+				Status:       []string{"2xx"},
+				BodyContains: []string{"Dashboard"},
+			},
+			wantReason: `assertion failed: status 500 not in 2xx; body does not contain "Dashboard"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := tt.a.compile()
+			if err != nil {
+				t.Fatalf("compile() error: %v", err)
+			}
+			if got := c.Check(tt.status, header, body); got != tt.wantReason {
+				t.Errorf("Check() = %q, want %q", got, tt.wantReason)
+			}
+		})
+	}
+}
+
+func TestResponseChecker_needsBody(t *testing.T) {
+	statusOnly, _ := ResponseAssertions{Status: []string{"200"}}.compile()
+	if statusOnly.needsBody() {
+		t.Error("status-only assertions should not need the body")
+	}
+	withBody, _ := ResponseAssertions{BodyContains: []string{"ok"}}.compile()
+	if !withBody.needsBody() {
+		t.Error("body-contains assertions should need the body")
+	}
+	if withBody.bodyLimit() != defaultBodyLimit {
+		t.Errorf("bodyLimit() = %d, want %d without max-body-bytes", withBody.bodyLimit(), defaultBodyLimit)
+	}
+	limited, _ := ResponseAssertions{MaxBodyBytes: 100}.compile()
+	if limited.bodyLimit() != 101 {
+		t.Errorf("bodyLimit() = %d, want 101", limited.bodyLimit())
+	}
+}
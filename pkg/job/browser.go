@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
+	"sync/atomic"
 	"time"
 
 	"github.com/chromedp/cdproto/network"
@@ -31,6 +32,8 @@ type BrowserJob struct {
 
 func (j *BrowserJob) Name() string            { return j.config.Name }
 func (j *BrowserJob) Interval() time.Duration { return time.Duration(j.config.Interval) * time.Second }
+func (j *BrowserJob) URL() string             { return j.config.URL }
+func (j *BrowserJob) Tags() map[string]string { return j.tags }
 
 // performanceTiming mirrors the fields we need from window.performance.timing.
 type performanceTiming struct {
@@ -83,9 +86,20 @@ func (j *BrowserJob) Run(ctx context.Context) ([]Metric, []Event, error) {
 		chromedp.WaitReady("body"),
 	)
 
+	// Record the status of the page itself, ignoring its subresources and
+	// any frames it loads.
+	var status atomic.Int64
+	chromedp.ListenTarget(taskCtx, func(ev interface{}) {
+		if r, ok := ev.(*network.EventResponseReceived); ok && r.Type == network.ResourceTypeDocument {
+			status.CompareAndSwap(0, r.Response.Status)
+		}
+	})
+
+	start := time.Now()
 	if err := chromedp.Run(taskCtx, actions...); err != nil {
 		return nil, nil, fmt.Errorf("browser navigation: %w", err)
 	}
+	loaded := time.Since(start)
 
 	// Extract performance timing
 	var pt performanceTiming
@@ -120,8 +134,14 @@ func (j *BrowserJob) Run(ctx context.Context) ([]Metric, []Event, error) {
 		mk("time_to_first_byte_milliseconds", pt.ResponseStart-pt.DomainLookupStart),
 	}
 
-	// Use 200 as status since browser loaded the page successfully
-	events := []Event{MakeEvent(j.config.Name, 200, j.tags)}
+	e := MakeEvent(j.config.Name, int(status.Load()), j.tags)
+	if e.ServerStatus == 0 {
+		// The page loaded, but without an HTTP response, as with file: and
+		// data: URLs.
+		e.Severity = SeverityOK
+	}
+	e.Duration = loaded
+	events := []Event{e}
 
 	return metrics, events, nil
 }
@@ -0,0 +1,277 @@
+package job
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+	"gopkg.in/yaml.v3"
+)
+
+// DNSJobConfig holds the configuration for a DNS resolution job.
+type DNSJobConfig struct {
+	Name       string            `yaml:"name"`
+	Query      string            `yaml:"query"`
+	Nameserver string            `yaml:"nameserver"`
+	Protocol   string            `yaml:"protocol,omitempty"`
+	RecordType string            `yaml:"record-type,omitempty"`
+	Expect     []string          `yaml:"expect,omitempty"`
+	Interval   uint16            `yaml:"interval"`
+	Timeout    string            `yaml:"timeout,omitempty"`
+	Tags       map[string]string `yaml:"tags,omitempty"`
+}
+
+// DNSJob queries a specific nameserver and checks the answer section.
+type DNSJob struct {
+	config  DNSJobConfig
+	qtype   uint16
+	server  string
+	client  *http.Client
+	timeout time.Duration
+	tags    map[string]string
+}
+
+func (j *DNSJob) Name() string            { return j.config.Name }
+func (j *DNSJob) Interval() time.Duration { return time.Duration(j.config.Interval) * time.Second }
+func (j *DNSJob) Tags() map[string]string { return j.tags }
+
+// URL returns a URL-like description of the query, used as the metric URL.
+func (j *DNSJob) URL() string {
+	if j.config.Protocol == "https" {
+		return j.server
+	}
+	return fmt.Sprintf("dns+%s://%s/%s?type=%s", j.config.Protocol, j.server, j.config.Query, dns.TypeToString[j.qtype])
+}
+
+// Run sends the query and returns latency and response code metrics. A failed
+// exchange, a non-NOERROR response, or a mismatched answer produces a failure event.
+func (j *DNSJob) Run(ctx context.Context) ([]Metric, []Event, error) {
+	ctx, cancel := context.WithTimeout(ctx, j.timeout)
+	defer cancel()
+
+	msg := new(dns.Msg)
+	msg.SetQuestion(dns.Fqdn(j.config.Query), j.qtype)
+
+	start := time.Now()
+	resp, err := j.exchange(ctx, msg)
+	if err != nil {
+		return nil, []Event{MakeFailureEvent(j.config.Name, 0, fmt.Sprintf("query: %v", err), j.tags)}, nil
+	}
+	elapsed := time.Since(start)
+
+	mk := func(timing string, value float64) Metric {
+		return MakeMetric(timing, value, j.config.Name, j.URL(), j.tags)
+	}
+	metrics := []Metric{
+		mk("dns_query_duration_milliseconds", elapsed.Seconds()*1000),
+		mk("dns_response_code", float64(resp.Rcode)),
+		mk("dns_answer_count", float64(len(resp.Answer))),
+	}
+
+	if resp.Rcode != dns.RcodeSuccess {
+		reason := fmt.Sprintf("rcode: %s", dns.RcodeToString[resp.Rcode])
+		return metrics, []Event{MakeFailureEvent(j.config.Name, 0, reason, j.tags)}, nil
+	}
+
+	answers := formatAnswers(resp.Answer, j.qtype)
+	if missing := missingAnswers(j.config.Expect, answers); len(missing) > 0 {
+		reason := fmt.Sprintf("answer mismatch: missing %s (got %s)",
+			strings.Join(missing, ", "), strings.Join(answers, ", "))
+		return metrics, []Event{MakeFailureEvent(j.config.Name, 0, reason, j.tags)}, nil
+	}
+
+	answered := fmt.Sprintf("no %s records", dns.TypeToString[j.qtype])
+	if len(answers) > 0 {
+		answered = strings.Join(answers, ", ")
+	}
+	message := fmt.Sprintf("%v (%v) answered %v", j.config.Name, j.URL(), answered)
+	return metrics, []Event{MakeSuccessEvent(j.config.Name, 0, message, j.tags)}, nil
+}
+
+// exchange sends msg over the job's protocol. A truncated UDP answer is
+// retried over TCP, as a resolver would, so that large record sets are
+// checked in full.
+func (j *DNSJob) exchange(ctx context.Context, msg *dns.Msg) (*dns.Msg, error) {
+	if j.config.Protocol == "https" {
+		return j.exchangeHTTPS(ctx, msg)
+	}
+	network := j.config.Protocol
+	if network == "tls" {
+		network = "tcp-tls"
+	}
+	c := &dns.Client{Net: network, Timeout: j.timeout}
+	resp, _, err := c.ExchangeContext(ctx, msg, j.server)
+	if err != nil || network != "udp" || !resp.Truncated {
+		return resp, err
+	}
+	c.Net = "tcp"
+	resp, _, err = c.ExchangeContext(ctx, msg, j.server)
+	if err != nil {
+		return nil, fmt.Errorf("retrying truncated answer over tcp: %w", err)
+	}
+	return resp, nil
+}
+
+// exchangeHTTPS performs a DNS-over-HTTPS query as described in RFC 8484.
+func (j *DNSJob) exchangeHTTPS(ctx context.Context, msg *dns.Msg) (*dns.Msg, error) {
+	msg.Id = 0
+	packed, err := msg.Pack()
+	if err != nil {
+		return nil, fmt.Errorf("packing query: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, j.server, bytes.NewReader(packed))
+	if err != nil {
+		return nil, fmt.Errorf("creating request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/dns-message")
+	req.Header.Set("Accept", "application/dns-message")
+
+	resp, err := j.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("executing request: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("DoH server returned status %d", resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, dns.MaxMsgSize))
+	if err != nil {
+		return nil, fmt.Errorf("reading response body: %w", err)
+	}
+	answer := new(dns.Msg)
+	if err := answer.Unpack(body); err != nil {
+		return nil, fmt.Errorf("unpacking response: %w", err)
+	}
+	return answer, nil
+}
+
+// formatAnswers renders the answer records of the queried type as comparable strings.
+func formatAnswers(rrs []dns.RR, qtype uint16) []string {
+	var out []string
+	for _, rr := range rrs {
+		if rr.Header().Rrtype != qtype {
+			continue
+		}
+		switch r := rr.(type) {
+		case *dns.A:
+			out = append(out, r.A.String())
+		case *dns.AAAA:
+			out = append(out, r.AAAA.String())
+		case *dns.CNAME:
+			out = append(out, normalizeDNSName(r.Target))
+		case *dns.MX:
+			out = append(out, fmt.Sprintf("%d %s", r.Preference, normalizeDNSName(r.Mx)))
+		case *dns.TXT:
+			out = append(out, strings.Join(r.Txt, ""))
+		case *dns.SRV:
+			out = append(out, fmt.Sprintf("%d %d %d %s", r.Priority, r.Weight, r.Port, normalizeDNSName(r.Target)))
+		}
+	}
+	return out
+}
+
+// missingAnswers returns the expected values that are absent from answers.
+func missingAnswers(expect, answers []string) []string {
+	var missing []string
+	for _, want := range expect {
+		if !slices.Contains(answers, normalizeDNSName(want)) && !slices.Contains(answers, want) {
+			missing = append(missing, want)
+		}
+	}
+	return missing
+}
+
+// normalizeDNSName lowercases a hostname and strips the trailing root dot.
+func normalizeDNSName(name string) string {
+	return strings.TrimSuffix(strings.ToLower(name), ".")
+}
+
+// DNSFactory creates DNSJob instances.
+type DNSFactory struct {
+	// Client is used for DNS-over-HTTPS queries.
+	Client *http.Client
+}
+
+func (f *DNSFactory) Type() string { return "dns" }
+
+func (f *DNSFactory) Create(cfg yaml.Node, opts JobOptions) (Job, error) {
+	var c DNSJobConfig
+	if err := cfg.Decode(&c); err != nil {
+		return nil, fmt.Errorf("decoding dns job config: %w", err)
+	}
+	if c.Query == "" {
+		return nil, fmt.Errorf("dns job %q: query is required", c.Name)
+	}
+	if c.Nameserver == "" {
+		return nil, fmt.Errorf("dns job %q: nameserver is required", c.Name)
+	}
+
+	if c.RecordType == "" {
+		c.RecordType = "A"
+	}
+	c.RecordType = strings.ToUpper(c.RecordType)
+	qtype, ok := dns.StringToType[c.RecordType]
+	if !ok || !slices.Contains([]string{"A", "AAAA", "CNAME", "MX", "TXT", "SRV"}, c.RecordType) {
+		return nil, fmt.Errorf("dns job %q: unsupported record type %q", c.Name, c.RecordType)
+	}
+
+	if c.Protocol == "" {
+		c.Protocol = "udp"
+	}
+	server := c.Nameserver
+	switch c.Protocol {
+	case "udp", "tcp":
+		server = withDefaultPort(server, "53")
+	case "tls":
+		server = withDefaultPort(server, "853")
+	case "https":
+		if !strings.HasPrefix(server, "https://") {
+			return nil, fmt.Errorf("dns job %q: nameserver must be an https:// URL for protocol https", c.Name)
+		}
+	default:
+		return nil, fmt.Errorf("dns job %q: unsupported protocol %q", c.Name, c.Protocol)
+	}
+
+	timeout := opts.RequestTimeout
+	if c.Timeout != "" {
+		d, err := time.ParseDuration(c.Timeout)
+		if err != nil {
+			return nil, fmt.Errorf("dns job %q: parsing timeout %q: %w", c.Name, c.Timeout, err)
+		}
+		timeout = d
+	}
+	if timeout == 0 {
+		timeout = 15 * time.Second
+	}
+
+	client := f.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	return &DNSJob{
+		config:  c,
+		qtype:   qtype,
+		server:  server,
+		client:  client,
+		timeout: timeout,
+		tags:    MergeTags(c.Tags, opts.GlobalTags),
+	}, nil
+}
+
+// withDefaultPort appends port to host if it doesn't already carry one.
+func withDefaultPort(host, port string) string {
+	if _, _, err := net.SplitHostPort(host); err == nil {
+		return host
+	}
+	return net.JoinHostPort(strings.Trim(host, "[]"), port)
+}
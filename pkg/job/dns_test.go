@@ -0,0 +1,414 @@
+package job
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"gopkg.in/yaml.v3"
+)
+
+func TestDNSFactory_Type(t *testing.T) {
+	f := &DNSFactory{}
+	if got := f.Type(); got != "dns" {
+		t.Errorf("Type() = %q, want %q", got, "dns")
+	}
+}
+
+func TestDNSFactory_Create(t *testing.T) {
+	tests := []struct {
+		name       string
+		input      string
+		wantErr    string
+		wantServer string
+		wantQtype  uint16
+	}{
+		{
+			name: "defaults to udp A query on port 53",
+			input: `
+name: resolver
+query: example.com
+nameserver: 192.0.2.53
+`,
+			wantServer: "192.0.2.53:53",
+			wantQtype:  dns.TypeA,
+		},
+		{
+			name: "dot defaults to port 853",
+			input: `
+name: dot
+query: example.com
+nameserver: dns.example.net
+protocol: tls
+record-type: aaaa
+`,
+			wantServer: "dns.example.net:853",
+			wantQtype:  dns.TypeAAAA,
+		},
+		{
+			name: "explicit port preserved",
+			input: `
+name: tcp
+query: example.com
+nameserver: "[2001:db8::53]:5353"
+protocol: tcp
+record-type: MX
+`,
+			wantServer: "[2001:db8::53]:5353",
+			wantQtype:  dns.TypeMX,
+		},
+		{
+			name: "doh url",
+			input: `
+name: doh
+query: example.com
+nameserver: https://dns.example.net/dns-query
+protocol: https
+record-type: TXT
+`,
+			wantServer: "https://dns.example.net/dns-query",
+			wantQtype:  dns.TypeTXT,
+		},
+		{
+			name: "doh requires https url",
+			input: `
+name: doh
+query: example.com
+nameserver: dns.example.net
+protocol: https
+`,
+			wantErr: "https:// URL",
+		},
+		{
+			name: "missing query",
+			input: `
+name: noquery
+nameserver: 192.0.2.53
+`,
+			wantErr: "query is required",
+		},
+		{
+			name: "missing nameserver",
+			input: `
+name: nons
+query: example.com
+`,
+			wantErr: "nameserver is required",
+		},
+		{
+			name: "unsupported record type",
+			input: `
+name: ptr
+query: example.com
+nameserver: 192.0.2.53
+record-type: PTR
+`,
+			wantErr: `unsupported record type "PTR"`,
+		},
+		{
+			name: "unsupported protocol",
+			input: `
+name: quic
+query: example.com
+nameserver: 192.0.2.53
+protocol: quic
+`,
+			wantErr: `unsupported protocol "quic"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var node yaml.Node
+			if err := yaml.Unmarshal([]byte(tt.input), &node); err != nil {
+				t.Fatal(err)
+			}
+
+			f := &DNSFactory{}
+			j, err := f.Create(*node.Content[0], JobOptions{})
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			dj := j.(*DNSJob)
+			if dj.server != tt.wantServer {
+				t.Errorf("server = %q, want %q", dj.server, tt.wantServer)
+			}
+			if dj.qtype != tt.wantQtype {
+				t.Errorf("qtype = %d, want %d", dj.qtype, tt.wantQtype)
+			}
+		})
+	}
+}
+
+func TestFormatAnswers(t *testing.T) {
+	rrs := []dns.RR{
+		mustRR(t, "example.com. 300 IN A 192.0.2.1"),
+		mustRR(t, "example.com. 300 IN AAAA 2001:db8::1"),
+		mustRR(t, "www.example.com. 300 IN CNAME Example.COM."),
+		mustRR(t, "example.com. 300 IN MX 10 mail.example.com."),
+		mustRR(t, `example.com. 300 IN TXT "v=spf1 " "-all"`),
+		mustRR(t, "_sip._tcp.example.com. 300 IN SRV 10 60 5060 sip.example.com."),
+	}
+
+	tests := []struct {
+		qtype uint16
+		want  string
+	}{
+		{dns.TypeA, "192.0.2.1"},
+		{dns.TypeAAAA, "2001:db8::1"},
+		{dns.TypeCNAME, "example.com"},
+		{dns.TypeMX, "10 mail.example.com"},
+		{dns.TypeTXT, "v=spf1 -all"},
+		{dns.TypeSRV, "10 60 5060 sip.example.com"},
+	}
+
+	for _, tt := range tests {
+		t.Run(dns.TypeToString[tt.qtype], func(t *testing.T) {
+			got := formatAnswers(rrs, tt.qtype)
+			if len(got) != 1 || got[0] != tt.want {
+				t.Errorf("formatAnswers() = %q, want [%q]", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMissingAnswers(t *testing.T) {
+	answers := []string{"192.0.2.1", "mail.example.com"}
+
+	if got := missingAnswers([]string{"192.0.2.1", "Mail.Example.com."}, answers); len(got) != 0 {
+		t.Errorf("expected no missing answers, got %q", got)
+	}
+	got := missingAnswers([]string{"192.0.2.1", "192.0.2.2"}, answers)
+	if len(got) != 1 || got[0] != "192.0.2.2" {
+		t.Errorf("missingAnswers() = %q, want [192.0.2.2]", got)
+	}
+}
+
+func mustRR(t *testing.T, s string) dns.RR {
+	t.Helper()
+	rr, err := dns.NewRR(s)
+	if err != nil {
+		t.Fatalf("parsing RR %q: %v", s, err)
+	}
+	return rr
+}
+
+// testDNSHandler answers A queries for example.com and NXDOMAIN for anything else.
+func testDNSHandler(t *testing.T) dns.HandlerFunc {
+	return func(w dns.ResponseWriter, r *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetReply(r)
+		if r.Question[0].Name == "example.com." {
+			m.Answer = append(m.Answer, mustRR(t, "example.com. 60 IN A 192.0.2.1"))
+		} else {
+			m.Rcode = dns.RcodeNameError
+		}
+		w.WriteMsg(m)
+	}
+}
+
+func startTestDNSServer(t *testing.T) string {
+	t.Helper()
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	started := make(chan struct{})
+	srv := &dns.Server{PacketConn: pc, Handler: testDNSHandler(t), NotifyStartedFunc: func() { close(started) }}
+	go srv.ActivateAndServe()
+	t.Cleanup(func() { srv.Shutdown() })
+	<-started
+	return pc.LocalAddr().String()
+}
+
+func TestDNSJob_Run(t *testing.T) {
+	server := startTestDNSServer(t)
+
+	tests := []struct {
+		name       string
+		query      string
+		expect     []string
+		wantStatus int
+		wantReason string
+	}{
+		{
+			name:   "answer matches",
+			query:  "example.com",
+			expect: []string{"192.0.2.1"},
+		},
+		{
+			name:  "no expectations",
+			query: "example.com",
+		},
+		{
+			name:       "answer mismatch",
+			query:      "example.com",
+			expect:     []string{"192.0.2.99"},
+			wantReason: "answer mismatch: missing 192.0.2.99 (got 192.0.2.1)",
+		},
+		{
+			name:       "nxdomain",
+			query:      "missing.example.com",
+			wantReason: "rcode: NXDOMAIN",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			j := &DNSJob{
+				config: DNSJobConfig{
+					Name:     "dns-test",
+					Query:    tt.query,
+					Protocol: "udp",
+					Expect:   tt.expect,
+				},
+				qtype:   dns.TypeA,
+				server:  server,
+				timeout: 2 * time.Second,
+				tags:    map[string]string{},
+			}
+			metrics, events, err := j.Run(context.Background())
+			if err != nil {
+				t.Fatalf("Run() error: %v", err)
+			}
+			if len(metrics) != 3 {
+				t.Errorf("got %d metrics, want 3", len(metrics))
+			}
+			if len(events) != 1 {
+				t.Fatalf("got %d events, want 1", len(events))
+			}
+			if events[0].ServerStatus != tt.wantStatus {
+				t.Errorf("ServerStatus = %d, want %d", events[0].ServerStatus, tt.wantStatus)
+			}
+			if events[0].Reason != tt.wantReason {
+				t.Errorf("Reason = %q, want %q", events[0].Reason, tt.wantReason)
+			}
+			if got, want := events[0].Failed(), tt.wantReason != ""; got != want {
+				t.Errorf("Failed() = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestDNSJob_Run_Truncated(t *testing.T) {
+	// Over UDP the server only says the answer didn't fit; the records are
+	// only available over TCP on the same port.
+	handler := dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetReply(r)
+		if _, udp := w.RemoteAddr().(*net.UDPAddr); udp {
+			m.Truncated = true
+		} else {
+			m.Answer = append(m.Answer,
+				mustRR(t, "example.com. 60 IN A 192.0.2.1"),
+				mustRR(t, "example.com. 60 IN A 192.0.2.2"))
+		}
+		w.WriteMsg(m)
+	})
+
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln, err := net.Listen("tcp", pc.LocalAddr().String())
+	if err != nil {
+		pc.Close()
+		t.Skipf("can't listen on tcp %s: %v", pc.LocalAddr(), err)
+	}
+	for _, srv := range []*dns.Server{{PacketConn: pc, Handler: handler}, {Listener: ln, Handler: handler}} {
+		started := make(chan struct{})
+		srv.NotifyStartedFunc = func() { close(started) }
+		go srv.ActivateAndServe()
+		t.Cleanup(func() { srv.Shutdown() })
+		<-started
+	}
+
+	j := &DNSJob{
+		config: DNSJobConfig{
+			Name:     "dns-test",
+			Query:    "example.com",
+			Protocol: "udp",
+			Expect:   []string{"192.0.2.1", "192.0.2.2"},
+		},
+		qtype:   dns.TypeA,
+		server:  pc.LocalAddr().String(),
+		timeout: 2 * time.Second,
+		tags:    map[string]string{},
+	}
+	_, events, err := j.Run(context.Background())
+	if err != nil {
+		t.Fatalf("Run() error: %v", err)
+	}
+	if len(events) != 1 || events[0].Failed() {
+		t.Fatalf("expected one healthy event, got %+v", events)
+	}
+	if want := "answered 192.0.2.1, 192.0.2.2"; !strings.HasSuffix(events[0].Message, want) {
+		t.Errorf("Message = %q, want suffix %q", events[0].Message, want)
+	}
+}
+
+func TestDNSJob_Run_DoH(t *testing.T) {
+	handler := testDNSHandler(t)
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Type") != "application/dns-message" {
+			http.Error(w, "bad content type", http.StatusUnsupportedMediaType)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		req := new(dns.Msg)
+		if err := req.Unpack(body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		rw := &dohResponseWriter{}
+		handler(rw, req)
+		packed, _ := rw.msg.Pack()
+		w.Header().Set("Content-Type", "application/dns-message")
+		w.Write(packed)
+	}))
+	defer srv.Close()
+
+	j := &DNSJob{
+		config: DNSJobConfig{
+			Name:     "doh-test",
+			Query:    "example.com",
+			Protocol: "https",
+			Expect:   []string{"192.0.2.1"},
+		},
+		qtype:   dns.TypeA,
+		server:  srv.URL,
+		client:  srv.Client(),
+		timeout: 2 * time.Second,
+		tags:    map[string]string{},
+	}
+	_, events, err := j.Run(context.Background())
+	if err != nil {
+		t.Fatalf("Run() error: %v", err)
+	}
+	if len(events) != 1 || events[0].Failed() {
+		t.Fatalf("expected one healthy event, got %+v", events)
+	}
+}
+
+// dohResponseWriter captures the reply written by a dns.Handler.
+type dohResponseWriter struct {
+	dns.ResponseWriter
+	msg *dns.Msg
+}
+
+func (w *dohResponseWriter) WriteMsg(m *dns.Msg) error {
+	w.msg = m
+	return nil
+}
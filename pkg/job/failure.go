@@ -0,0 +1,150 @@
+package job
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"syscall"
+	"time"
+)
+
+// Failure classes prefix the Reason of events reported for runs that errored.
+const (
+	FailureDNS     = "dns"
+	FailureConnect = "connect"
+	FailureTLS     = "tls"
+	FailureTimeout = "timeout"
+	FailureHTTP    = "http"
+)
+
+// Target is implemented by jobs that probe a single endpoint. The job manager
+// uses it to label the failure events and probe_success metrics it
+// generates on the job's behalf.
+type Target interface {
+	URL() string
+	Tags() map[string]string
+}
+
+// ClassifyError maps an error returned by Job.Run to one of the Failure
+// classes. Errors that don't fit a more specific class are reported as
+// FailureHTTP, since they come from the request or response itself.
+func ClassifyError(err error) string {
+	var (
+		dnsErr     *net.DNSError
+		verifyErr  *tls.CertificateVerificationError
+		recordErr  tls.RecordHeaderError
+		alertErr   tls.AlertError
+		unknownCA  x509.UnknownAuthorityError
+		hostErr    x509.HostnameError
+		invalidErr x509.CertificateInvalidError
+		opErr      *net.OpError
+		netErr     net.Error
+	)
+	switch {
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, os.ErrDeadlineExceeded):
+		return FailureTimeout
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return FailureTimeout
+	case errors.As(err, &dnsErr):
+		return FailureDNS
+	case errors.As(err, &verifyErr), errors.As(err, &recordErr), errors.As(err, &alertErr),
+		errors.As(err, &unknownCA), errors.As(err, &hostErr), errors.As(err, &invalidErr):
+		return FailureTLS
+	case errors.Is(err, syscall.ECONNREFUSED), errors.Is(err, syscall.ECONNRESET),
+		errors.Is(err, syscall.EHOSTUNREACH), errors.Is(err, syscall.ENETUNREACH):
+		return FailureConnect
+	case errors.As(err, &opErr) && opErr.Op == "dial":
+		return FailureConnect
+	}
+	return FailureHTTP
+}
+
+// failureEvent builds the event reported when j.Run returns err.
+func failureEvent(j Job, err error) Event {
+	return MakeFailureEvent(j.Name(), 0, fmt.Sprintf("%s: %v", ClassifyError(err), err), targetTags(j))
+}
+
+// completeEvents fills in the URL, duration and message of events that the
+// job left without them. elapsed is how long the run took.
+func completeEvents(j Job, events []Event, elapsed time.Duration) {
+	var url string
+	if t, ok := j.(Target); ok {
+		url = t.URL()
+	}
+	for i := range events {
+		e := &events[i]
+		if e.URL == "" {
+			e.URL = url
+		}
+		if e.Duration == 0 {
+			e.Duration = elapsed
+		}
+		if e.Message == "" {
+			e.Message = describeEvent(*e)
+		}
+	}
+}
+
+// describeEvent builds the human-readable Message for e.
+func describeEvent(e Event) string {
+	subject := e.Name
+	if e.URL != "" {
+		subject = fmt.Sprintf("%v (%v)", e.Name, e.URL)
+	}
+	took := e.Duration.Round(time.Millisecond)
+	switch {
+	case e.Level() == SeverityWarning && e.Reason != "":
+		return fmt.Sprintf("%v succeeded with a warning in %v: %v", subject, took, e.Reason)
+	case e.Reason != "":
+		return fmt.Sprintf("%v failed after %v: %v", subject, took, e.Reason)
+	case e.Failed():
+		return fmt.Sprintf("%v returned status %v after %v", subject, e.ServerStatus, took)
+	}
+	return fmt.Sprintf("%v succeeded in %v", subject, took)
+}
+
+// probeSuccess builds the probe_success metric for a run: 1 if every event
+// was healthy, 0 otherwise.
+func probeSuccess(j Job, events []Event) Metric {
+	value := 1.0
+	for _, e := range events {
+		if e.Failed() {
+			value = 0
+			break
+		}
+	}
+	var url string
+	if t, ok := j.(Target); ok {
+		url = t.URL()
+	}
+	return MakeMetric("probe_success", value, j.Name(), url, targetTags(j))
+}
+
+// probeStatusCode builds the probe_status_code metric for a run: the status
+// of the first failed event, or of the last event if none failed.
+func probeStatusCode(j Job, events []Event) Metric {
+	status := events[len(events)-1].ServerStatus
+	for _, e := range events {
+		if e.Failed() {
+			status = e.ServerStatus
+			break
+		}
+	}
+	var url string
+	if t, ok := j.(Target); ok {
+		url = t.URL()
+	}
+	return MakeMetric("probe_status_code", float64(status), j.Name(), url, targetTags(j))
+}
+
+// targetTags returns the job's tags if it implements Target.
+func targetTags(j Job) map[string]string {
+	if t, ok := j.(Target); ok {
+		return t.Tags()
+	}
+	return nil
+}
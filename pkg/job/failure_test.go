@@ -0,0 +1,177 @@
+package job
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestClassifyError(t *testing.T) {
+	// A listener that is closed immediately gives a port that refuses connections.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closedAddr := ln.Addr().String()
+	ln.Close()
+
+	tlsSrv := httptest.NewTLSServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	defer tlsSrv.Close()
+
+	slowSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer slowSrv.Close()
+
+	get := func(client *http.Client, url string) error {
+		resp, err := client.Get(url)
+		if err == nil {
+			resp.Body.Close()
+		}
+		return err
+	}
+
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{
+			name: "dns",
+			err:  fmt.Errorf("executing request: %w", &net.DNSError{Err: "no such host", Name: "nope.invalid", IsNotFound: true}),
+			want: FailureDNS,
+		},
+		{
+			name: "connection refused",
+			err:  get(&http.Client{}, "http://"+closedAddr),
+			want: FailureConnect,
+		},
+		{
+			name: "untrusted certificate",
+			err:  get(&http.Client{}, tlsSrv.URL),
+			want: FailureTLS,
+		},
+		{
+			name: "client timeout",
+			err:  get(&http.Client{Timeout: 50 * time.Millisecond}, slowSrv.URL),
+			want: FailureTimeout,
+		},
+		{
+			name: "context deadline",
+			err:  fmt.Errorf("step 0 (login): %w", context.DeadlineExceeded),
+			want: FailureTimeout,
+		},
+		{
+			name: "other",
+			err:  errors.New("reading response body: unexpected EOF"),
+			want: FailureHTTP,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.err == nil {
+				t.Fatal("expected a non-nil error to classify")
+			}
+			if got := ClassifyError(tt.err); got != tt.want {
+				t.Errorf("ClassifyError(%v) = %q, want %q", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEvent_Failed(t *testing.T) {
+	tests := []struct {
+		event Event
+		want  bool
+	}{
+		{event: Event{ServerStatus: 200}, want: false},
+		{event: Event{ServerStatus: 302}, want: false},
+		{event: Event{ServerStatus: 404}, want: true},
+		{event: Event{ServerStatus: 0}, want: true},
+		{event: Event{ServerStatus: 200, Reason: "assertion failed"}, want: true},
+		{event: Event{ServerStatus: 0, Severity: SeverityOK}, want: false},
+		{event: Event{ServerStatus: 200, Severity: SeverityWarning}, want: true},
+	}
+	for _, tt := range tests {
+		if got := tt.event.Failed(); got != tt.want {
+			t.Errorf("%+v.Failed() = %v, want %v", tt.event, got, tt.want)
+		}
+	}
+}
+
+func TestEvent_Level(t *testing.T) {
+	tests := []struct {
+		event Event
+		want  Severity
+	}{
+		{event: Event{ServerStatus: 200}, want: SeverityOK},
+		{event: Event{ServerStatus: 404}, want: SeverityError},
+		{event: Event{ServerStatus: 503}, want: SeverityCritical},
+		{event: Event{ServerStatus: 0}, want: SeverityCritical},
+		{event: Event{ServerStatus: 200, Reason: "assertion failed"}, want: SeverityCritical},
+		{event: Event{ServerStatus: 503, Severity: SeverityWarning}, want: SeverityWarning},
+		{event: MakeEvent("web", 404, nil), want: SeverityError},
+		{event: MakeFailureEvent("web", 200, "assertion failed", nil), want: SeverityCritical},
+	}
+	for _, tt := range tests {
+		if got := tt.event.Level(); got != tt.want {
+			t.Errorf("%+v.Level() = %v, want %v", tt.event, got, tt.want)
+		}
+	}
+}
+
+func TestCompleteEvents(t *testing.T) {
+	j := &targetJob{mockJob: mockJob{name: "db"}}
+	events := []Event{
+		MakeEvent("db", 200, nil),
+		MakeFailureEvent("db", 0, "connect: connection refused", nil),
+		MakeEvent("db", 503, nil),
+		{Name: "db", Severity: SeverityWarning, Reason: "certificate expires in 3 days", URL: "tls://db:5432", Duration: time.Second},
+		{Name: "db", Severity: SeverityOK, Message: "custom"},
+	}
+	completeEvents(j, events, 1234567*time.Microsecond)
+
+	want := []string{
+		"db (tcp://db:5432) succeeded in 1.235s",
+		"db (tcp://db:5432) failed after 1.235s: connect: connection refused",
+		"db (tcp://db:5432) returned status 503 after 1.235s",
+		"db (tls://db:5432) succeeded with a warning in 1s: certificate expires in 3 days",
+		"custom",
+	}
+	for i, e := range events {
+		if e.Message != want[i] {
+			t.Errorf("event %d Message = %q, want %q", i, e.Message, want[i])
+		}
+		if e.Summary() != want[i] {
+			t.Errorf("event %d Summary() = %q, want %q", i, e.Summary(), want[i])
+		}
+	}
+	if events[0].URL != "tcp://db:5432" || events[0].Duration != 1234567*time.Microsecond {
+		t.Errorf("event 0 URL = %q, Duration = %v", events[0].URL, events[0].Duration)
+	}
+	if events[3].Duration != time.Second {
+		t.Errorf("event 3 Duration = %v, want the event's own 1s", events[3].Duration)
+	}
+}
+
+func TestEvent_Summary(t *testing.T) {
+	tests := []struct {
+		event Event
+		want  string
+	}{
+		{event: Event{Name: "web", ServerStatus: 200}, want: "web returned status 200"},
+		{event: Event{Name: "web", Reason: "timeout: deadline"}, want: "web failed: timeout: deadline"},
+		{event: Event{Name: "web", Message: "web is fine"}, want: "web is fine"},
+	}
+	for _, tt := range tests {
+		if got := tt.event.Summary(); got != tt.want {
+			t.Errorf("%+v.Summary() = %q, want %q", tt.event, got, tt.want)
+		}
+	}
+}
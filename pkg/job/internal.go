@@ -6,24 +6,33 @@ import (
 	"time"
 )
 
-// InternalMetricsJob collects Go runtime metrics.
+// InternalMetricsSource is implemented by components that report metrics
+// about crabby itself, such as the job manager's missed ticks.
+type InternalMetricsSource interface {
+	InternalMetrics() []Metric
+}
+
+// InternalMetricsJob collects Go runtime metrics and metrics from any
+// registered InternalMetricsSource.
 type InternalMetricsJob struct {
 	interval time.Duration
+	sources  []InternalMetricsSource
 }
 
 // NewInternalMetricsJob creates an internal metrics job.
-func NewInternalMetricsJob(intervalSec uint) *InternalMetricsJob {
+func NewInternalMetricsJob(intervalSec uint, sources ...InternalMetricsSource) *InternalMetricsJob {
 	d := 15 * time.Second
 	if intervalSec > 0 {
 		d = time.Duration(intervalSec) * time.Second
 	}
-	return &InternalMetricsJob{interval: d}
+	return &InternalMetricsJob{interval: d, sources: sources}
 }
 
 func (j *InternalMetricsJob) Name() string            { return "internal_metrics" }
 func (j *InternalMetricsJob) Interval() time.Duration { return j.interval }
 
-// Run collects runtime memory and goroutine stats.
+// Run collects runtime memory and goroutine stats, followed by the metrics
+// of each source.
 func (j *InternalMetricsJob) Run(_ context.Context) ([]Metric, []Event, error) {
 	var memstats runtime.MemStats
 	runtime.ReadMemStats(&memstats)
@@ -43,5 +52,8 @@ func (j *InternalMetricsJob) Run(_ context.Context) ([]Metric, []Event, error) {
 		mk("heap.in_use", float64(memstats.HeapInuse)),
 		mk("num_goroutines", float64(runtime.NumGoroutine())),
 	}
+	for _, src := range j.sources {
+		metrics = append(metrics, src.InternalMetrics()...)
+	}
 	return metrics, nil, nil
 }
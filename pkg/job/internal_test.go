@@ -86,3 +86,20 @@ func TestInternalMetricsJobRun(t *testing.T) {
 		})
 	}
 }
+
+// staticSource is an InternalMetricsSource returning fixed metrics.
+type staticSource []Metric
+
+func (s staticSource) InternalMetrics() []Metric { return s }
+
+func TestInternalMetricsJobRun_Sources(t *testing.T) {
+	j := NewInternalMetricsJob(10, staticSource{{Job: "web", Timing: "missed_ticks", Value: 3}})
+	metrics, _, err := j.Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	last := metrics[len(metrics)-1]
+	if last.Timing != "missed_ticks" || last.Job != "web" || last.Value != 3 {
+		t.Errorf("last metric = %+v, want source metric", last)
+	}
+}
@@ -2,8 +2,13 @@ package job
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"log/slog"
+	"maps"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"gopkg.in/yaml.v3"
@@ -26,6 +31,8 @@ type JobOptions struct {
 	GlobalTags     map[string]string
 	RequestTimeout time.Duration
 	UserAgent      string
+	Schedule       ScheduleOptions
+	Alerting       AlertPolicy
 }
 
 // JobFactory creates jobs from YAML configuration.
@@ -43,8 +50,32 @@ type MetricEventSender interface {
 // JobManager manages job registration and scheduling.
 type JobManager struct {
 	factories map[string]JobFactory
-	jobs      []Job
 	sender    MetricEventSender
+
+	mu   sync.Mutex
+	jobs []*managedJob
+	ctx  context.Context // set by Run; nil until jobs are scheduled
+}
+
+// managedJob is a job together with the state needed to reload it.
+type managedJob struct {
+	Job
+	key         string // unique identity used to match jobs across reloads
+	fingerprint string // changes whenever the job's config or options change
+	schedule    Schedule
+	sched       ScheduleOptions
+	missed      atomic.Uint64 // ticks skipped because a run overran
+	alert       *alertState
+	cancel      context.CancelFunc
+	done        chan struct{}
+}
+
+// ReloadResult lists the job keys affected by Reload.
+type ReloadResult struct {
+	Added     []string
+	Removed   []string
+	Changed   []string
+	Unchanged []string
 }
 
 // NewJobManager creates a new JobManager.
@@ -55,63 +86,245 @@ func NewJobManager(sender MetricEventSender) *JobManager {
 	}
 }
 
-// RegisterFactory registers a JobFactory for a given job type.
+// RegisterFactory registers a JobFactory for a given job type. Registering
+// a factory for a type that already has one replaces it.
 func (jm *JobManager) RegisterFactory(f JobFactory) {
+	jm.mu.Lock()
+	defer jm.mu.Unlock()
 	jm.factories[f.Type()] = f
 }
 
 // BuildJobs creates jobs from raw YAML nodes.
 func (jm *JobManager) BuildJobs(nodes []yaml.Node, opts JobOptions) error {
+	jm.mu.Lock()
+	factories := maps.Clone(jm.factories)
+	jm.mu.Unlock()
+	jobs, err := buildJobs(nodes, opts, factories)
+	if err != nil {
+		return err
+	}
+	jm.mu.Lock()
+	defer jm.mu.Unlock()
+	jm.jobs = append(jm.jobs, jobs...)
+	return nil
+}
+
+// buildJobs creates jobs from raw YAML nodes using the given factories.
+func buildJobs(nodes []yaml.Node, opts JobOptions, factories map[string]JobFactory) ([]*managedJob, error) {
+	optsPrint, err := fingerprint(opts)
+	if err != nil {
+		return nil, fmt.Errorf("fingerprinting job options: %w", err)
+	}
+
+	jobs := make([]*managedJob, 0, len(nodes))
+	seen := make(map[string]int)
 	for i, node := range nodes {
 		var header struct {
-			Type string `yaml:"type"`
+			Type              string         `yaml:"type"`
+			Schedule          string         `yaml:"schedule"`
+			Alerting          alertOverrides `yaml:"alerting"`
+			scheduleOverrides `yaml:",inline"`
 		}
 		if err := node.Decode(&header); err != nil {
-			return fmt.Errorf("decoding job %d type: %w", i, err)
+			return nil, fmt.Errorf("decoding job %d type: %w", i, err)
 		}
 		if header.Type == "" {
-			return fmt.Errorf("job %d: type not specified", i)
+			return nil, fmt.Errorf("job %d: type not specified", i)
 		}
-		f, ok := jm.factories[header.Type]
+		sched, err := header.apply(opts.Schedule)
+		if err != nil {
+			return nil, fmt.Errorf("job %d: %w", i, err)
+		}
+		alerting, err := header.Alerting.apply(opts.Alerting)
+		if err != nil {
+			return nil, fmt.Errorf("job %d: %w", i, err)
+		}
+		f, ok := factories[header.Type]
 		if !ok {
-			return fmt.Errorf("job %d: unknown type %q", i, header.Type)
+			return nil, fmt.Errorf("job %d: unknown type %q", i, header.Type)
 		}
 		j, err := f.Create(node, opts)
 		if err != nil {
-			return fmt.Errorf("creating job %d (%s): %w", i, header.Type, err)
+			return nil, fmt.Errorf("creating job %d (%s): %w", i, header.Type, err)
+		}
+
+		// A schedule field takes precedence over the job's own interval.
+		var schedule Schedule
+		switch {
+		case header.Schedule != "":
+			if schedule, err = ParseSchedule(header.Schedule); err != nil {
+				return nil, fmt.Errorf("job %d (%s): %w", i, j.Name(), err)
+			}
+		case j.Interval() > 0:
+			schedule = intervalSchedule(j.Interval())
+		default:
+			return nil, fmt.Errorf("job %d (%s): interval or schedule is required", i, j.Name())
 		}
-		jm.jobs = append(jm.jobs, j)
+
+		var raw any
+		if err := node.Decode(&raw); err != nil {
+			return nil, fmt.Errorf("decoding job %d: %w", i, err)
+		}
+		nodePrint, err := fingerprint(raw)
+		if err != nil {
+			return nil, fmt.Errorf("fingerprinting job %d: %w", i, err)
+		}
+
+		// Jobs are matched across reloads by type and name. Repeated names
+		// are told apart by the order in which they appear.
+		key := header.Type + "/" + j.Name()
+		seen[key]++
+		if n := seen[key]; n > 1 {
+			key = fmt.Sprintf("%s#%d", key, n)
+		}
+		jobs = append(jobs, &managedJob{
+			Job:         j,
+			key:         key,
+			fingerprint: optsPrint + nodePrint,
+			schedule:    schedule,
+			sched:       sched,
+			alert:       newAlertState(alerting),
+		})
 	}
-	return nil
+	return jobs, nil
 }
 
-// Run starts all jobs and blocks until ctx is cancelled.
+// fingerprint returns a digest of v's YAML encoding. Map keys are sorted when
+// encoding, so the digest doesn't depend on key order or comments.
+func fingerprint(v any) (string, error) {
+	data, err := yaml.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Run starts all jobs and returns immediately. Jobs run until ctx is
+// cancelled or they are removed by Reload.
 func (jm *JobManager) Run(ctx context.Context) {
+	jm.mu.Lock()
+	defer jm.mu.Unlock()
+	jm.ctx = ctx
 	for _, j := range jm.jobs {
-		go jm.schedule(ctx, j)
+		jm.start(j)
 	}
 }
 
-func (jm *JobManager) schedule(ctx context.Context, j Job) {
-	slog.Info("starting job", "name", j.Name(), "interval", j.Interval())
-	ticker := time.NewTicker(j.Interval())
-	defer ticker.Stop()
+// Reload builds jobs from nodes and reconciles them with the running set:
+// new jobs are started, removed jobs are stopped, and jobs whose config or
+// options changed are restarted. Unchanged jobs keep their schedules.
+// factories replace the registered factories of the same types, for example
+// to pick up new HTTP client settings. If any job fails to build, nothing is
+// changed, including the registered factories, and the error is returned.
+func (jm *JobManager) Reload(nodes []yaml.Node, opts JobOptions, factories ...JobFactory) (ReloadResult, error) {
+	var res ReloadResult
+	jm.mu.Lock()
+	registered := maps.Clone(jm.factories)
+	jm.mu.Unlock()
+	for _, f := range factories {
+		registered[f.Type()] = f
+	}
+	jobs, err := buildJobs(nodes, opts, registered)
+	if err != nil {
+		return res, err
+	}
 
-	for {
-		select {
-		case <-ticker.C:
-			metrics, events, err := j.Run(ctx)
-			if err != nil {
-				slog.Error("job run failed", "job", j.Name(), "error", err)
-				continue
-			}
-			jm.sender.SendMetrics(ctx, metrics)
-			jm.sender.SendEvents(ctx, events)
-		case <-ctx.Done():
-			slog.Info("stopping job", "name", j.Name())
+	jm.mu.Lock()
+	defer jm.mu.Unlock()
+	jm.factories = registered
+
+	old := make(map[string]*managedJob, len(jm.jobs))
+	for _, j := range jm.jobs {
+		old[j.key] = j
+	}
+
+	next := make([]*managedJob, 0, len(jobs))
+	for _, j := range jobs {
+		prev, ok := old[j.key]
+		delete(old, j.key)
+		switch {
+		case ok && prev.fingerprint == j.fingerprint:
+			res.Unchanged = append(res.Unchanged, j.key)
+			next = append(next, prev)
+			continue
+		case ok:
+			res.Changed = append(res.Changed, j.key)
+			jm.stop(prev)
+			j.missed.Store(prev.missed.Load())
+		default:
+			res.Added = append(res.Added, j.key)
+		}
+		if jm.ctx != nil {
+			jm.start(j)
+		}
+		next = append(next, j)
+	}
+	for _, j := range jm.jobs {
+		if _, removed := old[j.key]; removed {
+			res.Removed = append(res.Removed, j.key)
+			jm.stop(j)
+		}
+	}
+	jm.jobs = next
+	return res, nil
+}
+
+// start schedules j on its own goroutine. jm.mu must be held.
+func (jm *JobManager) start(j *managedJob) {
+	ctx, cancel := context.WithCancel(jm.ctx)
+	j.cancel = cancel
+	j.done = make(chan struct{})
+	go func() {
+		defer close(j.done)
+		jm.schedule(ctx, j)
+	}()
+}
+
+// stop cancels j and waits for any in-progress run to finish, so that the
+// old and new versions of a job never run at the same time.
+func (jm *JobManager) stop(j *managedJob) {
+	if j.cancel == nil {
+		return
+	}
+	j.cancel()
+	<-j.done
+}
+
+// InternalMetrics reports the number of ticks each job has missed because a
+// previous run was still in progress. It implements InternalMetricsSource.
+func (jm *JobManager) InternalMetrics() []Metric {
+	jm.mu.Lock()
+	defer jm.mu.Unlock()
+	metrics := make([]Metric, 0, len(jm.jobs))
+	for _, j := range jm.jobs {
+		metrics = append(metrics, MakeMetric("missed_ticks", float64(j.missed.Load()), j.Name(), "", nil))
+	}
+	return metrics
+}
+
+// runJob runs j once and sends its results. A run that returns an error is
+// reported as a failure event with a classified reason, and every run that
+// produces events also reports probe_success and probe_status_code metrics.
+// Events missing a URL, duration or message get them from the job and the
+// run, and are then filtered through the job's alert state, if it has one.
+func (jm *JobManager) runJob(ctx context.Context, j Job, alert *alertState) {
+	start := time.Now()
+	metrics, events, err := j.Run(ctx)
+	if err != nil {
+		if ctx.Err() != nil {
+			// Shutting down; an interrupted run isn't an outage.
 			return
 		}
+		slog.Error("job run failed", "job", j.Name(), "error", err)
+		events = append(events, failureEvent(j, err))
+	}
+	completeEvents(j, events, time.Since(start))
+	if len(events) > 0 {
+		metrics = append(metrics, probeSuccess(j, events), probeStatusCode(j, events))
 	}
+	jm.sender.SendMetrics(ctx, metrics)
+	jm.sender.SendEvents(ctx, alert.filter(j.Name(), events, time.Now()))
 }
 
 // MergeTags merges job-specific tags with global tags. Job tags take precedence.
@@ -225,3 +225,265 @@ func contains(s, substr string) bool {
 	}
 	return false
 }
+
+// recordingSender implements MetricEventSender and records what it was sent.
+type recordingSender struct {
+	metrics []Metric
+	events  []Event
+}
+
+func (s *recordingSender) SendMetrics(_ context.Context, metrics []Metric) {
+	s.metrics = append(s.metrics, metrics...)
+}
+
+func (s *recordingSender) SendEvents(_ context.Context, events []Event) {
+	s.events = append(s.events, events...)
+}
+
+// targetJob implements Job and Target with canned results.
+type targetJob struct {
+	mockJob
+	metrics []Metric
+	events  []Event
+	err     error
+}
+
+func (j *targetJob) URL() string             { return "tcp://db:5432" }
+func (j *targetJob) Tags() map[string]string { return map[string]string{"team": "data"} }
+func (j *targetJob) Run(_ context.Context) ([]Metric, []Event, error) {
+	return j.metrics, j.events, j.err
+}
+
+func TestRunJob(t *testing.T) {
+	healthy := MakeEvent("db", 200, nil)
+	down := MakeFailureEvent("db", 0, "connect: connection refused", nil)
+
+	tests := []struct {
+		name        string
+		job         Job
+		wantEvents  int
+		wantReason  string
+		wantSuccess float64
+		wantStatus  float64
+		noSuccess   bool
+	}{
+		{
+			name:        "healthy run",
+			job:         &targetJob{mockJob: mockJob{name: "db"}, events: []Event{healthy}},
+			wantEvents:  1,
+			wantSuccess: 1,
+			wantStatus:  200,
+		},
+		{
+			name:        "failure event from job",
+			job:         &targetJob{mockJob: mockJob{name: "db"}, events: []Event{down}},
+			wantEvents:  1,
+			wantReason:  "connect: connection refused",
+			wantSuccess: 0,
+		},
+		{
+			name:        "run error becomes failure event",
+			job:         &targetJob{mockJob: mockJob{name: "db"}, err: fmt.Errorf("executing request: %w", context.DeadlineExceeded)},
+			wantEvents:  1,
+			wantReason:  "timeout: executing request: context deadline exceeded",
+			wantSuccess: 0,
+		},
+		{
+			name:      "no events means no probe_success",
+			job:       &mockJob{name: "internal"},
+			noSuccess: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sender := &recordingSender{}
+			jm := NewJobManager(sender)
+			jm.runJob(context.Background(), tt.job, nil)
+
+			if len(sender.events) != tt.wantEvents {
+				t.Fatalf("got %d events, want %d", len(sender.events), tt.wantEvents)
+			}
+			if tt.wantEvents > 0 && sender.events[0].Reason != tt.wantReason {
+				t.Errorf("Reason = %q, want %q", sender.events[0].Reason, tt.wantReason)
+			}
+			if tt.wantEvents > 0 && (sender.events[0].URL != "tcp://db:5432" || sender.events[0].Message == "") {
+				t.Errorf("event not completed from Target: %+v", sender.events[0])
+			}
+
+			var success, status *Metric
+			for i, m := range sender.metrics {
+				switch m.Timing {
+				case "probe_success":
+					success = &sender.metrics[i]
+				case "probe_status_code":
+					status = &sender.metrics[i]
+				}
+			}
+			if tt.noSuccess {
+				if success != nil {
+					t.Errorf("unexpected probe_success metric %+v", *success)
+				}
+				return
+			}
+			if success == nil {
+				t.Fatal("missing probe_success metric")
+			}
+			if success.Value != tt.wantSuccess {
+				t.Errorf("probe_success = %v, want %v", success.Value, tt.wantSuccess)
+			}
+			if success.URL != "tcp://db:5432" || success.Tags["team"] != "data" {
+				t.Errorf("probe_success not labelled from Target: %+v", *success)
+			}
+			if status == nil {
+				t.Fatal("missing probe_status_code metric")
+			}
+			if status.Value != tt.wantStatus {
+				t.Errorf("probe_status_code = %v, want %v", status.Value, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestRunJob_CancelledContext(t *testing.T) {
+	sender := &recordingSender{}
+	jm := NewJobManager(sender)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	jm.runJob(ctx, &targetJob{mockJob: mockJob{name: "db"}, err: context.Canceled}, nil)
+	if len(sender.events) != 0 || len(sender.metrics) != 0 {
+		t.Errorf("expected nothing sent during shutdown, got %d metrics and %d events", len(sender.metrics), len(sender.events))
+	}
+}
+
+func TestReload(t *testing.T) {
+	factory := &mockFactory{
+		typeName: "mock",
+		createFn: func(cfg yaml.Node, _ JobOptions) (Job, error) {
+			var c struct {
+				Name string `yaml:"name"`
+			}
+			if err := cfg.Decode(&c); err != nil {
+				return nil, err
+			}
+			if c.Name == "" {
+				return nil, fmt.Errorf("name is required")
+			}
+			return &mockJob{name: c.Name, interval: time.Hour}, nil
+		},
+	}
+
+	jm := NewJobManager(&recordingSender{})
+	jm.RegisterFactory(factory)
+	if err := jm.BuildJobs(makeYAMLNodes(t,
+		"type: mock\nname: keep\nurl: a",
+		"type: mock\nname: change\nurl: a",
+		"type: mock\nname: remove",
+	), JobOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	jm.Run(ctx)
+
+	before := make(map[string]*managedJob)
+	for _, j := range jm.jobs {
+		before[j.key] = j
+	}
+
+	res, err := jm.Reload(makeYAMLNodes(t,
+		"name: keep\nurl: a\ntype: mock # reordered keys and a comment",
+		"type: mock\nname: change\nurl: b",
+		"type: mock\nname: add",
+	), JobOptions{})
+	if err != nil {
+		t.Fatalf("Reload() error: %v", err)
+	}
+
+	check := func(kind string, got []string, want ...string) {
+		t.Helper()
+		if fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("%s = %v, want %v", kind, got, want)
+		}
+	}
+	check("Added", res.Added, "mock/add")
+	check("Removed", res.Removed, "mock/remove")
+	check("Changed", res.Changed, "mock/change")
+	check("Unchanged", res.Unchanged, "mock/keep")
+
+	after := make(map[string]*managedJob)
+	for _, j := range jm.jobs {
+		after[j.key] = j
+	}
+	if after["mock/keep"] != before["mock/keep"] {
+		t.Error("unchanged job was replaced")
+	}
+	if after["mock/change"] == before["mock/change"] {
+		t.Error("changed job was not replaced")
+	}
+	for _, key := range []string{"mock/change", "mock/remove"} {
+		select {
+		case <-before[key].done:
+		default:
+			t.Errorf("old %s job still running", key)
+		}
+	}
+	for key, j := range after {
+		select {
+		case <-j.done:
+			t.Errorf("%s job is not running", key)
+		default:
+		}
+	}
+
+	// An invalid config leaves the running jobs alone.
+	if _, err := jm.Reload(makeYAMLNodes(t, "type: mock\nname: keep", "type: mock"), JobOptions{}); err == nil {
+		t.Fatal("expected error for invalid config")
+	}
+	if len(jm.jobs) != 3 || jm.jobs[0] != after["mock/keep"] {
+		t.Error("running jobs changed after a failed reload")
+	}
+
+	// So do the factories it brought.
+	replacement := &mockFactory{typeName: "mock", createFn: factory.createFn}
+	if _, err := jm.Reload(makeYAMLNodes(t, "type: mock"), JobOptions{}, replacement); err == nil {
+		t.Fatal("expected error for invalid config")
+	}
+	if jm.factories["mock"] != factory {
+		t.Error("factory replaced after a failed reload")
+	}
+
+	// Changing shared options restarts every job.
+	res, err = jm.Reload(makeYAMLNodes(t,
+		"type: mock\nname: keep\nurl: a",
+		"type: mock\nname: change\nurl: b",
+		"type: mock\nname: add",
+	), JobOptions{UserAgent: "crabby/2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Changed) != 3 {
+		t.Errorf("Changed = %v, want all jobs after an options change", res.Changed)
+	}
+
+	// A successful reload installs them.
+	if _, err := jm.Reload(makeYAMLNodes(t, "type: mock\nname: keep\nurl: a"), JobOptions{UserAgent: "crabby/2"}, replacement); err != nil {
+		t.Fatal(err)
+	}
+	if jm.factories["mock"] != replacement {
+		t.Error("factory not replaced after a successful reload")
+	}
+}
+
+func TestBuildJobs_DuplicateNames(t *testing.T) {
+	jm := NewJobManager(nil)
+	jm.RegisterFactory(&mockFactory{typeName: "http"})
+	if err := jm.BuildJobs(makeYAMLNodes(t, "type: http\nurl: a", "type: http\nurl: b"), JobOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if jm.jobs[0].key != "http/http" || jm.jobs[1].key != "http/http#2" {
+		t.Errorf("keys = %q, %q", jm.jobs[0].key, jm.jobs[1].key)
+	}
+}
@@ -0,0 +1,574 @@
+package job
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// segmentKind identifies the kind of a single path segment.
+type segmentKind int
+
+const (
+	segKey      segmentKind = iota // .name, ["name"], or .0 on an array
+	segIndex                       // [0] or [-1]
+	segWildcard                    // [*] or .*
+	segFilter                      // [?field == value]
+)
+
+// pathSegment is one step of a path expression.
+type pathSegment struct {
+	kind   segmentKind
+	key    string
+	index  int
+	filter *pathFilter
+	text   string // source text, used in error messages
+}
+
+// pathFilter selects array elements whose field compares true against value.
+// A filter with no operator keeps elements where the field exists and is not
+// false or null.
+type pathFilter struct {
+	field []pathSegment
+	op    string
+	value any
+}
+
+// jsonPath is a parsed path expression such as $.data.items[0].id.
+type jsonPath struct {
+	raw      string
+	segments []pathSegment
+}
+
+// parseJSONPath parses a path rooted at "$". See parseSegments for the syntax.
+func parseJSONPath(s string) (*jsonPath, error) {
+	if !strings.HasPrefix(s, "$") {
+		return nil, fmt.Errorf("path %q must start with \"$\"", s)
+	}
+	rest := s[1:]
+	if rest != "" && rest[0] != '.' && rest[0] != '[' {
+		return nil, fmt.Errorf("path %q must start with \"$.\" or \"$[\"", s)
+	}
+	segs, err := parseSegments(rest)
+	if err != nil {
+		return nil, fmt.Errorf("path %q: %w", s, err)
+	}
+	return &jsonPath{raw: s, segments: segs}, nil
+}
+
+func (p *jsonPath) String() string { return p.raw }
+
+// Eval walks doc, a value produced by decodeJSON, and returns the value at
+// the path. Wildcards and filters yield an array of the matching values.
+func (p *jsonPath) Eval(doc any) (any, error) {
+	v, _, err := walkPath(doc, p.segments, "$")
+	return v, err
+}
+
+// parseSegments parses dot keys (.name), numeric keys (.0), indexes ([0],
+// [-1]), quoted keys (["a.b"]), wildcards ([*] or .*) and filters
+// ([?name == "foo"], [?active]). A leading key may omit the dot.
+func parseSegments(s string) ([]pathSegment, error) {
+	var segs []pathSegment
+	i := 0
+	for i < len(s) {
+		start := i
+		switch {
+		case s[i] == '.':
+			i++
+			if i < len(s) && s[i] == '*' {
+				i++
+				segs = append(segs, pathSegment{kind: segWildcard, text: s[start:i]})
+				continue
+			}
+			end := scanKeyEnd(s, i)
+			if end == i {
+				return nil, fmt.Errorf("empty key at offset %d", start)
+			}
+			segs = append(segs, pathSegment{kind: segKey, key: s[i:end], text: s[start:end]})
+			i = end
+		case s[i] == '[':
+			end, err := scanBracketEnd(s, i)
+			if err != nil {
+				return nil, err
+			}
+			seg, err := parseBracket(s[i+1 : end])
+			if err != nil {
+				return nil, fmt.Errorf("segment %s: %w", s[i:end+1], err)
+			}
+			seg.text = s[i : end+1]
+			segs = append(segs, seg)
+			i = end + 1
+		case start == 0:
+			end := scanKeyEnd(s, i)
+			segs = append(segs, pathSegment{kind: segKey, key: s[i:end], text: s[i:end]})
+			i = end
+		default:
+			return nil, fmt.Errorf("unexpected %q at offset %d", s[i], i)
+		}
+	}
+	return segs, nil
+}
+
+// scanKeyEnd returns the index just past the bare key starting at i.
+func scanKeyEnd(s string, i int) int {
+	for i < len(s) && s[i] != '.' && s[i] != '[' {
+		i++
+	}
+	return i
+}
+
+// scanBracketEnd returns the index of the ']' closing the '[' at i,
+// skipping over quoted strings.
+func scanBracketEnd(s string, i int) (int, error) {
+	var quote byte
+	for j := i + 1; j < len(s); j++ {
+		switch {
+		case quote != 0:
+			if s[j] == '\\' {
+				j++
+			} else if s[j] == quote {
+				quote = 0
+			}
+		case s[j] == '"' || s[j] == '\'':
+			quote = s[j]
+		case s[j] == ']':
+			return j, nil
+		}
+	}
+	return 0, fmt.Errorf("unclosed '[' at offset %d", i)
+}
+
+// parseBracket parses the contents of a [...] segment.
+func parseBracket(inner string) (pathSegment, error) {
+	inner = strings.TrimSpace(inner)
+	switch {
+	case inner == "*":
+		return pathSegment{kind: segWildcard}, nil
+	case strings.HasPrefix(inner, "?"):
+		f, err := parseFilter(strings.TrimSpace(inner[1:]))
+		if err != nil {
+			return pathSegment{}, err
+		}
+		return pathSegment{kind: segFilter, filter: f}, nil
+	case strings.HasPrefix(inner, `"`) || strings.HasPrefix(inner, "'"):
+		v, err := parseLiteral(inner)
+		if err != nil {
+			return pathSegment{}, err
+		}
+		key, ok := v.(string)
+		if !ok {
+			return pathSegment{}, fmt.Errorf("invalid quoted key")
+		}
+		return pathSegment{kind: segKey, key: key}, nil
+	}
+	n, err := strconv.Atoi(inner)
+	if err != nil {
+		return pathSegment{}, fmt.Errorf("expected an index, *, a quoted key or a ?filter")
+	}
+	return pathSegment{kind: segIndex, index: n}, nil
+}
+
+// parseFilter parses "field [op value]" from a [?...] segment.
+func parseFilter(s string) (*pathFilter, error) {
+	end := scanPathEnd(s)
+	if end == 0 {
+		return nil, fmt.Errorf("filter has no field")
+	}
+	field, err := parseSegments(s[:end])
+	if err != nil {
+		return nil, fmt.Errorf("filter field: %w", err)
+	}
+	f := &pathFilter{field: field}
+
+	rest := strings.TrimSpace(s[end:])
+	if rest == "" {
+		return f, nil
+	}
+	op, rest := cutOperator(rest)
+	if op == "" || op == "contains" {
+		return nil, fmt.Errorf("filter expects ==, !=, >, >=, < or <= after %q", s[:end])
+	}
+	f.op = op
+	if f.value, err = parseLiteral(rest); err != nil {
+		return nil, err
+	}
+	if _, ok := toFloat(f.value); !ok && strings.ContainsAny(op, "<>") {
+		return nil, fmt.Errorf("filter %s requires a numeric value", op)
+	}
+	return f, nil
+}
+
+var assertionOps = []string{"==", "!=", ">=", "<=", ">", "<", "contains"}
+
+// cutOperator splits a leading comparison operator from s.
+func cutOperator(s string) (op, rest string) {
+	for _, candidate := range assertionOps {
+		if strings.HasPrefix(s, candidate) {
+			return candidate, strings.TrimSpace(s[len(candidate):])
+		}
+	}
+	return "", s
+}
+
+// parseLiteral parses a JSON literal, also accepting a single-quoted string.
+func parseLiteral(s string) (any, error) {
+	if len(s) >= 2 && s[0] == '\'' && s[len(s)-1] == '\'' {
+		return s[1 : len(s)-1], nil
+	}
+	v, err := decodeJSON([]byte(s))
+	if err != nil {
+		return nil, fmt.Errorf("value %q is not a JSON literal: %w", s, err)
+	}
+	return v, nil
+}
+
+// walkPath applies segs to v. walked is the path text consumed so far and
+// prefixes error messages. projected reports whether a wildcard or filter
+// turned the result into an array of matches.
+func walkPath(v any, segs []pathSegment, walked string) (result any, projected bool, err error) {
+	if len(segs) >= maxJSONDepth {
+		return nil, false, fmt.Errorf("max JSON nesting depth (%d) exceeded", maxJSONDepth)
+	}
+	for i, seg := range segs {
+		here := walked + seg.text
+		switch seg.kind {
+		case segKey, segIndex:
+			next, err := stepInto(v, seg)
+			if err != nil {
+				return nil, false, fmt.Errorf("at %s: %w", here, err)
+			}
+			v = next
+		case segWildcard, segFilter:
+			elems, err := projectionInput(v, seg)
+			if err != nil {
+				return nil, false, fmt.Errorf("at %s: %w", here, err)
+			}
+			// Elements the remaining path doesn't resolve on are skipped.
+			out := make([]any, 0, len(elems))
+			for _, el := range elems {
+				if r, _, err := walkPath(el, segs[i+1:], here); err == nil {
+					out = append(out, r)
+				}
+			}
+			return out, true, nil
+		}
+		walked = here
+	}
+	return v, false, nil
+}
+
+// stepInto applies a key or index segment to v.
+func stepInto(v any, seg pathSegment) (any, error) {
+	switch t := v.(type) {
+	case map[string]any:
+		if seg.kind == segIndex {
+			return nil, fmt.Errorf("cannot index an object")
+		}
+		if child, ok := t[seg.key]; ok {
+			return child, nil
+		}
+		if seg.key == "length" {
+			return float64(len(t)), nil
+		}
+		return nil, fmt.Errorf("key %q not found", seg.key)
+	case []any:
+		want := seg.index
+		if seg.kind == segKey {
+			if seg.key == "length" {
+				return float64(len(t)), nil
+			}
+			n, err := strconv.Atoi(seg.key)
+			if err != nil {
+				return nil, fmt.Errorf("cannot look up key %q in an array", seg.key)
+			}
+			want = n
+		}
+		idx := want
+		if idx < 0 {
+			idx += len(t)
+		}
+		if idx < 0 || idx >= len(t) {
+			return nil, fmt.Errorf("index %d out of range (array has %d elements)", want, len(t))
+		}
+		return t[idx], nil
+	case string:
+		if seg.kind == segKey && seg.key == "length" {
+			return float64(len(t)), nil
+		}
+	}
+	if seg.kind == segIndex {
+		return nil, fmt.Errorf("cannot index %s", jsonTypeName(v))
+	}
+	return nil, fmt.Errorf("cannot look up key %q in %s", seg.key, jsonTypeName(v))
+}
+
+// projectionInput returns the elements a wildcard or filter iterates over.
+func projectionInput(v any, seg pathSegment) ([]any, error) {
+	switch t := v.(type) {
+	case []any:
+		if seg.kind == segWildcard {
+			return t, nil
+		}
+		var kept []any
+		for _, el := range t {
+			if seg.filter.match(el) {
+				kept = append(kept, el)
+			}
+		}
+		return kept, nil
+	case map[string]any:
+		if seg.kind == segWildcard {
+			// Object key order isn't preserved by decoding, so sort for stable output.
+			out := make([]any, 0, len(t))
+			for _, k := range slices.Sorted(maps.Keys(t)) {
+				out = append(out, t[k])
+			}
+			return out, nil
+		}
+	}
+	return nil, fmt.Errorf("cannot apply %s to %s", seg.text, jsonTypeName(v))
+}
+
+// match reports whether el satisfies the filter.
+func (f *pathFilter) match(el any) bool {
+	got, projected, err := walkPath(el, f.field, "")
+	if err != nil || projected {
+		return false
+	}
+	if f.op == "" {
+		return got != nil && got != false
+	}
+	ok, err := compareJSON(got, f.op, f.value)
+	return err == nil && ok
+}
+
+// compareJSON applies a comparison operator to two decoded values.
+func compareJSON(got any, op string, want any) (bool, error) {
+	switch op {
+	case "==":
+		return jsonEqual(got, want), nil
+	case "!=":
+		return !jsonEqual(got, want), nil
+	case "contains":
+		return jsonContains(got, want), nil
+	}
+	n, ok := toFloat(got)
+	if !ok {
+		return false, fmt.Errorf("%s, not a number", jsonTypeName(got))
+	}
+	w, ok := toFloat(want)
+	if !ok {
+		return false, fmt.Errorf("%s requires a numeric value, not %s", op, jsonTypeName(want))
+	}
+	switch op {
+	case ">":
+		return n > w, nil
+	case ">=":
+		return n >= w, nil
+	case "<":
+		return n < w, nil
+	case "<=":
+		return n <= w, nil
+	}
+	return false, fmt.Errorf("unknown operator %q", op)
+}
+
+// decodeJSON decodes data into generic values. Numbers are kept as
+// json.Number so that large integers such as IDs survive re-encoding.
+func decodeJSON(data []byte) (any, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	if dec.More() {
+		return nil, fmt.Errorf("unexpected data after JSON value")
+	}
+	return v, nil
+}
+
+// toFloat converts a decoded JSON number to float64.
+func toFloat(v any) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// jsonEqual compares two decoded values, treating numbers by value.
+func jsonEqual(a, b any) bool {
+	if x, ok := toFloat(a); ok {
+		y, ok := toFloat(b)
+		return ok && x == y
+	}
+	switch x := a.(type) {
+	case []any:
+		y, ok := b.([]any)
+		if !ok || len(x) != len(y) {
+			return false
+		}
+		for i := range x {
+			if !jsonEqual(x[i], y[i]) {
+				return false
+			}
+		}
+		return true
+	case map[string]any:
+		y, ok := b.(map[string]any)
+		if !ok || len(x) != len(y) {
+			return false
+		}
+		for k, xv := range x {
+			yv, ok := y[k]
+			if !ok || !jsonEqual(xv, yv) {
+				return false
+			}
+		}
+		return true
+	}
+	return a == b
+}
+
+// jsonTypeName names the JSON type of a decoded value for error messages.
+func jsonTypeName(v any) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "a boolean"
+	case float64, json.Number:
+		return "a number"
+	case string:
+		return "a string"
+	case []any:
+		return "an array"
+	case map[string]any:
+		return "an object"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+// jsonAssertion is a parsed assertion such as `$.status == "ok"`. An
+// assertion with no operator only checks that the path exists.
+type jsonAssertion struct {
+	raw      string
+	path     *jsonPath
+	op       string
+	expected any
+}
+
+// parseJSONAssertion parses "<path> [<op> <JSON literal>]".
+func parseJSONAssertion(s string) (*jsonAssertion, error) {
+	s = strings.TrimSpace(s)
+	pathEnd := scanPathEnd(s)
+	path, err := parseJSONPath(s[:pathEnd])
+	if err != nil {
+		return nil, fmt.Errorf("assertion %q: %w", s, err)
+	}
+	a := &jsonAssertion{raw: s, path: path}
+
+	rest := strings.TrimSpace(s[pathEnd:])
+	if rest == "" {
+		return a, nil
+	}
+	a.op, rest = cutOperator(rest)
+	if a.op == "" {
+		return nil, fmt.Errorf("assertion %q: expected one of %s after path", s, strings.Join(assertionOps, ", "))
+	}
+	if a.expected, err = parseLiteral(rest); err != nil {
+		return nil, fmt.Errorf("assertion %q: %w", s, err)
+	}
+	if _, ok := toFloat(a.expected); !ok && strings.ContainsAny(a.op, "<>") {
+		return nil, fmt.Errorf("assertion %q: %s requires a numeric value", s, a.op)
+	}
+	return a, nil
+}
+
+// scanPathEnd returns the index where the path portion of s ends: the first
+// whitespace or operator character outside of brackets and quotes.
+func scanPathEnd(s string) int {
+	depth := 0
+	var quote rune
+	for i, r := range s {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case r == '[':
+			depth++
+		case r == ']':
+			depth--
+		case depth == 0 && (unicode.IsSpace(r) || strings.ContainsRune("=!<>", r)):
+			return i
+		}
+	}
+	return len(s)
+}
+
+// Check evaluates the assertion against doc and returns a descriptive error
+// when it doesn't hold.
+func (a *jsonAssertion) Check(doc any) error {
+	got, err := a.path.Eval(doc)
+	if err != nil {
+		return fmt.Errorf("assertion %q failed: %w", a.raw, err)
+	}
+	if a.op == "" {
+		return nil
+	}
+	ok, err := compareJSON(got, a.op, a.expected)
+	if err != nil {
+		return fmt.Errorf("assertion %q failed: %s is %w", a.raw, a.path, err)
+	}
+	if !ok {
+		return fmt.Errorf("assertion %q failed: %s is %s", a.raw, a.path, compactJSON(got))
+	}
+	return nil
+}
+
+// jsonContains reports whether got contains want: a substring for strings,
+// an element for arrays, or a key for objects.
+func jsonContains(got, want any) bool {
+	switch t := got.(type) {
+	case string:
+		s, ok := want.(string)
+		return ok && strings.Contains(t, s)
+	case []any:
+		for _, el := range t {
+			if jsonEqual(el, want) {
+				return true
+			}
+		}
+	case map[string]any:
+		s, ok := want.(string)
+		if ok {
+			_, present := t[s]
+			return present
+		}
+	}
+	return false
+}
+
+// compactJSON renders a decoded value as compact JSON for messages.
+func compactJSON(v any) string {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return fmt.Sprint(v)
+	}
+	return strings.TrimSpace(buf.String())
+}
@@ -0,0 +1,196 @@
+package job
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestJSONPath_Eval(t *testing.T) {
+	doc, err := decodeJSON([]byte(`{"status":"ok","count":3,"data":{"items":[{"id":1},{"id":2}],"name":"crabby","length":"custom"}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path    string
+		want    string
+		wantErr string
+	}{
+		{path: "$", want: `{"count":3,"data":{"items":[{"id":1},{"id":2}],"length":"custom","name":"crabby"},"status":"ok"}`},
+		{path: "$.status", want: `"ok"`},
+		{path: "$.count", want: `3`},
+		{path: "$.data.items.length", want: `2`},
+		{path: "$.data.name.length", want: `6`},
+		{path: "$.data.length", want: `"custom"`},
+		{path: "$.length", want: `3`},
+		{path: "$.missing", wantErr: `at $.missing: key "missing" not found`},
+		{path: "$.data.items.id", wantErr: `at $.data.items.id: cannot look up key "id" in an array`},
+		{path: "$.count.value", wantErr: `at $.count.value: cannot look up key "value" in a number`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			p, err := parseJSONPath(tt.path)
+			if err != nil {
+				t.Fatalf("parseJSONPath() error: %v", err)
+			}
+			got, err := p.Eval(doc)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Eval() error: %v", err)
+			}
+			if s := compactJSON(got); s != tt.want {
+				t.Errorf("Eval() = %s, want %s", s, tt.want)
+			}
+		})
+	}
+}
+
+func TestJSONPath_Eval_Arrays(t *testing.T) {
+	doc, err := decodeJSON([]byte(`{
+		"items": [
+			{"id": 1, "name": "foo", "active": true, "size": 10},
+			{"id": 2, "name": "bar", "active": false, "size": 20},
+			{"id": 9007199254740993, "name": "baz", "size": 30}
+		],
+		"a.b": {"c": "dotted"},
+		"matrix": [[1, 2], [3, 4]]
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path    string
+		want    string
+		wantErr string
+	}{
+		{path: "$.items[0].id", want: `1`},
+		{path: "$.items.1.name", want: `"bar"`},
+		{path: "$.items[-1].name", want: `"baz"`},
+		{path: "$.items[2].id", want: `9007199254740993`},
+		{path: "$.matrix[1][0]", want: `3`},
+		{path: `$["a.b"].c`, want: `"dotted"`},
+		{path: "$['a.b']['c']", want: `"dotted"`},
+		{path: "$.items[*].name", want: `["foo","bar","baz"]`},
+		{path: "$.items.*.id", want: `[1,2,9007199254740993]`},
+		{path: "$.items[*].active", want: `[true,false]`},
+		{path: `$.items[?name=="bar"].id`, want: `[2]`},
+		{path: `$.items[?name == 'foo'].size`, want: `[10]`},
+		{path: "$.items[?size > 15].name", want: `["bar","baz"]`},
+		{path: "$.items[?active].name", want: `["foo"]`},
+		{path: `$.items[?name == "qux"].id`, want: `[]`},
+		{path: "$.items[3].id", wantErr: `at $.items[3]: index 3 out of range (array has 3 elements)`},
+		{path: "$.items[-4]", wantErr: `at $.items[-4]: index -4 out of range (array has 3 elements)`},
+		{path: "$.items[0].missing", wantErr: `at $.items[0].missing: key "missing" not found`},
+		{path: "$.items[0][1]", wantErr: `at $.items[0][1]: cannot index an object`},
+		{path: "$.items[0].name[*]", wantErr: `at $.items[0].name[*]: cannot apply [*] to a string`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			p, err := parseJSONPath(tt.path)
+			if err != nil {
+				t.Fatalf("parseJSONPath() error: %v", err)
+			}
+			got, err := p.Eval(doc)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Eval() error: %v", err)
+			}
+			if s := compactJSON(got); s != tt.want {
+				t.Errorf("Eval() = %s, want %s", s, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseJSONPath_Errors(t *testing.T) {
+	for _, path := range []string{"", "status", "$status", "$.a..b", "$.", "$.a[", "$.a[x]", "$.a[?]", "$.a[?b ~ 1]", "$.a[?b == c]", `$.a[?b > "abc"]`, "$.a[?b <= true]"} {
+		if _, err := parseJSONPath(path); err == nil {
+			t.Errorf("parseJSONPath(%q) expected error", path)
+		}
+	}
+}
+
+func TestJSONAssertion_Check(t *testing.T) {
+	doc, err := decodeJSON([]byte(`{"status":"ok","items":[1,2,3],"latency":12.5,"tags":["a","b"],"meta":{"region":"us"}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		expr    string
+		wantErr string
+	}{
+		{expr: `$.status == "ok"`},
+		{expr: `$.status != "degraded"`},
+		{expr: `$.items.length > 0`},
+		{expr: `$.items.length>=3`},
+		{expr: `$.latency < 100`},
+		{expr: `$.latency <= 12.5`},
+		{expr: `$.items == [1,2,3]`},
+		{expr: `$.tags contains "b"`},
+		{expr: `$.status contains "o"`},
+		{expr: `$.meta contains "region"`},
+		{expr: `$.meta.region`},
+		{expr: `$.status == "degraded"`, wantErr: `assertion "$.status == \"degraded\"" failed: $.status is "ok"`},
+		{expr: `$.items.length > 5`, wantErr: `failed: $.items.length is 3`},
+		{expr: `$.status > 1`, wantErr: `$.status is a string, not a number`},
+		{expr: `$.meta.zone`, wantErr: `at $.meta.zone: key "zone" not found`},
+		{expr: `$.tags contains "c"`, wantErr: `failed: $.tags is ["a","b"]`},
+		{expr: `$.items[0] == 1`},
+		{expr: `$.items[-1] >= 3`},
+		{expr: `$.tags[*] contains "a"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			a, err := parseJSONAssertion(tt.expr)
+			if err != nil {
+				t.Fatalf("parseJSONAssertion() error: %v", err)
+			}
+			err = a.Check(doc)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Check() error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Check() error = %v, want containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseJSONAssertion_Errors(t *testing.T) {
+	tests := []struct {
+		expr    string
+		wantErr string
+	}{
+		{expr: `status == "ok"`, wantErr: `must start with`},
+		{expr: `$.status ~= "ok"`, wantErr: `expected one of`},
+		{expr: `$.status == ok`, wantErr: `not a JSON literal`},
+		{expr: `$.count > "5"`, wantErr: `requires a numeric value`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			_, err := parseJSONAssertion(tt.expr)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error = %v, want containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
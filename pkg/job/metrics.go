@@ -1,6 +1,9 @@
 package job
 
-import "time"
+import (
+	"fmt"
+	"time"
+)
 
 // Metric holds one metric data point.
 type Metric struct {
@@ -12,12 +15,72 @@ type Metric struct {
 	Tags      map[string]string
 }
 
+// Severity classifies the result an event reports.
+type Severity string
+
+// Event severities, from healthy to most severe.
+const (
+	SeverityOK       Severity = "ok"
+	SeverityWarning  Severity = "warning"
+	SeverityError    Severity = "error"
+	SeverityCritical Severity = "critical"
+)
+
 // Event holds one monitoring event.
 type Event struct {
 	Name         string
 	ServerStatus int
 	Timestamp    time.Time
 	Tags         map[string]string
+	// Severity classifies the result. Events that leave it empty are judged
+	// by their status and reason; see Level.
+	Severity Severity
+	// Reason describes why a probe failed. It is empty for healthy results.
+	Reason string
+	// URL is the endpoint the probe checked, if it has one.
+	URL string
+	// Duration is how long the probe took.
+	Duration time.Duration
+	// Message is a one-line, human-readable description of the result.
+	Message string
+}
+
+// Level returns the event's severity. For events without one, it is derived
+// from the status and reason: a failure reason, a missing status or a 5xx
+// status is critical, a 4xx status is an error, and anything else is ok.
+func (e Event) Level() Severity {
+	if e.Severity != "" {
+		return e.Severity
+	}
+	return statusSeverity(e.ServerStatus, e.Reason)
+}
+
+func statusSeverity(status int, reason string) Severity {
+	switch {
+	case reason != "", status <= 0, status >= 500:
+		return SeverityCritical
+	case status >= 400:
+		return SeverityError
+	}
+	return SeverityOK
+}
+
+// Failed reports whether the event describes an unhealthy result, that is,
+// whether its Level is anything but SeverityOK.
+func (e Event) Failed() bool {
+	return e.Level() != SeverityOK
+}
+
+// Summary returns the event's Message, or a short description built from
+// its name, status and reason if it has none.
+func (e Event) Summary() string {
+	if e.Message != "" {
+		return e.Message
+	}
+	if e.Reason != "" {
+		return fmt.Sprintf("%v failed: %v", e.Name, e.Reason)
+	}
+	return fmt.Sprintf("%v returned status %v", e.Name, e.ServerStatus)
 }
 
 // MakeMetric creates a Metric for a given timing name and value.
@@ -32,16 +95,36 @@ func MakeMetric(timing string, value float64, name, url string, tags map[string]
 	}
 }
 
-// MakeEvent creates an Event from a given status code.
+// MakeEvent creates an Event from a given status code, with the severity
+// Level derives from it.
 func MakeEvent(name string, status int, tags map[string]string) Event {
 	e := Event{
 		Name:         name,
 		ServerStatus: status,
 		Timestamp:    time.Now(),
 		Tags:         tags,
+		Severity:     statusSeverity(status, ""),
 	}
 	if len(e.Tags) == 0 {
 		e.Tags = make(map[string]string)
 	}
 	return e
 }
+
+// MakeSuccessEvent creates an ok Event for a probe that passed its checks,
+// whatever its status. Probes that don't speak HTTP pass a status of 0.
+func MakeSuccessEvent(name string, status int, message string, tags map[string]string) Event {
+	e := MakeEvent(name, status, tags)
+	e.Severity = SeverityOK
+	e.Message = message
+	return e
+}
+
+// MakeFailureEvent creates a critical Event for a failed probe, recording why
+// it failed.
+func MakeFailureEvent(name string, status int, reason string, tags map[string]string) Event {
+	e := MakeEvent(name, status, tags)
+	e.Severity = SeverityCritical
+	e.Reason = reason
+	return e
+}
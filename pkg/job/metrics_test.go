@@ -126,3 +126,20 @@ func TestMakeEvent(t *testing.T) {
 		})
 	}
 }
+
+func TestMakeFailureEvent(t *testing.T) {
+	e := MakeFailureEvent("db", 0, "connect: connection refused", nil)
+
+	if e.Name != "db" {
+		t.Errorf("Name = %q, want %q", e.Name, "db")
+	}
+	if e.ServerStatus != 0 {
+		t.Errorf("ServerStatus = %d, want 0", e.ServerStatus)
+	}
+	if e.Reason != "connect: connection refused" {
+		t.Errorf("Reason = %q, want %q", e.Reason, "connect: connection refused")
+	}
+	if e.Tags == nil {
+		t.Error("Tags is nil, expected initialized map")
+	}
+}
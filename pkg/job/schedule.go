@@ -0,0 +1,160 @@
+package job
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// Schedule decides when a job runs next.
+type Schedule interface {
+	// Next returns the first run time after t, or the zero time if the
+	// schedule never fires again.
+	Next(t time.Time) time.Time
+	String() string
+}
+
+// intervalSchedule runs a job every d.
+type intervalSchedule time.Duration
+
+func (s intervalSchedule) Next(t time.Time) time.Time { return t.Add(time.Duration(s)) }
+func (s intervalSchedule) String() string             { return time.Duration(s).String() }
+
+// cronSchedule runs a job according to a cron expression.
+type cronSchedule struct {
+	cron.Schedule
+	spec string
+}
+
+func (s cronSchedule) String() string { return s.spec }
+
+// ParseSchedule parses a job's schedule field: either a Go duration such as
+// "200ms" or "36h", or a standard five-field cron expression such as
+// "*/5 9-17 * * MON-FRI". Cron expressions may be prefixed with
+// CRON_TZ=<zone> to run in a time zone other than the local one, and the
+// descriptors @hourly, @daily, @weekly, @monthly and @every <duration> are
+// also accepted.
+func ParseSchedule(spec string) (Schedule, error) {
+	if d, err := time.ParseDuration(spec); err == nil {
+		if d <= 0 {
+			return nil, fmt.Errorf("schedule %q must be positive", spec)
+		}
+		return intervalSchedule(d), nil
+	}
+	cs, err := cron.ParseStandard(spec)
+	if err != nil {
+		return nil, fmt.Errorf("schedule %q is neither a duration nor a cron expression: %w", spec, err)
+	}
+	return cronSchedule{Schedule: cs, spec: spec}, nil
+}
+
+// ScheduleOptions controls when a job's runs start.
+type ScheduleOptions struct {
+	// Splay shifts all of a job's runs by a random amount up to Splay, chosen
+	// when the job starts, so that jobs on the same schedule don't all fire
+	// at the same instant.
+	Splay time.Duration
+	// Jitter delays each run by a random amount up to Jitter. It is capped at
+	// half the gap to the following run and doesn't accumulate across runs.
+	Jitter time.Duration
+	// RunOnStart runs a job as soon as it is scheduled (after any splay)
+	// instead of waiting one full interval.
+	RunOnStart bool
+}
+
+// scheduleOverrides holds the per-job scheduling fields that may appear
+// alongside `type` in any job's config.
+type scheduleOverrides struct {
+	Splay      string `yaml:"splay,omitempty"`
+	Jitter     string `yaml:"jitter,omitempty"`
+	RunOnStart *bool  `yaml:"run-on-start,omitempty"`
+}
+
+// apply returns defaults with any overrides set in the job's config.
+func (o scheduleOverrides) apply(defaults ScheduleOptions) (ScheduleOptions, error) {
+	s := defaults
+	if o.Splay != "" {
+		d, err := time.ParseDuration(o.Splay)
+		if err != nil || d < 0 {
+			return s, fmt.Errorf("invalid splay %q", o.Splay)
+		}
+		s.Splay = d
+	}
+	if o.Jitter != "" {
+		d, err := time.ParseDuration(o.Jitter)
+		if err != nil || d < 0 {
+			return s, fmt.Errorf("invalid jitter %q", o.Jitter)
+		}
+		s.Jitter = d
+	}
+	if o.RunOnStart != nil {
+		s.RunOnStart = *o.RunOnStart
+	}
+	return s, nil
+}
+
+// randDuration returns a random duration in [0, max).
+func randDuration(max time.Duration) time.Duration {
+	if max <= 0 {
+		return 0
+	}
+	return rand.N(max)
+}
+
+// schedule runs j according to its schedule until ctx is cancelled. Runs
+// happen one at a time on this goroutine, so a job never overlaps itself. If
+// a run is still in progress when later runs fall due, those runs are
+// skipped and counted in j.missed.
+func (jm *JobManager) schedule(ctx context.Context, j *managedJob) {
+	offset := randDuration(j.sched.Splay)
+
+	next := time.Now()
+	if !j.sched.RunOnStart {
+		next = j.schedule.Next(next)
+	}
+	if next.IsZero() {
+		slog.Warn("job schedule never fires", "job", j.Name(), "schedule", j.schedule.String())
+		return
+	}
+	slog.Info("starting job", "name", j.Name(), "schedule", j.schedule.String(), "first_run", next.Add(offset))
+
+	timer := time.NewTimer(time.Until(next) + offset)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-timer.C:
+			jm.runJob(ctx, j.Job, j.alert)
+
+			now := time.Now()
+			next = j.schedule.Next(next)
+			var missed uint64
+			for !next.IsZero() && !next.Add(offset).After(now) {
+				next = j.schedule.Next(next)
+				missed++
+			}
+			if missed > 0 {
+				j.missed.Add(missed)
+				slog.Warn("job run overran its schedule", "job", j.Name(), "missed_ticks", missed)
+			}
+			if next.IsZero() {
+				slog.Warn("job schedule has no further runs", "job", j.Name(), "schedule", j.schedule.String())
+				<-ctx.Done()
+				return
+			}
+
+			jitter := j.sched.Jitter
+			if following := j.schedule.Next(next); !following.IsZero() {
+				jitter = min(jitter, following.Sub(next)/2)
+			}
+			timer.Reset(time.Until(next) + offset + randDuration(jitter))
+		case <-ctx.Done():
+			slog.Info("stopping job", "name", j.Name())
+			return
+		}
+	}
+}
@@ -0,0 +1,252 @@
+package job
+
+import (
+	"context"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// funcJob is a Job whose Run calls fn.
+type funcJob struct {
+	mockJob
+	fn func(ctx context.Context)
+}
+
+func (j *funcJob) Run(ctx context.Context) ([]Metric, []Event, error) {
+	j.fn(ctx)
+	return nil, nil, nil
+}
+
+func TestScheduleOverrides_apply(t *testing.T) {
+	yes := true
+	defaults := ScheduleOptions{Splay: time.Minute, Jitter: time.Second}
+
+	tests := []struct {
+		name    string
+		o       scheduleOverrides
+		want    ScheduleOptions
+		wantErr string
+	}{
+		{name: "defaults", want: defaults},
+		{
+			name: "overrides",
+			o:    scheduleOverrides{Splay: "0s", Jitter: "250ms", RunOnStart: &yes},
+			want: ScheduleOptions{Jitter: 250 * time.Millisecond, RunOnStart: true},
+		},
+		{name: "bad splay", o: scheduleOverrides{Splay: "soon"}, wantErr: `invalid splay "soon"`},
+		{name: "negative jitter", o: scheduleOverrides{Jitter: "-1s"}, wantErr: `invalid jitter "-1s"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.o.apply(defaults)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("apply() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuildJobs_ScheduleOverrides(t *testing.T) {
+	jm := NewJobManager(nil)
+	jm.RegisterFactory(&mockFactory{typeName: "http"})
+
+	opts := JobOptions{Schedule: ScheduleOptions{Splay: 30 * time.Second}}
+	err := jm.BuildJobs(makeYAMLNodes(t,
+		"type: http",
+		"type: http\nsplay: 5s\nrun-on-start: true",
+	), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := jm.jobs[0].sched; got != opts.Schedule {
+		t.Errorf("job 0 sched = %+v, want defaults %+v", got, opts.Schedule)
+	}
+	if got, want := jm.jobs[1].sched, (ScheduleOptions{Splay: 5 * time.Second, RunOnStart: true}); got != want {
+		t.Errorf("job 1 sched = %+v, want %+v", got, want)
+	}
+
+	err = jm.BuildJobs(makeYAMLNodes(t, "type: http\njitter: lots"), opts)
+	if err == nil || !strings.Contains(err.Error(), `invalid jitter "lots"`) {
+		t.Errorf("error = %v, want invalid jitter", err)
+	}
+}
+
+func TestSchedule_RunOnStart(t *testing.T) {
+	ran := make(chan struct{}, 1)
+	j := &managedJob{
+		Job: &funcJob{
+			mockJob: mockJob{name: "eager", interval: time.Hour},
+			fn: func(context.Context) {
+				select {
+				case ran <- struct{}{}:
+				default:
+				}
+			},
+		},
+		schedule: intervalSchedule(time.Hour),
+		sched:    ScheduleOptions{RunOnStart: true},
+	}
+
+	jm := NewJobManager(&recordingSender{})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go jm.schedule(ctx, j)
+
+	select {
+	case <-ran:
+	case <-time.After(2 * time.Second):
+		t.Fatal("job with run-on-start did not run immediately")
+	}
+}
+
+func TestSchedule_NoOverlapCountsMissedTicks(t *testing.T) {
+	var running, maxRunning, runs atomic.Int32
+	j := &managedJob{
+		Job: &funcJob{
+			mockJob: mockJob{name: "slow", interval: 20 * time.Millisecond},
+			fn: func(context.Context) {
+				n := running.Add(1)
+				if n > maxRunning.Load() {
+					maxRunning.Store(n)
+				}
+				time.Sleep(70 * time.Millisecond)
+				running.Add(-1)
+				runs.Add(1)
+			},
+		},
+		schedule: intervalSchedule(20 * time.Millisecond),
+		sched:    ScheduleOptions{RunOnStart: true},
+	}
+
+	jm := NewJobManager(&recordingSender{})
+	jm.jobs = []*managedJob{j}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		jm.schedule(ctx, j)
+		close(done)
+	}()
+
+	time.Sleep(300 * time.Millisecond)
+	cancel()
+	<-done
+
+	if maxRunning.Load() != 1 {
+		t.Errorf("max concurrent runs = %d, want 1", maxRunning.Load())
+	}
+	if runs.Load() < 2 {
+		t.Fatalf("runs = %d, want at least 2", runs.Load())
+	}
+	if j.missed.Load() == 0 {
+		t.Error("expected missed ticks to be counted")
+	}
+
+	metrics := jm.InternalMetrics()
+	if len(metrics) != 1 || metrics[0].Timing != "missed_ticks" || metrics[0].Job != "slow" {
+		t.Fatalf("InternalMetrics() = %+v", metrics)
+	}
+	if metrics[0].Value != float64(j.missed.Load()) {
+		t.Errorf("missed_ticks = %v, want %d", metrics[0].Value, j.missed.Load())
+	}
+}
+
+func TestParseSchedule(t *testing.T) {
+	base := time.Date(2026, 3, 6, 17, 58, 0, 0, time.UTC) // a Friday
+
+	tests := []struct {
+		spec    string
+		want    []time.Time
+		wantErr string
+	}{
+		{spec: "200ms", want: []time.Time{base.Add(200 * time.Millisecond), base.Add(400 * time.Millisecond)}},
+		{spec: "36h", want: []time.Time{base.Add(36 * time.Hour)}},
+		{
+			spec: "CRON_TZ=UTC 0 3 * * *",
+			want: []time.Time{time.Date(2026, 3, 7, 3, 0, 0, 0, time.UTC), time.Date(2026, 3, 8, 3, 0, 0, 0, time.UTC)},
+		},
+		{
+			// Business hours only: the run after Friday 17:55 is Monday 09:00.
+			spec: "CRON_TZ=UTC */5 9-17 * * MON-FRI",
+			want: []time.Time{
+				time.Date(2026, 3, 9, 9, 0, 0, 0, time.UTC),
+				time.Date(2026, 3, 9, 9, 5, 0, 0, time.UTC),
+			},
+		},
+		{
+			spec: "CRON_TZ=America/New_York 0 9 * * *",
+			want: []time.Time{time.Date(2026, 3, 7, 14, 0, 0, 0, time.UTC)},
+		},
+		{spec: "@every 90s", want: []time.Time{base.Add(90 * time.Second)}},
+		{spec: "0s", wantErr: "must be positive"},
+		{spec: "-5m", wantErr: "must be positive"},
+		{spec: "every tuesday", wantErr: "neither a duration nor a cron expression"},
+		{spec: "CRON_TZ=Mars/Olympus 0 3 * * *", wantErr: "neither a duration nor a cron expression"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			s, err := ParseSchedule(tt.spec)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, isCron := s.(cronSchedule); isCron && s.String() != tt.spec {
+				t.Errorf("String() = %q, want %q", s.String(), tt.spec)
+			}
+			at := base
+			for i, want := range tt.want {
+				at = s.Next(at)
+				if !at.Equal(want) {
+					t.Errorf("run %d = %v, want %v", i, at.UTC(), want)
+				}
+			}
+		})
+	}
+}
+
+func TestBuildJobs_Schedule(t *testing.T) {
+	jm := NewJobManager(nil)
+	jm.RegisterFactory(&mockFactory{typeName: "http"})
+	jm.RegisterFactory(&mockFactory{
+		typeName: "nointerval",
+		createFn: func(yaml.Node, JobOptions) (Job, error) { return &mockJob{name: "nointerval"}, nil },
+	})
+
+	if err := jm.BuildJobs(makeYAMLNodes(t,
+		"type: http",
+		"type: http\nschedule: 250ms",
+		"type: nointerval\nschedule: \"0 3 * * *\"",
+	), JobOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	for i, want := range []string{"10s", "250ms", "0 3 * * *"} {
+		if got := jm.jobs[i].schedule.String(); got != want {
+			t.Errorf("job %d schedule = %q, want %q", i, got, want)
+		}
+	}
+
+	for _, doc := range []string{"type: nointerval", "type: http\nschedule: soon"} {
+		if err := jm.BuildJobs(makeYAMLNodes(t, doc), JobOptions{}); err == nil {
+			t.Errorf("BuildJobs(%q) expected error", doc)
+		}
+	}
+}
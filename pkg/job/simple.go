@@ -11,6 +11,7 @@ package job
 import (
 	"context"
 	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptrace"
 	"net/url"
@@ -23,13 +24,14 @@ import (
 
 // SimpleJobConfig holds the configuration for a simple job.
 type SimpleJobConfig struct {
-	Name     string            `yaml:"name"`
-	URL      string            `yaml:"url"`
-	Method   string            `yaml:"method"`
-	Interval uint16            `yaml:"interval"`
-	Cookies  []cookie.Cookie   `yaml:"cookies,omitempty"`
-	Header   map[string]string `yaml:"header,omitempty"`
-	Tags     map[string]string `yaml:"tags,omitempty"`
+	Name       string              `yaml:"name"`
+	URL        string              `yaml:"url"`
+	Method     string              `yaml:"method"`
+	Interval   uint16              `yaml:"interval"`
+	Cookies    []cookie.Cookie     `yaml:"cookies,omitempty"`
+	Header     map[string]string   `yaml:"header,omitempty"`
+	Tags       map[string]string   `yaml:"tags,omitempty"`
+	Assertions *ResponseAssertions `yaml:"assertions,omitempty"`
 }
 
 // SimpleJob performs a single HTTP request and collects timing metrics.
@@ -38,10 +40,13 @@ type SimpleJob struct {
 	client    *http.Client
 	tags      map[string]string
 	userAgent string
+	checker   *responseChecker
 }
 
 func (j *SimpleJob) Name() string            { return j.config.Name }
 func (j *SimpleJob) Interval() time.Duration { return time.Duration(j.config.Interval) * time.Second }
+func (j *SimpleJob) URL() string             { return j.config.URL }
+func (j *SimpleJob) Tags() map[string]string { return j.tags }
 
 // Run executes the HTTP request and returns timing metrics.
 func (j *SimpleJob) Run(ctx context.Context) ([]Metric, []Event, error) {
@@ -91,14 +96,36 @@ func (j *SimpleJob) Run(ctx context.Context) ([]Metric, []Event, error) {
 	if err != nil {
 		return nil, nil, fmt.Errorf("executing request: %w", err)
 	}
-	resp.Body.Close()
 
+	// Measured before any body assertions read the body, so that adding
+	// them doesn't change the timings.
 	t5 := time.Now()
+
+	var body []byte
+	if j.checker != nil && j.checker.needsBody() {
+		body, err = io.ReadAll(io.LimitReader(resp.Body, j.checker.bodyLimit()))
+		if err != nil {
+			resp.Body.Close()
+			return nil, nil, fmt.Errorf("reading response body: %w", err)
+		}
+	}
+	resp.Body.Close()
+
 	if t0.IsZero() {
 		t0 = t1
 	}
 
-	events := []Event{MakeEvent(j.config.Name, resp.StatusCode, j.tags)}
+	var events []Event
+	if j.checker == nil {
+		events = []Event{MakeEvent(j.config.Name, resp.StatusCode, j.tags)}
+	} else if reason := j.checker.Check(resp.StatusCode, resp.Header, body); reason != "" {
+		events = []Event{MakeFailureEvent(j.config.Name, resp.StatusCode, reason, j.tags)}
+	} else if j.checker.checksStatus() {
+		// The status was explicitly allowed, so even a 4xx or 5xx is healthy.
+		events = []Event{MakeSuccessEvent(j.config.Name, resp.StatusCode, "", j.tags)}
+	} else {
+		events = []Event{MakeEvent(j.config.Name, resp.StatusCode, j.tags)}
+	}
 
 	u, err := url.Parse(j.config.URL)
 	if err != nil {
@@ -145,10 +172,18 @@ func (f *SimpleFactory) Create(cfg yaml.Node, opts JobOptions) (Job, error) {
 	if err := cfg.Decode(&c); err != nil {
 		return nil, fmt.Errorf("decoding simple job config: %w", err)
 	}
-	return &SimpleJob{
+	j := &SimpleJob{
 		config:    c,
 		client:    f.Client,
 		tags:      MergeTags(c.Tags, opts.GlobalTags),
 		userAgent: opts.UserAgent,
-	}, nil
+	}
+	if c.Assertions != nil {
+		checker, err := c.Assertions.compile()
+		if err != nil {
+			return nil, fmt.Errorf("simple job %q: assertions: %w", c.Name, err)
+		}
+		j.checker = checker
+	}
+	return j, nil
 }
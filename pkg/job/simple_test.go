@@ -0,0 +1,165 @@
+package job
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestSimpleFactory_Create_Assertions(t *testing.T) {
+	input := `
+type: simple
+name: homepage
+url: https://example.com
+interval: 30
+assertions:
+  status: ["2xx"]
+  body-not-contains: ["maintenance"]
+`
+	var node yaml.Node
+	if err := yaml.Unmarshal([]byte(input), &node); err != nil {
+		t.Fatal(err)
+	}
+
+	j, err := (&SimpleFactory{}).Create(*node.Content[0], JobOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if j.(*SimpleJob).checker == nil {
+		t.Fatal("expected assertions to be compiled")
+	}
+
+	bad := `
+type: simple
+name: homepage
+url: https://example.com
+assertions:
+  body-regex: ["("]
+`
+	if err := yaml.Unmarshal([]byte(bad), &node); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := (&SimpleFactory{}).Create(*node.Content[0], JobOptions{}); err == nil {
+		t.Error("expected error for invalid body-regex")
+	}
+}
+
+func TestSimpleJob_Run_Assertions(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("<h1>Down for maintenance</h1>"))
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		name       string
+		assertions *ResponseAssertions
+		wantReason string
+	}{
+		{
+			name: "no assertions",
+		},
+		{
+			name:       "passing assertions",
+			assertions: &ResponseAssertions{Status: []string{"200"}, Headers: map[string]string{"Content-Type": "text/html"}},
+		},
+		{
+			name:       "maintenance page fails",
+			assertions: &ResponseAssertions{BodyNotContains: []string{"maintenance"}},
+			wantReason: `body contains "maintenance"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			j := &SimpleJob{
+				config: SimpleJobConfig{Name: "simple-test", URL: srv.URL},
+				client: srv.Client(),
+				tags:   map[string]string{},
+			}
+			if tt.assertions != nil {
+				c, err := tt.assertions.compile()
+				if err != nil {
+					t.Fatal(err)
+				}
+				j.checker = c
+			}
+
+			metrics, events, err := j.Run(context.Background())
+			if err != nil {
+				t.Fatalf("Run() error: %v", err)
+			}
+			if len(metrics) == 0 {
+				t.Error("expected timing metrics")
+			}
+			if len(events) != 1 {
+				t.Fatalf("got %d events, want 1", len(events))
+			}
+			if events[0].ServerStatus != 200 {
+				t.Errorf("ServerStatus = %d, want 200", events[0].ServerStatus)
+			}
+			if tt.wantReason == "" && events[0].Reason != "" {
+				t.Errorf("unexpected Reason %q", events[0].Reason)
+			}
+			if !strings.Contains(events[0].Reason, tt.wantReason) {
+				t.Errorf("Reason = %q, want containing %q", events[0].Reason, tt.wantReason)
+			}
+		})
+	}
+}
+
+func TestSimpleJob_Run_AllowedStatus(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		name       string
+		assertions ResponseAssertions
+		want       Severity
+	}{
+		{
+			name:       "allowed 503",
+			assertions: ResponseAssertions{Status: []string{"503"}},
+			want:       SeverityOK,
+		},
+		{
+			name:       "503 without a status assertion",
+			assertions: ResponseAssertions{BodyContains: []string{"unavailable"}},
+			want:       SeverityCritical,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := tt.assertions.compile()
+			if err != nil {
+				t.Fatal(err)
+			}
+			j := &SimpleJob{
+				config:  SimpleJobConfig{Name: "simple-test", URL: srv.URL},
+				client:  srv.Client(),
+				tags:    map[string]string{},
+				checker: c,
+			}
+			_, events, err := j.Run(context.Background())
+			if err != nil {
+				t.Fatalf("Run() error: %v", err)
+			}
+			if len(events) != 1 {
+				t.Fatalf("got %d events, want 1", len(events))
+			}
+			if events[0].ServerStatus != http.StatusServiceUnavailable {
+				t.Errorf("ServerStatus = %d, want %d", events[0].ServerStatus, http.StatusServiceUnavailable)
+			}
+			if got := events[0].Level(); got != tt.want {
+				t.Errorf("Level() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,188 @@
+package job
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// maxTCPResponseBytes bounds how much of a TCP response is read while
+// looking for the expected banner.
+const maxTCPResponseBytes = 64 * 1024
+
+// TCPJobConfig holds the configuration for a TCP connect job.
+type TCPJobConfig struct {
+	Name     string            `yaml:"name"`
+	Host     string            `yaml:"host"`
+	Port     uint16            `yaml:"port"`
+	Interval uint16            `yaml:"interval"`
+	Timeout  string            `yaml:"timeout,omitempty"`
+	Send     string            `yaml:"send,omitempty"`
+	Expect   string            `yaml:"expect,omitempty"`
+	Tags     map[string]string `yaml:"tags,omitempty"`
+}
+
+// TCPJob dials a host:port, optionally exchanges a payload, and collects
+// DNS and connection timing metrics.
+type TCPJob struct {
+	config  TCPJobConfig
+	timeout time.Duration
+	tags    map[string]string
+}
+
+func (j *TCPJob) Name() string            { return j.config.Name }
+func (j *TCPJob) Interval() time.Duration { return time.Duration(j.config.Interval) * time.Second }
+func (j *TCPJob) Tags() map[string]string { return j.tags }
+
+// URL returns the tcp:// form of the configured address, used as the metric URL.
+func (j *TCPJob) URL() string {
+	return "tcp://" + net.JoinHostPort(j.config.Host, strconv.Itoa(int(j.config.Port)))
+}
+
+// Run resolves and dials the configured address, trying each resolved
+// address in turn. A failed connection or an unexpected response is
+// reported as a down event rather than an error.
+func (j *TCPJob) Run(ctx context.Context) ([]Metric, []Event, error) {
+	ctx, cancel := context.WithTimeout(ctx, j.timeout)
+	defer cancel()
+
+	mk := func(timing string, value float64) Metric {
+		return MakeMetric(timing, value, j.config.Name, j.URL(), j.tags)
+	}
+	down := func(metrics []Metric, reason string) ([]Metric, []Event, error) {
+		return metrics, []Event{MakeFailureEvent(j.config.Name, 0, reason, j.tags)}, nil
+	}
+
+	t0 := time.Now()
+	addrs, err := net.DefaultResolver.LookupHost(ctx, j.config.Host)
+	if err != nil {
+		return down(nil, fmt.Sprintf("dns: %v", err))
+	}
+	t1 := time.Now()
+	metrics := []Metric{mk("dns_duration_milliseconds", t1.Sub(t0).Seconds()*1000)}
+
+	conn, err := dialEach(ctx, addrs, strconv.Itoa(int(j.config.Port)))
+	if err != nil {
+		return down(metrics, fmt.Sprintf("connect: %v", err))
+	}
+	defer conn.Close()
+	t2 := time.Now()
+	metrics = append(metrics, mk("server_connection_duration_milliseconds", t2.Sub(t1).Seconds()*1000))
+
+	if j.config.Send == "" && j.config.Expect == "" {
+		return metrics, []Event{j.up("accepted a connection")}, nil
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	if j.config.Send != "" {
+		if _, err := conn.Write([]byte(j.config.Send)); err != nil {
+			return down(metrics, fmt.Sprintf("send: %v", err))
+		}
+	}
+
+	if j.config.Expect != "" {
+		if err := readUntil(conn, []byte(j.config.Expect)); err != nil {
+			return down(metrics, fmt.Sprintf("expect: %v", err))
+		}
+	}
+	t3 := time.Now()
+	metrics = append(metrics, mk("server_response_duration_milliseconds", t3.Sub(t2).Seconds()*1000))
+
+	if j.config.Expect == "" {
+		return metrics, []Event{j.up("accepted a connection")}, nil
+	}
+	return metrics, []Event{j.up("sent the expected response")}, nil
+}
+
+// up returns the ok event for a successful run, with a message saying what
+// the server did.
+func (j *TCPJob) up(did string) Event {
+	return MakeSuccessEvent(j.config.Name, 0, fmt.Sprintf("%v (%v) %v", j.config.Name, j.URL(), did), j.tags)
+}
+
+// dialEach tries addrs in order until one accepts a connection, returning
+// the first error if none does. As in net.Dialer, each attempt gets an equal
+// share of the time left, so an unreachable address can't use it all up.
+func dialEach(ctx context.Context, addrs []string, port string) (net.Conn, error) {
+	var d net.Dialer
+	var firstErr error
+	for i, addr := range addrs {
+		attemptCtx, cancel := ctx, func() {}
+		if deadline, ok := ctx.Deadline(); ok {
+			attemptCtx, cancel = context.WithTimeout(ctx, time.Until(deadline)/time.Duration(len(addrs)-i))
+		}
+		conn, err := d.DialContext(attemptCtx, "tcp", net.JoinHostPort(addr, port))
+		cancel()
+		if err == nil {
+			return conn, nil
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return nil, firstErr
+}
+
+// readUntil reads from conn until expect appears in the data received so far.
+func readUntil(conn net.Conn, expect []byte) error {
+	buf := make([]byte, 0, 4096)
+	chunk := make([]byte, 4096)
+	for len(buf) < maxTCPResponseBytes {
+		n, err := conn.Read(chunk)
+		buf = append(buf, chunk[:n]...)
+		if bytes.Contains(buf, expect) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%q not found in response: %w", expect, err)
+		}
+	}
+	return fmt.Errorf("%q not found in first %d bytes of response", expect, maxTCPResponseBytes)
+}
+
+// TCPFactory creates TCPJob instances.
+type TCPFactory struct{}
+
+func (f *TCPFactory) Type() string { return "tcp" }
+
+func (f *TCPFactory) Create(cfg yaml.Node, opts JobOptions) (Job, error) {
+	var c TCPJobConfig
+	if err := cfg.Decode(&c); err != nil {
+		return nil, fmt.Errorf("decoding tcp job config: %w", err)
+	}
+	if c.Host == "" {
+		return nil, fmt.Errorf("tcp job %q: host is required", c.Name)
+	}
+	if c.Port == 0 {
+		return nil, fmt.Errorf("tcp job %q: port is required", c.Name)
+	}
+
+	timeout := opts.RequestTimeout
+	if c.Timeout != "" {
+		d, err := time.ParseDuration(c.Timeout)
+		if err != nil {
+			return nil, fmt.Errorf("tcp job %q: parsing timeout %q: %w", c.Name, c.Timeout, err)
+		}
+		timeout = d
+	}
+	if timeout == 0 {
+		timeout = 15 * time.Second
+	}
+
+	return &TCPJob{
+		config:  c,
+		timeout: timeout,
+		tags:    MergeTags(c.Tags, opts.GlobalTags),
+	}, nil
+}
@@ -0,0 +1,271 @@
+package job
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestTCPFactory_Type(t *testing.T) {
+	f := &TCPFactory{}
+	if got := f.Type(); got != "tcp" {
+		t.Errorf("Type() = %q, want %q", got, "tcp")
+	}
+}
+
+func TestTCPFactory_Create(t *testing.T) {
+	tests := []struct {
+		name        string
+		input       string
+		wantErr     string
+		wantTimeout time.Duration
+	}{
+		{
+			name: "valid config uses request timeout",
+			input: `
+type: tcp
+name: postgres
+host: db.example.com
+port: 5432
+interval: 30
+`,
+			wantTimeout: 5 * time.Second,
+		},
+		{
+			name: "job timeout overrides request timeout",
+			input: `
+type: tcp
+name: ssh
+host: bastion.example.com
+port: 22
+interval: 30
+timeout: 2s
+expect: SSH-2.0
+`,
+			wantTimeout: 2 * time.Second,
+		},
+		{
+			name: "missing host",
+			input: `
+type: tcp
+name: nohost
+port: 22
+`,
+			wantErr: "host is required",
+		},
+		{
+			name: "missing port",
+			input: `
+type: tcp
+name: noport
+host: example.com
+`,
+			wantErr: "port is required",
+		},
+		{
+			name: "invalid timeout",
+			input: `
+type: tcp
+name: badtimeout
+host: example.com
+port: 22
+timeout: soon
+`,
+			wantErr: "parsing timeout",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var node yaml.Node
+			if err := yaml.Unmarshal([]byte(tt.input), &node); err != nil {
+				t.Fatal(err)
+			}
+
+			f := &TCPFactory{}
+			j, err := f.Create(*node.Content[0], JobOptions{RequestTimeout: 5 * time.Second})
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := j.(*TCPJob).timeout; got != tt.wantTimeout {
+				t.Errorf("timeout = %v, want %v", got, tt.wantTimeout)
+			}
+		})
+	}
+}
+
+// startTCPServer starts a listener that runs handler for every connection.
+func startTCPServer(t *testing.T, handler func(net.Conn)) (string, uint16) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				handler(conn)
+			}()
+		}
+	}()
+
+	addr := ln.Addr().(*net.TCPAddr)
+	return addr.IP.String(), uint16(addr.Port)
+}
+
+func newTestTCPJob(host string, port uint16, send, expect string) *TCPJob {
+	return &TCPJob{
+		config: TCPJobConfig{
+			Name:   "tcp-test",
+			Host:   host,
+			Port:   port,
+			Send:   send,
+			Expect: expect,
+		},
+		timeout: 2 * time.Second,
+		tags:    map[string]string{},
+	}
+}
+
+func TestTCPJob_Run(t *testing.T) {
+	host, port := startTCPServer(t, func(conn net.Conn) {
+		conn.Write([]byte("+OK ready\r\n"))
+		line, err := bufio.NewReader(conn).ReadString('\n')
+		if err != nil {
+			return
+		}
+		if line == "PING\r\n" {
+			conn.Write([]byte("+PONG\r\n"))
+		}
+	})
+
+	tests := []struct {
+		name        string
+		send        string
+		expect      string
+		wantStatus  int
+		wantReason  string
+		wantMetrics int
+	}{
+		{
+			name:        "connect only",
+			wantStatus:  0,
+			wantMetrics: 2,
+		},
+		{
+			name:        "banner matches",
+			expect:      "+OK",
+			wantStatus:  0,
+			wantMetrics: 3,
+		},
+		{
+			name:        "send and expect response",
+			send:        "PING\r\n",
+			expect:      "+PONG",
+			wantStatus:  0,
+			wantMetrics: 3,
+		},
+		{
+			name:        "unexpected response",
+			send:        "QUIT\r\n",
+			expect:      "+PONG",
+			wantStatus:  0,
+			wantReason:  "expect:",
+			wantMetrics: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			j := newTestTCPJob(host, port, tt.send, tt.expect)
+			metrics, events, err := j.Run(context.Background())
+			if err != nil {
+				t.Fatalf("Run() error: %v", err)
+			}
+			if len(metrics) != tt.wantMetrics {
+				t.Errorf("got %d metrics, want %d", len(metrics), tt.wantMetrics)
+			}
+			if len(events) != 1 {
+				t.Fatalf("got %d events, want 1", len(events))
+			}
+			if events[0].ServerStatus != tt.wantStatus {
+				t.Errorf("ServerStatus = %d, want %d", events[0].ServerStatus, tt.wantStatus)
+			}
+			if !strings.HasPrefix(events[0].Reason, tt.wantReason) {
+				t.Errorf("Reason = %q, want prefix %q", events[0].Reason, tt.wantReason)
+			}
+			if got, want := events[0].Failed(), tt.wantReason != ""; got != want {
+				t.Errorf("Failed() = %v, want %v", got, want)
+			}
+			if tt.wantReason == "" && !strings.HasPrefix(events[0].Message, "tcp-test (tcp://") {
+				t.Errorf("Message = %q, want a description of the connection", events[0].Message)
+			}
+			for _, m := range metrics {
+				if m.URL != j.URL() {
+					t.Errorf("metric URL = %q, want %q", m.URL, j.URL())
+				}
+			}
+		})
+	}
+}
+
+func TestTCPJob_Run_ConnectionRefused(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := uint16(ln.Addr().(*net.TCPAddr).Port)
+	ln.Close()
+
+	j := newTestTCPJob("127.0.0.1", port, "", "")
+	metrics, events, err := j.Run(context.Background())
+	if err != nil {
+		t.Fatalf("Run() error: %v", err)
+	}
+	if len(metrics) != 1 || metrics[0].Timing != "dns_duration_milliseconds" {
+		t.Errorf("expected only the DNS metric, got %+v", metrics)
+	}
+	if len(events) != 1 || events[0].ServerStatus != 0 {
+		t.Fatalf("expected one down event, got %+v", events)
+	}
+	if !strings.HasPrefix(events[0].Reason, "connect:") {
+		t.Errorf("Reason = %q, want prefix %q", events[0].Reason, "connect:")
+	}
+}
+
+func TestDialEach(t *testing.T) {
+	host, port := startTCPServer(t, func(net.Conn) {})
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	portStr := strconv.Itoa(int(port))
+
+	// Nothing listens on 127.0.0.2, so the first address is refused.
+	conn, err := dialEach(ctx, []string{"127.0.0.2", host}, portStr)
+	if err != nil {
+		t.Fatalf("dialEach() error = %v", err)
+	}
+	conn.Close()
+
+	if _, err := dialEach(ctx, []string{"127.0.0.2", "127.0.0.3"}, portStr); err == nil || !strings.Contains(err.Error(), "127.0.0.2") {
+		t.Errorf("dialEach() error = %v, want the first address's error", err)
+	}
+}
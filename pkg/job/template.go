@@ -4,21 +4,28 @@ import (
 	"encoding/json"
 	"fmt"
 	"regexp"
+	"strconv"
 	"strings"
+	"unicode"
 )
 
 // StepResponses maps step names to their raw JSON response bodies.
 type StepResponses = map[string]json.RawMessage
 
-var placeholderRegex = regexp.MustCompile(`\{\{\s*([\w.]+)\s*\}\}`)
+// placeholderRegex matches a {{ }} placeholder. Braces may only appear
+// inside quoted strings, so {{ "{{" }} produces a literal {{.
+var placeholderRegex = regexp.MustCompile(`\{\{\s*((?:"(?:[^"\\]|\\.)*"|` + "`[^`]*`" + `|[^{}])+?)\s*\}\}`)
 
 const maxJSONDepth = 20
 
-// TemplateEngine resolves {{ step.field }} placeholders against step responses.
+// TemplateEngine resolves {{ }} placeholders against step responses. A
+// placeholder holds either a reference to a prior step's response, such as
+// {{ login.token }} or {{ list.items[?name=="foo"].id }}, or a function call
+// such as {{ uuid }} or {{ env "API_KEY" | base64 }}. See templateFuncs for
+// the available functions.
 type TemplateEngine struct{}
 
-// Resolve replaces all {{ step.field }} placeholders in template with values
-// looked up from responses.
+// Resolve replaces all placeholders in template with their values.
 func (te *TemplateEngine) Resolve(template string, responses StepResponses) (string, error) {
 	matches := placeholderRegex.FindAllStringSubmatchIndex(template, -1)
 	if len(matches) == 0 {
@@ -34,7 +41,11 @@ func (te *TemplateEngine) Resolve(template string, responses StepResponses) (str
 		b.WriteString(template[prev:loc[0]])
 
 		key := template[loc[2]:loc[3]]
-		val, err := getResponseValue(key, responses, 0)
+		expr, err := parseTemplateExpr(key)
+		if err != nil {
+			return "", fmt.Errorf("parsing %q: %w", key, err)
+		}
+		val, err := expr.eval(responses)
 		if err != nil {
 			return "", fmt.Errorf("resolving %q: %w", key, err)
 		}
@@ -46,20 +57,277 @@ func (te *TemplateEngine) Resolve(template string, responses StepResponses) (str
 	return b.String(), nil
 }
 
-// getResponseValue walks into nested JSON using dot-separated keys.
-// depth prevents stack overflow on pathological input.
+// Validate checks the syntax of every placeholder in template without
+// evaluating it, so that mistakes are reported when the config is loaded.
+func (te *TemplateEngine) Validate(template string) error {
+	for _, m := range placeholderRegex.FindAllStringSubmatch(template, -1) {
+		if _, err := parseTemplateExpr(m[1]); err != nil {
+			return fmt.Errorf("parsing %q: %w", m[1], err)
+		}
+	}
+	return nil
+}
+
+// templateExpr is a parsed placeholder expression.
+type templateExpr interface {
+	eval(responses StepResponses) (string, error)
+}
+
+// literalExpr is a quoted string argument.
+type literalExpr string
+
+func (e literalExpr) eval(StepResponses) (string, error) { return string(e), nil }
+
+// refExpr is a reference to a step response or extracted variable.
+type refExpr string
+
+func (e refExpr) eval(responses StepResponses) (string, error) {
+	return getResponseValue(string(e), responses, 0)
+}
+
+// callExpr is a function call. Piped values are appended to args.
+type callExpr struct {
+	name string
+	fn   templateFunc
+	args []templateExpr
+}
+
+func (e *callExpr) eval(responses StepResponses) (string, error) {
+	args := make([]string, len(e.args))
+	for i, a := range e.args {
+		v, err := a.eval(responses)
+		if err != nil {
+			return "", err
+		}
+		args[i] = v
+	}
+	v, err := e.fn.fn(args)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", e.name, err)
+	}
+	return v, nil
+}
+
+// checkArity reports whether the call has an acceptable number of arguments.
+func (e *callExpr) checkArity() error {
+	n := len(e.args)
+	if n >= e.fn.minArgs && n <= e.fn.maxArgs {
+		return nil
+	}
+	want := strconv.Itoa(e.fn.minArgs)
+	if e.fn.maxArgs != e.fn.minArgs {
+		want += " or " + strconv.Itoa(e.fn.maxArgs)
+	}
+	noun := "arguments"
+	if e.fn.maxArgs == 1 {
+		noun = "argument"
+	}
+	return fmt.Errorf("%s expects %s %s, got %d", e.name, want, noun, n)
+}
+
+// exprParser is a recursive-descent parser for placeholder expressions:
+//
+//	pipeline := command ("|" command)*
+//	command  := operand | function operand*
+//	operand  := "string" | reference | function | "(" pipeline ")"
+//
+// The value of each pipeline stage is passed as the last argument of the
+// next, as in Go templates.
+type exprParser struct {
+	src string
+	pos int
+}
+
+func parseTemplateExpr(src string) (templateExpr, error) {
+	p := &exprParser{src: src}
+	e, err := p.pipeline()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok != "" {
+		return nil, fmt.Errorf("unexpected %q", tok)
+	}
+	return e, nil
+}
+
+func (p *exprParser) pipeline() (templateExpr, error) {
+	e, err := p.command()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == "|" {
+		p.next()
+		stage, err := p.command()
+		if err != nil {
+			return nil, err
+		}
+		call, ok := stage.(*callExpr)
+		if !ok {
+			return nil, fmt.Errorf("cannot pipe into %v: not a function", stage)
+		}
+		if prev, ok := e.(*callExpr); ok {
+			if err := prev.checkArity(); err != nil {
+				return nil, err
+			}
+		}
+		call.args = append(call.args, e)
+		e = call
+	}
+	if call, ok := e.(*callExpr); ok {
+		return e, call.checkArity()
+	}
+	return e, nil
+}
+
+func (p *exprParser) command() (templateExpr, error) {
+	tok := p.peek()
+	fn, isFunc := templateFuncs[tok]
+	if !isFunc {
+		e, err := p.operand()
+		if err != nil {
+			return nil, err
+		}
+		if next := p.peek(); next != "" && next != "|" && next != ")" {
+			return nil, fmt.Errorf("unexpected %q after %s", next, tok)
+		}
+		return e, nil
+	}
+	p.next()
+	call := &callExpr{name: tok, fn: fn}
+	for {
+		next := p.peek()
+		if next == "" || next == "|" || next == ")" {
+			return call, nil
+		}
+		arg, err := p.operand()
+		if err != nil {
+			return nil, err
+		}
+		call.args = append(call.args, arg)
+	}
+}
+
+func (p *exprParser) operand() (templateExpr, error) {
+	tok := p.next()
+	switch {
+	case tok == "":
+		return nil, fmt.Errorf("unexpected end of expression")
+	case tok == "(":
+		e, err := p.pipeline()
+		if err != nil {
+			return nil, err
+		}
+		if p.next() != ")" {
+			return nil, fmt.Errorf("missing ')'")
+		}
+		return e, nil
+	case tok == ")" || tok == "|":
+		return nil, fmt.Errorf("unexpected %q", tok)
+	case tok[0] == '"' || tok[0] == '`':
+		s, err := strconv.Unquote(tok)
+		if err != nil {
+			return nil, fmt.Errorf("invalid string %s", tok)
+		}
+		return literalExpr(s), nil
+	}
+	if fn, ok := templateFuncs[tok]; ok {
+		call := &callExpr{name: tok, fn: fn}
+		return call, call.checkArity()
+	}
+	segs, err := parseSegments(tok)
+	if err != nil {
+		return nil, err
+	}
+	if segs[0].kind != segKey {
+		return nil, fmt.Errorf("reference %q must start with a step name", tok)
+	}
+	return refExpr(tok), nil
+}
+
+// peek returns the next token without consuming it, or "" at the end.
+func (p *exprParser) peek() string {
+	pos := p.pos
+	tok := p.next()
+	p.pos = pos
+	return tok
+}
+
+// next consumes and returns the next token: a quoted string, a parenthesis,
+// a pipe, or a word. Words may contain bracketed path segments with spaces
+// and quotes, such as items[?name == "a b"].
+func (p *exprParser) next() string {
+	s := p.src
+	for p.pos < len(s) && unicode.IsSpace(rune(s[p.pos])) {
+		p.pos++
+	}
+	if p.pos >= len(s) {
+		return ""
+	}
+	start := p.pos
+	switch c := s[p.pos]; c {
+	case '(', ')', '|':
+		p.pos++
+		return s[start:p.pos]
+	case '"', '`':
+		if q, err := strconv.QuotedPrefix(s[p.pos:]); err == nil {
+			p.pos += len(q)
+			return q
+		}
+		// Let operand report the unterminated string.
+		p.pos = len(s)
+		return s[start:]
+	}
+	depth := 0
+	var quote byte
+	for ; p.pos < len(s); p.pos++ {
+		c := s[p.pos]
+		switch {
+		case quote != 0:
+			if c == '\\' {
+				p.pos++
+			} else if c == quote {
+				quote = 0
+			}
+		case depth > 0 && (c == '"' || c == '\''):
+			quote = c
+		case c == '[':
+			depth++
+		case c == ']':
+			depth--
+		case depth == 0 && (unicode.IsSpace(rune(c)) || c == '(' || c == ')' || c == '|'):
+			return s[start:p.pos]
+		}
+	}
+	return s[start:]
+}
+
+// getResponseValue resolves a placeholder path such as step.items[0].id
+// against the step responses. The first segment names the step; the rest
+// are evaluated against its decoded JSON body using the same syntax as
+// assertion paths: dot keys, numeric or [N] indexes (negative counts from
+// the end), [*] wildcards and [?field == value] filters. A wildcard or
+// filter matching a single element renders that element; otherwise the
+// matches render as a JSON array. Strings are rendered unquoted. depth
+// counts segments already consumed by the caller.
 func getResponseValue(key string, m map[string]json.RawMessage, depth int) (string, error) {
-	if depth >= maxJSONDepth {
+	segs, err := parseSegments(strings.TrimSpace(key))
+	if err != nil {
+		return "", err
+	}
+	if len(segs) == 0 || segs[0].kind != segKey {
+		return "", fmt.Errorf("placeholder must start with a step name")
+	}
+	if depth+len(segs)-1 >= maxJSONDepth {
 		return "", fmt.Errorf("max JSON nesting depth (%d) exceeded", maxJSONDepth)
 	}
 
-	parts := strings.SplitN(key, ".", 2)
-	value, ok := m[parts[0]]
+	name := segs[0].key
+	value, ok := m[name]
 	if !ok {
-		return "", fmt.Errorf("step %q not found in responses", parts[0])
+		return "", fmt.Errorf("step %q not found in responses", name)
 	}
 
-	if len(parts) == 1 {
+	if len(segs) == 1 {
 		// Trim surrounding quotes from JSON string values
 		s := string(value)
 		if len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"' {
@@ -72,9 +340,25 @@ func getResponseValue(key string, m map[string]json.RawMessage, depth int) (stri
 		return s, nil
 	}
 
-	var submap map[string]json.RawMessage
-	if err := json.Unmarshal(value, &submap); err != nil {
-		return "", fmt.Errorf("field %q is not a JSON object: %w", parts[0], err)
+	doc, err := decodeJSON(value)
+	if err != nil {
+		return "", fmt.Errorf("response of %q is not valid JSON: %w", name, err)
+	}
+	v, projected, err := walkPath(doc, segs[1:], name)
+	if err != nil {
+		return "", err
+	}
+	if projected {
+		matches := v.([]any)
+		switch len(matches) {
+		case 0:
+			return "", fmt.Errorf("at %s: no elements matched", key)
+		case 1:
+			v = matches[0]
+		}
+	}
+	if s, ok := v.(string); ok {
+		return s, nil
 	}
-	return getResponseValue(parts[1], submap, depth+1)
+	return compactJSON(v), nil
 }
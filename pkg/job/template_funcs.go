@@ -0,0 +1,76 @@
+package job
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// templateFunc is a function callable from a {{ }} placeholder.
+type templateFunc struct {
+	minArgs, maxArgs int
+	fn               func(args []string) (string, error)
+}
+
+// templateFuncs is the set of functions available in placeholders. A bare
+// name that matches a function is a call, not a step reference.
+var templateFuncs = map[string]templateFunc{
+	// uuid returns a random (version 4) UUID.
+	"uuid": {0, 0, func([]string) (string, error) {
+		return uuid.NewString(), nil
+	}},
+	// now returns the current UTC time as RFC 3339, or in the given Go
+	// time layout.
+	"now": {0, 1, func(args []string) (string, error) {
+		layout := time.RFC3339
+		if len(args) == 1 {
+			layout = args[0]
+		}
+		return time.Now().UTC().Format(layout), nil
+	}},
+	// unixMillis returns the current Unix time in milliseconds.
+	"unixMillis": {0, 0, func([]string) (string, error) {
+		return strconv.FormatInt(time.Now().UnixMilli(), 10), nil
+	}},
+	// env returns the value of an environment variable, which must be set.
+	"env": {1, 1, func(args []string) (string, error) {
+		v, ok := os.LookupEnv(args[0])
+		if !ok {
+			return "", fmt.Errorf("environment variable %q is not set", args[0])
+		}
+		return v, nil
+	}},
+	// file returns the contents of a file with any trailing newline removed,
+	// so that secrets written by editors or `echo` can be used as-is.
+	"file": {1, 1, func(args []string) (string, error) {
+		data, err := os.ReadFile(args[0])
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimRight(string(data), "\r\n"), nil
+	}},
+	// base64 returns the standard base64 encoding of its argument.
+	"base64": {1, 1, func(args []string) (string, error) {
+		return base64.StdEncoding.EncodeToString([]byte(args[0])), nil
+	}},
+	// sha256 returns the hex-encoded SHA-256 digest of its argument.
+	"sha256": {1, 1, func(args []string) (string, error) {
+		sum := sha256.Sum256([]byte(args[0]))
+		return hex.EncodeToString(sum[:]), nil
+	}},
+	// hmacSHA256 returns the hex-encoded HMAC-SHA256 of a message with a key.
+	// The key comes first so that the message can be piped in.
+	"hmacSHA256": {2, 2, func(args []string) (string, error) {
+		mac := hmac.New(sha256.New, []byte(args[0]))
+		mac.Write([]byte(args[1]))
+		return hex.EncodeToString(mac.Sum(nil)), nil
+	}},
+}
@@ -0,0 +1,139 @@
+package job
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTemplateEngine_Resolve_Functions(t *testing.T) {
+	t.Setenv("CRABBY_TEST_USER", "probe")
+	t.Setenv("CRABBY_TEST_SECRET", "key")
+
+	secret := filepath.Join(t.TempDir(), "secret")
+	if err := os.WriteFile(secret, []byte("s3cret\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	te := &TemplateEngine{}
+	responses := StepResponses{
+		"login": json.RawMessage(`{"token":"abc123","user":{"name":"test"}}`),
+	}
+
+	tests := []struct {
+		name     string
+		template string
+		want     string
+		wantErr  string
+	}{
+		{name: "env", template: `user={{ env "CRABBY_TEST_USER" }}`, want: "user=probe"},
+		{name: "file_trims_newline", template: `{{ file "` + secret + `" }}`, want: "s3cret"},
+		{name: "base64", template: `{{ base64 "probe:secret" }}`, want: "cHJvYmU6c2VjcmV0"},
+		{name: "pipe", template: `{{ env "CRABBY_TEST_USER" | base64 }}`, want: "cHJvYmU="},
+		{name: "sha256", template: `{{ sha256 "" }}`, want: "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"},
+		{
+			name:     "hmac_with_pipe",
+			template: `{{ "The quick brown fox jumps over the lazy dog" | hmacSHA256 "key" }}`,
+			want:     "f7bc83f430538424b13298e6aa6fb143ef4d59a14946175997479dbc2d1a3cd8",
+		},
+		{
+			name:     "nested_call",
+			template: `{{ hmacSHA256 (env "CRABBY_TEST_SECRET") "The quick brown fox jumps over the lazy dog" }}`,
+			want:     "f7bc83f430538424b13298e6aa6fb143ef4d59a14946175997479dbc2d1a3cd8",
+		},
+		{name: "reference_argument", template: `{{ login.user.name | base64 }}`, want: "dGVzdA=="},
+		{name: "mixed_with_references", template: `{{ login.token }}:{{ base64 login.token }}`, want: "abc123:YWJjMTIz"},
+		{name: "raw_string", template: "{{ now `2006` }}", want: strconv.Itoa(time.Now().UTC().Year())},
+		{name: "unset_env", template: `{{ env "CRABBY_TEST_UNSET" }}`, wantErr: `env: environment variable "CRABBY_TEST_UNSET" is not set`},
+		{name: "missing_file", template: `{{ file "/nonexistent/secret" }}`, wantErr: "file: open /nonexistent/secret"},
+		{name: "too_few_args", template: `{{ hmacSHA256 "key" }}`, wantErr: "hmacSHA256 expects 2 arguments, got 1"},
+		{name: "too_many_args", template: `{{ uuid "x" }}`, wantErr: "uuid expects 0 arguments, got 1"},
+		{name: "pipe_into_reference", template: `{{ uuid | login.token }}`, wantErr: "not a function"},
+		{name: "unterminated_string", template: `{{ env "USER }}`, wantErr: "invalid string"},
+		{name: "unbalanced_paren", template: `{{ base64 (env "X" }}`, wantErr: "missing ')'"},
+		{name: "trailing_tokens", template: `{{ login.token login.user }}`, wantErr: `unexpected "login.user"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := te.Resolve(tt.template, responses)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTemplateEngine_Resolve_DynamicFunctions(t *testing.T) {
+	te := &TemplateEngine{}
+
+	tests := []struct {
+		template string
+		pattern  string
+	}{
+		{template: "{{ uuid }}", pattern: `^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`},
+		{template: "{{ now }}", pattern: `^\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}Z$`},
+		{template: "{{ unixMillis }}", pattern: `^\d{13}$`},
+		{template: "{{ sha256 uuid }}", pattern: `^[0-9a-f]{64}$`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.template, func(t *testing.T) {
+			got, err := te.Resolve(tt.template, nil)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !regexp.MustCompile(tt.pattern).MatchString(got) {
+				t.Errorf("got %q, want match for %s", got, tt.pattern)
+			}
+		})
+	}
+
+	a, _ := te.Resolve("{{ uuid }}", nil)
+	b, _ := te.Resolve("{{ uuid }}", nil)
+	if a == b {
+		t.Errorf("uuid returned %q twice", a)
+	}
+}
+
+func TestTemplateEngine_Validate(t *testing.T) {
+	te := &TemplateEngine{}
+	valid := []string{
+		"",
+		"no placeholders",
+		"{{ login.token }}",
+		`{{ list.items[?name == "a b"].id }}`,
+		`{{ env "KEY" | base64 }} {{ now "2006-01-02" }}`,
+	}
+	for _, s := range valid {
+		if err := te.Validate(s); err != nil {
+			t.Errorf("Validate(%q) error: %v", s, err)
+		}
+	}
+
+	invalid := []string{
+		"{{ env }}",
+		"{{ login.items[x] }}",
+		`{{ base64 "a" "b" }}`,
+		"{{ | base64 }}",
+	}
+	for _, s := range invalid {
+		if err := te.Validate(s); err == nil {
+			t.Errorf("Validate(%q) expected error", s)
+		}
+	}
+}
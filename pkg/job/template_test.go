@@ -19,6 +19,10 @@ func TestPlaceholderRegex(t *testing.T) {
 		{"no_match_empty_braces", "{{}}", nil},
 		{"no_match_single_brace", "{login.token}", nil},
 		{"nested_dots", "{{a.b.c.d}}", []string{"{{a.b.c.d}}"}},
+		{"index", "{{ a.items[0].id }}", []string{"{{ a.items[0].id }}"}},
+		{"filter", `{{ a.items[?name=="foo"].id }}`, []string{`{{ a.items[?name=="foo"].id }}`}},
+		{"quoted_braces", `{{ "{{ user }}" }}`, []string{`{{ "{{ user }}" }}`}},
+		{"raw_quoted_braces", "{{ `}}` }}", []string{"{{ `}}` }}"}},
 	}
 
 	for _, tt := range tests {
@@ -60,6 +64,11 @@ func TestTemplateEngine_Resolve(t *testing.T) {
 			template: "Bearer {{ login.token }}",
 			want:     "Bearer abc123",
 		},
+		{
+			name:     "escaped_placeholder",
+			template: `{"greeting": "{{ "{{ user.name }}" }}", "id": {{ login.user.id }}}`,
+			want:     `{"greeting": "{{ user.name }}", "id": 42}`,
+		},
 		{
 			name:     "nested_field",
 			template: "user={{ login.user.id }}",
@@ -131,6 +140,73 @@ func TestTemplateEngine_Resolve(t *testing.T) {
 	}
 }
 
+func TestTemplateEngine_Resolve_Arrays(t *testing.T) {
+	te := &TemplateEngine{}
+	responses := StepResponses{
+		"login": json.RawMessage(`{"items":[{"id":7,"name":"foo","tags":["a"]},{"id":8,"name":"bar","tags":["b","c"]}]}`),
+		"repos": json.RawMessage(`[{"name":"go"},{"name":"tools"}]`),
+	}
+
+	tests := []struct {
+		name     string
+		template string
+		want     string
+		wantErr  string
+	}{
+		{name: "dot_index", template: "{{ login.items.0.id }}", want: "7"},
+		{name: "bracket_index", template: "{{ login.items[1].name }}", want: "bar"},
+		{name: "negative_index", template: "{{ login.items[-1].id }}", want: "8"},
+		{name: "top_level_array", template: "/repos/{{ repos.0.name }}", want: "/repos/go"},
+		{name: "wildcard", template: "{{ login.items[*].id }}", want: "[7,8]"},
+		{name: "filter_single_match", template: `{{ login.items[?name=="foo"].id }}`, want: "7"},
+		{name: "filter_unwraps_string", template: `{{ login.items[?id > 7].name }}`, want: "bar"},
+		{name: "filter_keeps_array_value", template: `{{ login.items[?name=="bar"].tags }}`, want: `["b","c"]`},
+		{
+			name:     "index_out_of_range",
+			template: "{{ login.items[5].id }}",
+			wantErr:  `at login.items[5]: index 5 out of range (array has 2 elements)`,
+		},
+		{
+			name:     "key_on_array",
+			template: "{{ login.items.id }}",
+			wantErr:  `at login.items.id: cannot look up key "id" in an array`,
+		},
+		{
+			name:     "missing_field_in_element",
+			template: "{{ login.items[0].owner }}",
+			wantErr:  `at login.items[0].owner: key "owner" not found`,
+		},
+		{
+			name:     "filter_no_match",
+			template: `{{ login.items[?name=="qux"].id }}`,
+			wantErr:  "no elements matched",
+		},
+		{
+			name:     "bad_syntax",
+			template: "{{ login.items[x] }}",
+			wantErr:  "segment [x]",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := te.Resolve(tt.template, responses)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
 func TestTemplateEngine_Resolve_PercentInResponseData(t *testing.T) {
 	te := &TemplateEngine{}
 	responses := StepResponses{
@@ -221,6 +297,11 @@ func TestValidateStepNames(t *testing.T) {
 			steps:   []JobStep{{Name: "a"}, {Name: ""}},
 			wantErr: "name is required",
 		},
+		{
+			name:    "function_name",
+			steps:   []JobStep{{Name: "login"}, {Name: "now"}},
+			wantErr: `step 1: name "now" collides with a template function`,
+		},
 	}
 
 	for _, tt := range tests {
@@ -0,0 +1,242 @@
+package job
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"math"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// tlsVersions maps config strings to crypto/tls version constants.
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// TLSJobConfig holds the configuration for a TLS certificate job.
+type TLSJobConfig struct {
+	Name              string            `yaml:"name"`
+	Host              string            `yaml:"host"`
+	Port              uint16            `yaml:"port,omitempty"`
+	ServerName        string            `yaml:"server-name,omitempty"`
+	Interval          uint16            `yaml:"interval"`
+	Timeout           string            `yaml:"timeout,omitempty"`
+	CaCert            string            `yaml:"ca-cert,omitempty"`
+	ExpiryWarningDays uint              `yaml:"expiry-warning-days,omitempty"`
+	MinVersion        string            `yaml:"min-version,omitempty"`
+	Tags              map[string]string `yaml:"tags,omitempty"`
+}
+
+// TLSJob performs a TLS handshake and inspects the presented certificate chain.
+type TLSJob struct {
+	config     TLSJobConfig
+	rootCAs    *x509.CertPool
+	minVersion uint16
+	timeout    time.Duration
+	tags       map[string]string
+}
+
+func (j *TLSJob) Name() string            { return j.config.Name }
+func (j *TLSJob) Interval() time.Duration { return time.Duration(j.config.Interval) * time.Second }
+func (j *TLSJob) Tags() map[string]string { return j.tags }
+
+// URL returns the tls:// form of the configured address, used as the metric URL.
+func (j *TLSJob) URL() string {
+	return "tls://" + net.JoinHostPort(j.config.Host, strconv.Itoa(int(j.config.Port)))
+}
+
+// Run handshakes with the configured host and reports certificate expiry,
+// chain depth and handshake timing. Expiry within the warning window, a
+// hostname mismatch, an untrusted chain, or a TLS version below the
+// configured minimum produce a failure event, which has warning severity if
+// the coming expiry is the only problem.
+func (j *TLSJob) Run(ctx context.Context) ([]Metric, []Event, error) {
+	ctx, cancel := context.WithTimeout(ctx, j.timeout)
+	defer cancel()
+
+	mk := func(timing string, value float64) Metric {
+		return MakeMetric(timing, value, j.config.Name, j.URL(), j.tags)
+	}
+	down := func(metrics []Metric, reason string) ([]Metric, []Event, error) {
+		return metrics, []Event{MakeFailureEvent(j.config.Name, 0, reason, j.tags)}, nil
+	}
+
+	var d net.Dialer
+	t0 := time.Now()
+	rawConn, err := d.DialContext(ctx, "tcp", net.JoinHostPort(j.config.Host, strconv.Itoa(int(j.config.Port))))
+	if err != nil {
+		return down(nil, fmt.Sprintf("connect: %v", err))
+	}
+	defer rawConn.Close()
+	t1 := time.Now()
+
+	// Verification is done by hand after the handshake so that each kind of
+	// failure can be reported separately. Every version is offered, so that
+	// a server stuck on an old one is reported as such rather than failing
+	// the handshake.
+	conn := tls.Client(rawConn, &tls.Config{
+		ServerName:         j.config.ServerName,
+		InsecureSkipVerify: true,
+		MinVersion:         tls.VersionTLS10,
+	})
+	if err := conn.HandshakeContext(ctx); err != nil {
+		return down(nil, fmt.Sprintf("handshake: %v", err))
+	}
+	t2 := time.Now()
+	state := conn.ConnectionState()
+
+	var problems []string
+	// expiring is set if the certificate expires within the warning window,
+	// which on its own is only a warning.
+	var expiring bool
+	chain := state.PeerCertificates
+	leaf := chain[0]
+
+	intermediates := x509.NewCertPool()
+	for _, c := range chain[1:] {
+		intermediates.AddCert(c)
+	}
+	verified, err := leaf.Verify(x509.VerifyOptions{
+		Roots:         j.rootCAs,
+		Intermediates: intermediates,
+	})
+	if err != nil {
+		problems = append(problems, fmt.Sprintf("untrusted chain: %v", err))
+	} else {
+		chain = verified[0]
+	}
+
+	if err := leaf.VerifyHostname(j.config.ServerName); err != nil {
+		problems = append(problems, fmt.Sprintf("hostname mismatch: %v", err))
+	}
+
+	if state.Version < j.minVersion {
+		problems = append(problems, fmt.Sprintf("TLS version %s below minimum %s",
+			tls.VersionName(state.Version), tls.VersionName(j.minVersion)))
+	}
+
+	// The chain is only as good as its earliest-expiring certificate.
+	earliest := leaf
+	for _, c := range chain {
+		if c.NotAfter.Before(earliest.NotAfter) {
+			earliest = c
+		}
+	}
+	expiryDays := time.Until(earliest.NotAfter).Hours() / 24
+	switch {
+	case expiryDays <= 0:
+		problems = append(problems, fmt.Sprintf("certificate %q expired on %s",
+			earliest.Subject.CommonName, earliest.NotAfter.Format(time.RFC3339)))
+	case expiryDays <= float64(j.config.ExpiryWarningDays):
+		problems = append(problems, fmt.Sprintf("certificate %q expires in %d days",
+			earliest.Subject.CommonName, int(math.Floor(expiryDays))))
+		expiring = true
+	}
+
+	metrics := []Metric{
+		mk("server_connection_duration_milliseconds", t1.Sub(t0).Seconds()*1000),
+		mk("tls_handshake_duration_milliseconds", t2.Sub(t1).Seconds()*1000),
+		mk("cert_expiry_days", expiryDays),
+		mk("cert_chain_depth", float64(len(chain))),
+	}
+
+	if len(problems) == 1 && expiring {
+		e := MakeFailureEvent(j.config.Name, 0, problems[0], j.tags)
+		e.Severity = SeverityWarning
+		return metrics, []Event{e}, nil
+	}
+	if len(problems) > 0 {
+		return down(metrics, strings.Join(problems, "; "))
+	}
+	message := fmt.Sprintf("%v (%v) presented a valid certificate over %s, expiring in %d days",
+		j.config.Name, j.URL(), tls.VersionName(state.Version), int(math.Floor(expiryDays)))
+	return metrics, []Event{MakeSuccessEvent(j.config.Name, 0, message, j.tags)}, nil
+}
+
+// loadCertPool returns the system cert pool with the PEM certificates in
+// caCert appended. An empty caCert returns the system pool unchanged.
+func loadCertPool(caCert string) (*x509.CertPool, error) {
+	rootCAs, err := x509.SystemCertPool()
+	if err != nil {
+		return nil, fmt.Errorf("loading system cert pool: %w", err)
+	}
+	if caCert == "" {
+		return rootCAs, nil
+	}
+	certs, err := os.ReadFile(caCert)
+	if err != nil {
+		return nil, fmt.Errorf("reading ca-cert from %s: %w", caCert, err)
+	}
+	if !rootCAs.AppendCertsFromPEM(certs) {
+		return nil, fmt.Errorf("no certificates found in %s", caCert)
+	}
+	return rootCAs, nil
+}
+
+// TLSFactory creates TLSJob instances.
+type TLSFactory struct{}
+
+func (f *TLSFactory) Type() string { return "tls" }
+
+func (f *TLSFactory) Create(cfg yaml.Node, opts JobOptions) (Job, error) {
+	var c TLSJobConfig
+	if err := cfg.Decode(&c); err != nil {
+		return nil, fmt.Errorf("decoding tls job config: %w", err)
+	}
+	if c.Host == "" {
+		return nil, fmt.Errorf("tls job %q: host is required", c.Name)
+	}
+	if c.Port == 0 {
+		c.Port = 443
+	}
+	if c.ServerName == "" {
+		c.ServerName = c.Host
+	}
+	if c.ExpiryWarningDays == 0 {
+		c.ExpiryWarningDays = 30
+	}
+
+	var minVersion uint16
+	if c.MinVersion != "" {
+		v, ok := tlsVersions[c.MinVersion]
+		if !ok {
+			return nil, fmt.Errorf("tls job %q: unknown min-version %q", c.Name, c.MinVersion)
+		}
+		minVersion = v
+	}
+
+	rootCAs, err := loadCertPool(c.CaCert)
+	if err != nil {
+		return nil, fmt.Errorf("tls job %q: %w", c.Name, err)
+	}
+
+	timeout := opts.RequestTimeout
+	if c.Timeout != "" {
+		d, err := time.ParseDuration(c.Timeout)
+		if err != nil {
+			return nil, fmt.Errorf("tls job %q: parsing timeout %q: %w", c.Name, c.Timeout, err)
+		}
+		timeout = d
+	}
+	if timeout == 0 {
+		timeout = 15 * time.Second
+	}
+
+	return &TLSJob{
+		config:     c,
+		rootCAs:    rootCAs,
+		minVersion: minVersion,
+		timeout:    timeout,
+		tags:       MergeTags(c.Tags, opts.GlobalTags),
+	}, nil
+}
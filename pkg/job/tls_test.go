@@ -0,0 +1,292 @@
+package job
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestTLSFactory_Type(t *testing.T) {
+	f := &TLSFactory{}
+	if got := f.Type(); got != "tls" {
+		t.Errorf("Type() = %q, want %q", got, "tls")
+	}
+}
+
+func TestTLSFactory_Create(t *testing.T) {
+	input := `
+type: tls
+name: www
+host: www.example.com
+interval: 3600
+min-version: "1.2"
+`
+	var node yaml.Node
+	if err := yaml.Unmarshal([]byte(input), &node); err != nil {
+		t.Fatal(err)
+	}
+
+	j, err := (&TLSFactory{}).Create(*node.Content[0], JobOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tj := j.(*TLSJob)
+	if tj.config.Port != 443 {
+		t.Errorf("Port = %d, want 443", tj.config.Port)
+	}
+	if tj.config.ServerName != "www.example.com" {
+		t.Errorf("ServerName = %q, want %q", tj.config.ServerName, "www.example.com")
+	}
+	if tj.config.ExpiryWarningDays != 30 {
+		t.Errorf("ExpiryWarningDays = %d, want 30", tj.config.ExpiryWarningDays)
+	}
+	if tj.minVersion != tls.VersionTLS12 {
+		t.Errorf("minVersion = %x, want %x", tj.minVersion, tls.VersionTLS12)
+	}
+	if tj.URL() != "tls://www.example.com:443" {
+		t.Errorf("URL() = %q", tj.URL())
+	}
+}
+
+func TestTLSFactory_Create_Errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		wantErr string
+	}{
+		{
+			name:    "missing host",
+			input:   `name: nohost`,
+			wantErr: "host is required",
+		},
+		{
+			name: "unknown min version",
+			input: `
+name: badversion
+host: example.com
+min-version: "2.0"
+`,
+			wantErr: `unknown min-version "2.0"`,
+		},
+		{
+			name: "missing ca bundle",
+			input: `
+name: badca
+host: example.com
+ca-cert: /nonexistent/ca.pem
+`,
+			wantErr: "reading ca-cert",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var node yaml.Node
+			if err := yaml.Unmarshal([]byte(tt.input), &node); err != nil {
+				t.Fatal(err)
+			}
+			_, err := (&TLSFactory{}).Create(*node.Content[0], JobOptions{})
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("error = %v, want containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// writeServerCA writes the test server's certificate to a PEM file.
+func writeServerCA(t *testing.T, srv *httptest.Server) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "ca.pem")
+	data := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestTLSJob_Run(t *testing.T) {
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	srv.TLS = &tls.Config{MaxVersion: tls.VersionTLS12}
+	srv.StartTLS()
+	defer srv.Close()
+
+	// legacy only speaks TLS versions the crypto/tls client refuses by
+	// default.
+	legacy := httptest.NewUnstartedServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	legacy.TLS = &tls.Config{MinVersion: tls.VersionTLS10, MaxVersion: tls.VersionTLS11}
+	legacy.StartTLS()
+	defer legacy.Close()
+
+	trusted := x509.NewCertPool()
+	trusted.AddCert(srv.Certificate())
+
+	tests := []struct {
+		name string
+		// server defaults to srv.
+		server      *httptest.Server
+		serverName  string
+		rootCAs     *x509.CertPool
+		warningDays uint
+		minVersion  uint16
+		wantReason  string
+		// wantLevel defaults to SeverityCritical for failures.
+		wantLevel Severity
+	}{
+		{
+			name:        "healthy",
+			serverName:  "example.com",
+			rootCAs:     trusted,
+			warningDays: 30,
+		},
+		{
+			name:        "hostname mismatch",
+			serverName:  "other.test",
+			rootCAs:     trusted,
+			warningDays: 30,
+			wantReason:  "hostname mismatch",
+		},
+		{
+			name:        "untrusted chain",
+			serverName:  "example.com",
+			rootCAs:     x509.NewCertPool(),
+			warningDays: 30,
+			wantReason:  "untrusted chain",
+		},
+		{
+			name:        "expiry within warning window",
+			serverName:  "example.com",
+			rootCAs:     trusted,
+			warningDays: 365 * 200,
+			wantReason:  "expires in",
+			wantLevel:   SeverityWarning,
+		},
+		{
+			name:        "expiry within warning window and hostname mismatch",
+			serverName:  "other.test",
+			rootCAs:     trusted,
+			warningDays: 365 * 200,
+			wantReason:  "hostname mismatch",
+		},
+		{
+			name:        "version below minimum",
+			serverName:  "example.com",
+			rootCAs:     trusted,
+			warningDays: 30,
+			minVersion:  tls.VersionTLS13,
+			wantReason:  "TLS version TLS 1.2 below minimum TLS 1.3",
+		},
+		{
+			name:        "legacy version below minimum",
+			server:      legacy,
+			serverName:  "example.com",
+			rootCAs:     trusted,
+			warningDays: 30,
+			minVersion:  tls.VersionTLS12,
+			wantReason:  "TLS version TLS 1.1 below minimum TLS 1.2",
+		},
+		{
+			name:        "legacy version allowed",
+			server:      legacy,
+			serverName:  "example.com",
+			rootCAs:     trusted,
+			warningDays: 30,
+			minVersion:  tls.VersionTLS10,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := tt.server
+			if server == nil {
+				server = srv
+			}
+			host, portStr, _ := net.SplitHostPort(server.Listener.Addr().String())
+			port, _ := strconv.Atoi(portStr)
+			j := &TLSJob{
+				config: TLSJobConfig{
+					Name:              "tls-test",
+					Host:              host,
+					Port:              uint16(port),
+					ServerName:        tt.serverName,
+					ExpiryWarningDays: tt.warningDays,
+				},
+				rootCAs:    tt.rootCAs,
+				minVersion: tt.minVersion,
+				timeout:    2 * time.Second,
+				tags:       map[string]string{},
+			}
+			metrics, events, err := j.Run(context.Background())
+			if err != nil {
+				t.Fatalf("Run() error: %v", err)
+			}
+
+			got := make(map[string]float64)
+			for _, m := range metrics {
+				got[m.Timing] = m.Value
+			}
+			if got["cert_expiry_days"] <= 0 {
+				t.Errorf("cert_expiry_days = %v, want > 0", got["cert_expiry_days"])
+			}
+			if got["cert_chain_depth"] != 1 {
+				t.Errorf("cert_chain_depth = %v, want 1", got["cert_chain_depth"])
+			}
+			if _, ok := got["tls_handshake_duration_milliseconds"]; !ok {
+				t.Error("missing tls_handshake_duration_milliseconds metric")
+			}
+
+			if len(events) != 1 {
+				t.Fatalf("got %d events, want 1", len(events))
+			}
+			if tt.wantReason == "" {
+				if events[0].Failed() || events[0].ServerStatus != 0 || events[0].Reason != "" {
+					t.Errorf("expected healthy event, got %+v", events[0])
+				}
+				if !strings.Contains(events[0].Message, "presented a valid certificate") {
+					t.Errorf("Message = %q, want a description of the certificate", events[0].Message)
+				}
+				return
+			}
+			if !strings.Contains(events[0].Reason, tt.wantReason) {
+				t.Errorf("Reason = %q, want containing %q", events[0].Reason, tt.wantReason)
+			}
+			wantLevel := tt.wantLevel
+			if wantLevel == "" {
+				wantLevel = SeverityCritical
+			}
+			if got := events[0].Level(); got != wantLevel {
+				t.Errorf("Level() = %v, want %v", got, wantLevel)
+			}
+		})
+	}
+}
+
+func TestLoadCertPool(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	defer srv.Close()
+
+	pool, err := loadCertPool(writeServerCA(t, srv))
+	if err != nil {
+		t.Fatalf("loadCertPool() error: %v", err)
+	}
+	if _, err := srv.Certificate().Verify(x509.VerifyOptions{Roots: pool}); err != nil {
+		t.Errorf("server certificate not trusted by loaded pool: %v", err)
+	}
+
+	empty := filepath.Join(t.TempDir(), "empty.pem")
+	os.WriteFile(empty, []byte("not a certificate"), 0o600)
+	if _, err := loadCertPool(empty); err == nil {
+		t.Error("expected error for file without certificates")
+	}
+}
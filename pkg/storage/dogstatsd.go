@@ -49,7 +49,8 @@ func (d *DogstatsdBackend) SendMetric(_ context.Context, m job.Metric) error {
 	return nil
 }
 
-// SendEvent sends a service check to Datadog.
+// SendEvent sends a service check to Datadog, with a status matching the
+// event's severity and its summary as the message.
 func (d *DogstatsdBackend) SendEvent(_ context.Context, e job.Event) error {
 	var eventName string
 	if d.namespace == "" {
@@ -59,17 +60,22 @@ func (d *DogstatsdBackend) SendEvent(_ context.Context, e job.Event) error {
 	}
 
 	sc := &statsd.ServiceCheck{
-		Name:    eventName,
-		Message: fmt.Sprintf("%v is returning a HTTP status code of %v", e.Name, e.ServerStatus),
+		Name:      eventName,
+		Message:   e.Summary(),
+		Timestamp: e.Timestamp,
+		Tags:      MakeDogstatsdTags(e.Tags),
 	}
-
-	if e.ServerStatus > 0 && e.ServerStatus < 400 {
+	switch e.Level() {
+	case job.SeverityOK:
 		sc.Status = statsd.Ok
-	} else {
+	case job.SeverityWarning:
+		sc.Status = statsd.Warn
+	default:
 		sc.Status = statsd.Critical
 	}
-
-	sc.Tags = MakeDogstatsdTags(e.Tags)
+	if e.URL != "" {
+		sc.Tags = append(sc.Tags, "url:"+e.URL)
+	}
 	return d.conn.ServiceCheck(sc)
 }
 
@@ -1,8 +1,15 @@
 package storage
 
 import (
+	"context"
+	"net"
 	"sort"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/chrissnell/crabby/pkg/config"
+	"github.com/chrissnell/crabby/pkg/job"
 )
 
 func TestMakeDogstatsdTags(t *testing.T) {
@@ -51,3 +58,59 @@ func TestMakeDogstatsdTags(t *testing.T) {
 		})
 	}
 }
+
+func TestDogstatsdBackend_SendEvent(t *testing.T) {
+	tests := []struct {
+		name  string
+		event job.Event
+		want  string
+	}{
+		{
+			name:  "ok",
+			event: job.Event{Name: "web", ServerStatus: 200, Severity: job.SeverityOK, Message: "web succeeded in 12ms"},
+			want:  "_sc|crabby.web|0|d:1700000000|m:web succeeded in 12ms",
+		},
+		{
+			name:  "warning",
+			event: job.Event{Name: "web", Severity: job.SeverityWarning, Reason: "certificate expires in 3 days"},
+			want:  "_sc|crabby.web|1|d:1700000000|m:web failed: certificate expires in 3 days",
+		},
+		{
+			name:  "legacy 4xx",
+			event: job.Event{Name: "web", ServerStatus: 404, URL: "https://example.com"},
+			want:  "_sc|crabby.web|2|d:1700000000|#url:https://example.com|m:web returned status 404",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+			addr := conn.LocalAddr().(*net.UDPAddr)
+
+			b, err := NewDogstatsdBackend(config.DogstatsdConfig{Host: "127.0.0.1", Port: addr.Port})
+			if err != nil {
+				t.Fatal(err)
+			}
+			e := tt.event
+			e.Timestamp = time.Unix(1700000000, 0)
+			if err := b.SendEvent(context.Background(), e); err != nil {
+				t.Fatal(err)
+			}
+			// Close flushes the client's buffer.
+			b.Close()
+
+			buf := make([]byte, 1024)
+			conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+			n, _, err := conn.ReadFrom(buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := strings.TrimSpace(string(buf[:n])); got != tt.want {
+				t.Errorf("service check = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,160 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/chrissnell/crabby/pkg/config"
+	"gopkg.in/yaml.v3"
+)
+
+// FactoryOptions holds settings shared by all backends.
+type FactoryOptions struct {
+	RequestTimeout time.Duration
+}
+
+// BackendFactory creates backends of one type from YAML configuration.
+type BackendFactory interface {
+	Type() string
+	Create(cfg yaml.Node, opts FactoryOptions) (Backend, error)
+}
+
+// RegisterFactory registers a BackendFactory for a given backend type.
+func (d *Distributor) RegisterFactory(f BackendFactory) {
+	d.factories[f.Type()] = f
+}
+
+// AddBackendFromConfig creates a backend of type typ from cfg and registers
+// it with the delivery settings and name found in cfg. Without a name, the
+// instance is named after typ.
+func (d *Distributor) AddBackendFromConfig(typ string, cfg yaml.Node, opts FactoryOptions) error {
+	f, ok := d.factories[typ]
+	if !ok {
+		return fmt.Errorf("unknown type %q", typ)
+	}
+	var bo BackendOptions
+	if err := cfg.Decode(&bo); err != nil {
+		return fmt.Errorf("decoding delivery options: %w", err)
+	}
+	if bo.Name == "" {
+		bo.Name = typ
+	}
+	b, err := f.Create(cfg, opts)
+	if err != nil {
+		return err
+	}
+	if err := d.AddBackendWithOptions(b, bo); err != nil {
+		b.Close()
+		return err
+	}
+	return nil
+}
+
+// BuildBackends creates and registers the backends listed in
+// storage.backends. Each entry names its type in a `type` field.
+func (d *Distributor) BuildBackends(nodes []yaml.Node, opts FactoryOptions) error {
+	for i, node := range nodes {
+		var header struct {
+			Type string `yaml:"type"`
+			Name string `yaml:"name"`
+		}
+		if err := node.Decode(&header); err != nil {
+			return fmt.Errorf("decoding backend %d type: %w", i, err)
+		}
+		if header.Type == "" {
+			return fmt.Errorf("backend %d: type not specified", i)
+		}
+		name := header.Name
+		if name == "" {
+			name = header.Type
+		}
+		if err := d.AddBackendFromConfig(header.Type, node, opts); err != nil {
+			return fmt.Errorf("backend %d (%s): %w", i, name, err)
+		}
+	}
+	return nil
+}
+
+// Factories returns factories for all the built-in backend types. Their
+// types match the keys of the single-instance storage fields.
+func Factories() []BackendFactory {
+	return []BackendFactory{
+		configFactory[config.DogstatsdConfig]{"dogstatsd", func(c config.DogstatsdConfig, _ FactoryOptions) (Backend, error) {
+			if c.Host == "" {
+				return nil, errors.New("missing dogstatsd host")
+			}
+			return backend(NewDogstatsdBackend(c))
+		}},
+		configFactory[config.PrometheusConfig]{"prometheus", func(c config.PrometheusConfig, _ FactoryOptions) (Backend, error) {
+			if c.ListenAddr == "" {
+				return nil, errors.New("missing prometheus listen-addr")
+			}
+			return backend(NewPrometheusBackend(c))
+		}},
+		configFactory[config.InfluxDBConfig]{"influxdb", func(c config.InfluxDBConfig, _ FactoryOptions) (Backend, error) {
+			return backend(NewInfluxDBBackend(c))
+		}},
+		configFactory[config.LogConfig]{"log", func(c config.LogConfig, _ FactoryOptions) (Backend, error) {
+			if c.File == "" {
+				return nil, errors.New("missing log file")
+			}
+			return backend(NewLogBackend(c))
+		}},
+		configFactory[config.PagerDutyConfig]{"pagerduty", func(c config.PagerDutyConfig, _ FactoryOptions) (Backend, error) {
+			return backend(NewPagerDutyBackend(c))
+		}},
+		configFactory[config.SplunkHecConfig]{"splunk-hec", func(c config.SplunkHecConfig, o FactoryOptions) (Backend, error) {
+			if c.HecURL == "" {
+				return nil, errors.New("missing splunk hec-url")
+			}
+			return backend(NewSplunkHECBackend(c, o.RequestTimeout))
+		}},
+		configFactory[config.OTLPConfig]{"otlp", func(c config.OTLPConfig, o FactoryOptions) (Backend, error) {
+			return backend(NewOTLPBackend(c, o.RequestTimeout))
+		}},
+		configFactory[config.GraphiteConfig]{"graphite", func(c config.GraphiteConfig, o FactoryOptions) (Backend, error) {
+			return backend(NewGraphiteBackend(c, o.RequestTimeout))
+		}},
+		configFactory[config.PrometheusRemoteWriteConfig]{"prometheus-remote-write", func(c config.PrometheusRemoteWriteConfig, o FactoryOptions) (Backend, error) {
+			return backend(NewPrometheusRemoteWriteBackend(c, o.RequestTimeout))
+		}},
+		configFactory[config.PushgatewayConfig]{"prometheus-pushgateway", func(c config.PushgatewayConfig, o FactoryOptions) (Backend, error) {
+			return backend(NewPushgatewayBackend(c, o.RequestTimeout))
+		}},
+		configFactory[config.WebhookConfig]{"webhook", func(c config.WebhookConfig, o FactoryOptions) (Backend, error) {
+			return backend(NewWebhookBackend(c, o.RequestTimeout))
+		}},
+	}
+}
+
+// configFactory is a BackendFactory that decodes a C and passes it to
+// create. Secret files referenced by a C are read first.
+type configFactory[C any] struct {
+	typ    string
+	create func(cfg C, opts FactoryOptions) (Backend, error)
+}
+
+func (f configFactory[C]) Type() string { return f.typ }
+
+func (f configFactory[C]) Create(node yaml.Node, opts FactoryOptions) (Backend, error) {
+	var cfg C
+	if err := node.Decode(&cfg); err != nil {
+		return nil, fmt.Errorf("decoding %s config: %w", f.typ, err)
+	}
+	if r, ok := any(&cfg).(interface{ ResolveSecrets() error }); ok {
+		if err := r.ResolveSecrets(); err != nil {
+			return nil, err
+		}
+	}
+	return f.create(cfg, opts)
+}
+
+// backend converts a constructor's result to a Backend, keeping a failed
+// constructor's nil pointer from becoming a non-nil interface.
+func backend[B Backend](b B, err error) (Backend, error) {
+	if err != nil {
+		return nil, err
+	}
+	return b, nil
+}
@@ -0,0 +1,166 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/chrissnell/crabby/pkg/job"
+	"gopkg.in/yaml.v3"
+)
+
+// mockFactory creates mockFullBackends, recording the URL each was
+// configured with.
+type mockFactory struct {
+	created []*mockFullBackend
+	urls    []string
+}
+
+func (f *mockFactory) Type() string { return "mock" }
+
+func (f *mockFactory) Create(cfg yaml.Node, _ FactoryOptions) (Backend, error) {
+	var c struct {
+		URL string `yaml:"url"`
+	}
+	if err := cfg.Decode(&c); err != nil {
+		return nil, err
+	}
+	if c.URL == "" {
+		return nil, errors.New("missing url")
+	}
+	b := &mockFullBackend{mockBackend: mockBackend{name: "mock"}}
+	f.created = append(f.created, b)
+	f.urls = append(f.urls, c.URL)
+	return b, nil
+}
+
+func backendNodes(t *testing.T, doc string) []yaml.Node {
+	t.Helper()
+	var nodes []yaml.Node
+	if err := yaml.Unmarshal([]byte(doc), &nodes); err != nil {
+		t.Fatal(err)
+	}
+	return nodes
+}
+
+func TestDistributor_BuildBackends(t *testing.T) {
+	d := NewDistributor()
+	f := &mockFactory{}
+	d.RegisterFactory(f)
+
+	err := d.BuildBackends(backendNodes(t, `
+- type: mock
+  name: prod
+  url: http://prod
+- type: mock
+  name: archive
+  url: http://archive
+  queue:
+    size: 5
+`), FactoryOptions{})
+	if err != nil {
+		t.Fatalf("BuildBackends() error = %v", err)
+	}
+	if len(f.created) != 2 || f.urls[0] != "http://prod" || f.urls[1] != "http://archive" {
+		t.Fatalf("created %d backends with urls %v", len(f.created), f.urls)
+	}
+	if d.queues[0].name != "prod" || d.queues[1].name != "archive" {
+		t.Errorf("queue names = %s, %s; want prod, archive", d.queues[0].name, d.queues[1].name)
+	}
+	if d.queues[1].opts.size != 5 {
+		t.Errorf("archive queue size = %d, want 5", d.queues[1].opts.size)
+	}
+
+	if err := d.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	d.SendMetrics(context.Background(), []job.Metric{{Job: "web"}})
+	// Internal metrics are tagged with the instance name.
+	if got := metricValue(t, d.InternalMetrics(), "archive", "storage.dropped"); got != 0 {
+		t.Errorf("archive dropped = %v, want 0", got)
+	}
+	d.Close()
+	for i, b := range f.created {
+		if len(b.metrics) != 1 {
+			t.Errorf("backend %d got %d metrics, want 1", i, len(b.metrics))
+		}
+	}
+}
+
+func TestDistributor_BuildBackends_invalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		doc     string
+		wantErr string
+	}{
+		{name: "no type", doc: `[{name: a, url: x}]`, wantErr: "backend 0: type not specified"},
+		{name: "unknown type", doc: `[{type: carrier-pigeon}]`, wantErr: `backend 0 (carrier-pigeon): unknown type "carrier-pigeon"`},
+		{name: "factory error", doc: `[{type: mock, name: a}]`, wantErr: "backend 0 (a): missing url"},
+		{name: "duplicate name", doc: `[{type: mock, url: x}, {type: mock, url: y}]`, wantErr: `backend 1 (mock): duplicate backend name "mock"`},
+		{name: "bad queue", doc: `[{type: mock, url: x, queue: {size: -1}}]`, wantErr: "queue size"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := NewDistributor()
+			d.RegisterFactory(&mockFactory{})
+			err := d.BuildBackends(backendNodes(t, tt.doc), FactoryOptions{})
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error = %v, want containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDistributor_AddBackendFromConfig_defaultName(t *testing.T) {
+	d := NewDistributor()
+	for _, f := range Factories() {
+		d.RegisterFactory(f)
+	}
+	var node yaml.Node
+	if err := yaml.Unmarshal([]byte(`{hec-url: "http://splunk.test:8088", token: t}`), &node); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.AddBackendFromConfig("splunk-hec", *node.Content[0], FactoryOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	if got := d.queues[0].name; got != "splunk-hec" {
+		t.Errorf("instance name = %q, want %q", got, "splunk-hec")
+	}
+}
+
+func TestFactories_log(t *testing.T) {
+	dir := t.TempDir()
+	d := NewDistributor()
+	for _, f := range Factories() {
+		d.RegisterFactory(f)
+	}
+	err := d.BuildBackends(backendNodes(t, `
+- {type: log, name: one, file: `+filepath.Join(dir, "one.log")+`, format: {metric: "%job %timing"}}
+- {type: log, name: two, file: `+filepath.Join(dir, "two.log")+`, format: {metric: "%timing"}}
+`), FactoryOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	d.SendMetrics(context.Background(), []job.Metric{{Job: "web", Timing: "dns_duration_milliseconds"}})
+	d.Close()
+
+	for file, want := range map[string]string{
+		"one.log": "web dns_duration_milliseconds",
+		"two.log": "dns_duration_milliseconds",
+	} {
+		got, err := os.ReadFile(filepath.Join(dir, file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.TrimSpace(string(got)) != want {
+			t.Errorf("%s = %q, want %q", file, got, want)
+		}
+	}
+}
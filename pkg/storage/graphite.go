@@ -0,0 +1,359 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/chrissnell/crabby/pkg/config"
+	"github.com/chrissnell/crabby/pkg/job"
+)
+
+// Graphite wire formats.
+const (
+	GraphiteFormatPlaintext = "plaintext"
+	GraphiteFormatPickle    = "pickle"
+)
+
+const defaultGraphiteBatchSize = 100
+
+const (
+	// maxGraphiteDatagram bounds a UDP datagram so that it fits a typical
+	// path MTU instead of being fragmented or dropped.
+	maxGraphiteDatagram = 1400
+	// graphiteIdleProbe is how long a TCP connection must have been idle
+	// before a send first checks whether Carbon has closed it.
+	graphiteIdleProbe = time.Second
+)
+
+// graphitePlaceholder matches the placeholders allowed in a path template.
+var graphitePlaceholder = regexp.MustCompile(`%(namespace|job|timing|url|tag:[A-Za-z0-9_-]+)`)
+
+// GraphiteBackend sends metrics to Graphite's Carbon daemon using the
+// plaintext or pickle protocol, over TCP or UDP. The TCP connection is kept
+// open between sends; if it breaks, it is redialled.
+type GraphiteBackend struct {
+	config   config.GraphiteConfig
+	addr     string
+	timeout  time.Duration
+	template string
+
+	// idleProbe is graphiteIdleProbe; tests shorten it.
+	idleProbe time.Duration
+
+	mu        sync.Mutex
+	conn      net.Conn
+	lastWrite time.Time
+}
+
+// NewGraphiteBackend creates a new Graphite backend. It connects on the first
+// send.
+func NewGraphiteBackend(cfg config.GraphiteConfig, requestTimeout time.Duration) (*GraphiteBackend, error) {
+	if cfg.Host == "" {
+		return nil, errors.New("missing graphite host")
+	}
+	if cfg.Protocol == "" {
+		cfg.Protocol = "tcp"
+	}
+	if cfg.Protocol != "tcp" && cfg.Protocol != "udp" {
+		return nil, fmt.Errorf("unknown graphite protocol %q (want %q or %q)", cfg.Protocol, "tcp", "udp")
+	}
+	switch cfg.Format {
+	case "":
+		cfg.Format = GraphiteFormatPlaintext
+	case GraphiteFormatPlaintext:
+	case GraphiteFormatPickle:
+		if cfg.Protocol == "udp" {
+			return nil, errors.New("the graphite pickle format requires tcp")
+		}
+	default:
+		return nil, fmt.Errorf("unknown graphite format %q (want %q or %q)", cfg.Format, GraphiteFormatPlaintext, GraphiteFormatPickle)
+	}
+	if cfg.Port == 0 {
+		cfg.Port = 2003
+		if cfg.Format == GraphiteFormatPickle {
+			cfg.Port = 2004
+		}
+	}
+	if cfg.BatchSize < 0 {
+		return nil, errors.New("batch-size must not be negative")
+	}
+	if cfg.BatchSize == 0 {
+		cfg.BatchSize = defaultGraphiteBatchSize
+	}
+	if cfg.Namespace == "" {
+		cfg.Namespace = "crabby"
+	}
+
+	template := cfg.PathTemplate
+	if template == "" {
+		template = "%namespace.%job.%timing"
+		if cfg.TaggedSeries {
+			template = "%namespace.%timing"
+		}
+	}
+	if strings.Contains(graphitePlaceholder.ReplaceAllString(template, ""), "%") {
+		return nil, fmt.Errorf("path-template %q has an unknown placeholder", template)
+	}
+
+	if requestTimeout == 0 {
+		requestTimeout = 15 * time.Second
+	}
+	return &GraphiteBackend{
+		config:    cfg,
+		addr:      net.JoinHostPort(cfg.Host, strconv.Itoa(cfg.Port)),
+		timeout:   requestTimeout,
+		template:  template,
+		idleProbe: graphiteIdleProbe,
+	}, nil
+}
+
+func (g *GraphiteBackend) Name() string                  { return "graphite" }
+func (g *GraphiteBackend) Start(_ context.Context) error { return nil }
+
+// Close closes the connection to Carbon, if one is open.
+func (g *GraphiteBackend) Close() error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.conn == nil {
+		return nil
+	}
+	err := g.conn.Close()
+	g.conn = nil
+	return err
+}
+
+// BatchSize returns the maximum number of metrics written at once.
+func (g *GraphiteBackend) BatchSize() int { return g.config.BatchSize }
+
+// SendMetric sends a single metric to Carbon.
+func (g *GraphiteBackend) SendMetric(ctx context.Context, m job.Metric) error {
+	return g.SendBatch(ctx, []job.Metric{m}, nil)
+}
+
+// SendBatch writes metrics to Carbon: in one write over TCP, and in as few
+// datagrams of at most maxGraphiteDatagram bytes as possible over UDP.
+// Graphite doesn't take events, so events is ignored.
+func (g *GraphiteBackend) SendBatch(ctx context.Context, metrics []job.Metric, _ []job.Event) error {
+	if len(metrics) == 0 {
+		return nil
+	}
+	var payloads [][]byte
+	switch {
+	case g.config.Format == GraphiteFormatPickle:
+		payloads = [][]byte{g.encodePickle(metrics)}
+	case g.config.Protocol == "udp":
+		payloads = graphiteDatagrams(g.encodePlaintext(metrics))
+	default:
+		payloads = [][]byte{g.encodePlaintext(metrics)}
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	for _, payload := range payloads {
+		reused := g.conn != nil
+		err := g.write(ctx, payload)
+		if err != nil && reused {
+			// Carbon may have closed an idle connection; try a fresh one.
+			err = g.write(ctx, payload)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// write sends payload over the current connection, dialling one if needed.
+// On failure the connection is closed so the next write redials. g.mu must
+// be held.
+func (g *GraphiteBackend) write(ctx context.Context, payload []byte) error {
+	if g.conn != nil && g.config.Protocol == "tcp" && time.Since(g.lastWrite) >= g.idleProbe && peerClosed(g.conn) {
+		g.conn.Close()
+		g.conn = nil
+	}
+	if g.conn == nil {
+		d := net.Dialer{Timeout: g.timeout}
+		conn, err := d.DialContext(ctx, g.config.Protocol, g.addr)
+		if err != nil {
+			return fmt.Errorf("connecting to graphite: %w", err)
+		}
+		g.conn = conn
+	}
+	g.conn.SetWriteDeadline(time.Now().Add(g.timeout))
+	if _, err := g.conn.Write(payload); err != nil {
+		g.conn.Close()
+		g.conn = nil
+		return fmt.Errorf("writing to graphite: %w", err)
+	}
+	g.lastWrite = time.Now()
+	return nil
+}
+
+// peerClosed reports whether Carbon has closed conn. A write to such a
+// connection would usually succeed but never arrive. It blocks for up to a
+// millisecond, so it's only used on connections that have been idle.
+func peerClosed(conn net.Conn) bool {
+	conn.SetReadDeadline(time.Now().Add(time.Millisecond))
+	defer conn.SetReadDeadline(time.Time{})
+	var buf [1]byte
+	_, err := conn.Read(buf[:])
+	return errors.Is(err, io.EOF)
+}
+
+// MetricPath returns the Graphite path for m: the path template filled in
+// and, with tagged series, followed by the job, URL and tags as
+// ;name=value pairs.
+func (g *GraphiteBackend) MetricPath(m job.Metric) string {
+	path := graphitePlaceholder.ReplaceAllStringFunc(g.template, func(p string) string {
+		switch p {
+		case "%namespace":
+			return g.config.Namespace
+		case "%timing":
+			return graphiteNode(m.Timing)
+		case "%job":
+			return graphiteNode(m.Job)
+		case "%url":
+			return graphiteNode(m.URL)
+		}
+		return graphiteNode(m.Tags[strings.TrimPrefix(p, "%tag:")])
+	})
+	if !g.config.TaggedSeries {
+		return path
+	}
+
+	tags := make(map[string]string, len(m.Tags)+2)
+	for k, v := range m.Tags {
+		tags[k] = v
+	}
+	tags["job"] = m.Job
+	if m.URL != "" {
+		tags["url"] = m.URL
+	}
+	names := make([]string, 0, len(tags))
+	for k := range tags {
+		names = append(names, k)
+	}
+	slices.Sort(names)
+
+	var b strings.Builder
+	b.WriteString(path)
+	for _, k := range names {
+		if tags[k] == "" {
+			continue
+		}
+		b.WriteByte(';')
+		b.WriteString(graphiteTagName(k))
+		b.WriteByte('=')
+		b.WriteString(graphiteTagValue(tags[k]))
+	}
+	return b.String()
+}
+
+// encodePlaintext renders metrics as "path value timestamp" lines.
+func (g *GraphiteBackend) encodePlaintext(metrics []job.Metric) []byte {
+	var b bytes.Buffer
+	for _, m := range metrics {
+		fmt.Fprintf(&b, "%s %s %d\n", g.MetricPath(m), strconv.FormatFloat(m.Value, 'f', -1, 64), m.Timestamp.Unix())
+	}
+	return b.Bytes()
+}
+
+// graphiteDatagrams splits plaintext lines into chunks of at most
+// maxGraphiteDatagram bytes, never splitting a line. A longer line gets a
+// chunk of its own.
+func graphiteDatagrams(payload []byte) [][]byte {
+	var chunks [][]byte
+	var start, end int
+	for end < len(payload) {
+		next := len(payload)
+		if i := bytes.IndexByte(payload[end:], '\n'); i >= 0 {
+			next = end + i + 1
+		}
+		if next-start > maxGraphiteDatagram && end > start {
+			chunks = append(chunks, payload[start:end])
+			start = end
+		}
+		end = next
+	}
+	if end > start {
+		chunks = append(chunks, payload[start:end])
+	}
+	return chunks
+}
+
+// encodePickle renders metrics as a length-prefixed pickle (protocol 2) of
+// a list of (path, (timestamp, value)) tuples, as Carbon's pickle receiver
+// expects.
+func (g *GraphiteBackend) encodePickle(metrics []job.Metric) []byte {
+	var p bytes.Buffer
+	p.WriteString("\x80\x02](") // PROTO 2, EMPTY_LIST, MARK
+	for _, m := range metrics {
+		path := g.MetricPath(m)
+		p.WriteByte('X') // BINUNICODE
+		binary.Write(&p, binary.LittleEndian, uint32(len(path)))
+		p.WriteString(path)
+		for _, f := range []float64{float64(m.Timestamp.Unix()), m.Value} {
+			p.WriteByte('G') // BINFLOAT
+			binary.Write(&p, binary.BigEndian, math.Float64bits(f))
+		}
+		p.WriteString("\x86\x86") // TUPLE2, TUPLE2
+	}
+	p.WriteString("e.") // APPENDS, STOP
+
+	out := make([]byte, 4, 4+p.Len())
+	binary.BigEndian.PutUint32(out, uint32(p.Len()))
+	return append(out, p.Bytes()...)
+}
+
+// graphiteNode makes s usable as a single node of a Graphite path.
+func graphiteNode(s string) string {
+	if s == "" {
+		return "unknown"
+	}
+	return strings.Map(func(r rune) rune {
+		if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r) || r == '-' || r == '_') {
+			return r
+		}
+		return '_'
+	}, s)
+}
+
+// graphiteTagName replaces the characters Graphite doesn't allow in tag
+// names.
+func graphiteTagName(s string) string {
+	return strings.Map(func(r rune) rune {
+		if strings.ContainsRune(";!^=", r) || unicode.IsSpace(r) {
+			return '_'
+		}
+		return r
+	}, s)
+}
+
+// graphiteTagValue replaces the characters Graphite doesn't allow in tag
+// values: semicolons, whitespace and a leading tilde.
+func graphiteTagValue(s string) string {
+	s = strings.Map(func(r rune) rune {
+		if r == ';' || unicode.IsSpace(r) {
+			return '_'
+		}
+		return r
+	}, s)
+	if strings.HasPrefix(s, "~") {
+		s = "_" + s[1:]
+	}
+	return s
+}
@@ -0,0 +1,226 @@
+package storage
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"net"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chrissnell/crabby/pkg/config"
+	"github.com/chrissnell/crabby/pkg/job"
+)
+
+func TestGraphiteBackend_MetricPath(t *testing.T) {
+	m := job.Metric{
+		Job:    "www.example.com",
+		URL:    "https://www.example.com/login",
+		Timing: "dns_duration_milliseconds",
+		Tags:   map[string]string{"env": "prod", "region": "us east"},
+	}
+	tests := []struct {
+		name string
+		cfg  config.GraphiteConfig
+		want string
+	}{
+		{name: "default", want: "crabby.www_example_com.dns_duration_milliseconds"},
+		{
+			name: "custom template",
+			cfg:  config.GraphiteConfig{Namespace: "mon.crabby", PathTemplate: "%namespace.%tag:env.%tag:region.%tag:team.%job.%timing"},
+			want: "mon.crabby.prod.us_east.unknown.www_example_com.dns_duration_milliseconds",
+		},
+		{name: "url", cfg: config.GraphiteConfig{PathTemplate: "%namespace.%url.%timing"}, want: "crabby.https___www_example_com_login.dns_duration_milliseconds"},
+		{
+			name: "tagged series",
+			cfg:  config.GraphiteConfig{TaggedSeries: true},
+			want: "crabby.dns_duration_milliseconds;env=prod;job=www.example.com;region=us_east;url=https://www.example.com/login",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.cfg.Host = "graphite"
+			g, err := NewGraphiteBackend(tt.cfg, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := g.MetricPath(m); got != tt.want {
+				t.Errorf("MetricPath() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	// A custom timing name is one node, whatever it contains.
+	g, err := NewGraphiteBackend(config.GraphiteConfig{Host: "graphite"}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	custom := job.Metric{Job: "api", Timing: "cart.items total"}
+	if got, want := g.MetricPath(custom), "crabby.api.cart_items_total"; got != want {
+		t.Errorf("MetricPath() = %q, want %q", got, want)
+	}
+}
+
+func TestNewGraphiteBackend_invalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     config.GraphiteConfig
+		wantErr string
+	}{
+		{name: "no host", cfg: config.GraphiteConfig{}, wantErr: "missing graphite host"},
+		{name: "unknown protocol", cfg: config.GraphiteConfig{Host: "g", Protocol: "sctp"}, wantErr: `unknown graphite protocol "sctp"`},
+		{name: "unknown format", cfg: config.GraphiteConfig{Host: "g", Format: "json"}, wantErr: `unknown graphite format "json"`},
+		{name: "pickle over udp", cfg: config.GraphiteConfig{Host: "g", Protocol: "udp", Format: "pickle"}, wantErr: "requires tcp"},
+		{name: "unknown placeholder", cfg: config.GraphiteConfig{Host: "g", PathTemplate: "%namespace.%host"}, wantErr: "unknown placeholder"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewGraphiteBackend(tt.cfg, 0)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error = %v, want containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func graphiteTestBackend(t *testing.T, cfg config.GraphiteConfig, addr string) *GraphiteBackend {
+	t.Helper()
+	host, port, _ := net.SplitHostPort(addr)
+	cfg.Host = host
+	cfg.Port, _ = net.LookupPort("tcp", port)
+	g, err := NewGraphiteBackend(cfg, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { g.Close() })
+	return g
+}
+
+func TestGraphiteBackend_TCPReconnect(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lis.Close()
+	lines := make(chan string, 10)
+	go func() {
+		for {
+			conn, err := lis.Accept()
+			if err != nil {
+				return
+			}
+			// Read one line, then hang up like a restarting Carbon.
+			line, _ := bufio.NewReader(conn).ReadString('\n')
+			lines <- line
+			conn.Close()
+		}
+	}()
+
+	g := graphiteTestBackend(t, config.GraphiteConfig{}, lis.Addr().String())
+	g.idleProbe = 10 * time.Millisecond
+	ts := time.Unix(1700000000, 0)
+	for i, want := range []string{
+		"crabby.web.dns_duration_milliseconds 12.5 1700000000\n",
+		"crabby.web.probe_success 1 1700000000\n",
+	} {
+		m := job.Metric{Job: "web", Timing: "dns_duration_milliseconds", Value: 12.5, Timestamp: ts}
+		if i == 1 {
+			m = job.Metric{Job: "web", Timing: "probe_success", Value: 1, Timestamp: ts}
+			// Give the server time to close the first connection.
+			time.Sleep(50 * time.Millisecond)
+		}
+		if err := g.SendMetric(context.Background(), m); err != nil {
+			t.Fatalf("send %d: %v", i, err)
+		}
+		select {
+		case got := <-lines:
+			if got != want {
+				t.Errorf("send %d: Carbon got %q, want %q", i, got, want)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("send %d: nothing received", i)
+		}
+	}
+}
+
+func TestGraphiteBackend_UDPBatch(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+
+	g := graphiteTestBackend(t, config.GraphiteConfig{Protocol: "udp"}, pc.LocalAddr().String())
+	ts := time.Unix(1700000000, 0)
+	err = g.SendBatch(context.Background(), []job.Metric{
+		{Job: "a", Timing: "t", Value: 1, Timestamp: ts},
+		{Job: "b", Timing: "t", Value: 0.25, Timestamp: ts},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf := make([]byte, 1024)
+	pc.SetReadDeadline(time.Now().Add(2 * time.Second))
+	n, _, err := pc.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(buf[:n]), "crabby.a.t 1 1700000000\ncrabby.b.t 0.25 1700000000\n"; got != want {
+		t.Errorf("datagram = %q, want %q", got, want)
+	}
+}
+
+func TestGraphiteDatagrams(t *testing.T) {
+	line := strings.Repeat("x", 99) + "\n"
+	long := strings.Repeat("y", maxGraphiteDatagram+1) + "\n"
+	tests := []struct {
+		name    string
+		payload string
+		want    []int // chunk lengths
+	}{
+		{name: "one chunk", payload: line + line, want: []int{200}},
+		{name: "split at a line", payload: strings.Repeat(line, 15), want: []int{1400, 100}},
+		{name: "long line alone", payload: line + long + line, want: []int{100, len(long), 100}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []int
+			for _, c := range graphiteDatagrams([]byte(tt.payload)) {
+				if c[len(c)-1] != '\n' {
+					t.Errorf("chunk %q doesn't end a line", c)
+				}
+				got = append(got, len(c))
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("chunk lengths = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGraphiteBackend_encodePickle(t *testing.T) {
+	g, err := NewGraphiteBackend(config.GraphiteConfig{Host: "g", Format: GraphiteFormatPickle}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g.config.Port != 2004 {
+		t.Errorf("port = %d, want 2004", g.config.Port)
+	}
+	got := g.encodePickle([]job.Metric{{Job: "a", Timing: "t", Value: 1.5, Timestamp: time.Unix(1700000000, 0)}})
+
+	// [("crabby.a.t", (1700000000.0, 1.5))] in pickle protocol 2.
+	want := "\x80\x02](" +
+		"X\x0a\x00\x00\x00crabby.a.t" +
+		"G\x41\xd9\x54\xfc\x40\x00\x00\x00" +
+		"G\x3f\xf8\x00\x00\x00\x00\x00\x00" +
+		"\x86\x86e."
+	if n := binary.BigEndian.Uint32(got[:4]); int(n) != len(got)-4 {
+		t.Errorf("length prefix = %d, want %d", n, len(got)-4)
+	}
+	if string(got[4:]) != want {
+		t.Errorf("pickle = %q, want %q", got[4:], want)
+	}
+}
@@ -0,0 +1,76 @@
+package storage
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/chrissnell/crabby/pkg/config"
+)
+
+// newTLSConfig returns the client TLS config for an HTTPS backend. A CA
+// certificate, if given, is trusted in addition to the system pool;
+// otherwise skipVerify disables certificate validation.
+func newTLSConfig(caCert string, skipVerify bool) (*tls.Config, error) {
+	if caCert == "" {
+		return &tls.Config{InsecureSkipVerify: skipVerify}, nil
+	}
+	rootCAs, err := x509.SystemCertPool()
+	if err != nil {
+		return nil, fmt.Errorf("loading system cert pool: %w", err)
+	}
+	if rootCAs == nil {
+		return nil, fmt.Errorf("system certificate pool is nil")
+	}
+	certs, err := os.ReadFile(caCert)
+	if err != nil {
+		return nil, fmt.Errorf("reading ca-cert from %s: %w", caCert, err)
+	}
+	rootCAs.AppendCertsFromPEM(certs)
+	return &tls.Config{RootCAs: rootCAs}, nil
+}
+
+// newHTTPClient returns the HTTP client for an HTTPS-capable backend.
+func newHTTPClient(caCert string, skipVerify bool, timeout time.Duration) (*http.Client, error) {
+	tlsConfig, err := newTLSConfig(caCert, skipVerify)
+	if err != nil {
+		return nil, err
+	}
+	if timeout == 0 {
+		timeout = 15 * time.Second
+	}
+	return &http.Client{
+		Transport: &http.Transport{
+			Proxy:                 http.ProxyFromEnvironment,
+			TLSHandshakeTimeout:   10 * time.Second,
+			ExpectContinueTimeout: 1 * time.Second,
+			TLSClientConfig:       tlsConfig,
+		},
+		Timeout: timeout,
+	}, nil
+}
+
+// setHTTPAuth adds a's headers and credentials to req. A bearer token takes
+// precedence over a username and password.
+func setHTTPAuth(req *http.Request, a config.HTTPAuthConfig) {
+	for k, v := range a.Headers {
+		req.Header.Set(k, v)
+	}
+	switch {
+	case a.BearerToken != "":
+		req.Header.Set("Authorization", "Bearer "+a.BearerToken)
+	case a.Username != "":
+		req.SetBasicAuth(a.Username, a.Password)
+	}
+}
+
+// checkResponse returns a *StatusError if res isn't a 2xx response.
+func checkResponse(service string, res *http.Response) error {
+	if res.StatusCode >= 200 && res.StatusCode <= 299 {
+		return nil
+	}
+	return fmt.Errorf("%s returned %w", service, &StatusError{StatusCode: res.StatusCode})
+}
@@ -1,9 +1,15 @@
 package storage
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
+	"maps"
+	"math"
 	"os"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
 
@@ -11,6 +17,12 @@ import (
 	"github.com/chrissnell/crabby/pkg/job"
 )
 
+// Structured log formats, selected with "format: json" or "format: logfmt".
+const (
+	LogFormatJSON   = "json"
+	LogFormatLogfmt = "logfmt"
+)
+
 // LogBackend writes metrics and events to a log file or stdout/stderr.
 type LogBackend struct {
 	stream     *os.File
@@ -21,6 +33,12 @@ type LogBackend struct {
 
 // NewLogBackend creates a new log backend.
 func NewLogBackend(cfg config.LogConfig) (*LogBackend, error) {
+	switch cfg.Format.Mode {
+	case "", LogFormatJSON, LogFormatLogfmt:
+	default:
+		return nil, fmt.Errorf("unknown log format %q", cfg.Format.Mode)
+	}
+
 	var stream *os.File
 	switch cfg.File {
 	case "stdout":
@@ -101,6 +119,17 @@ func (l *LogBackend) BuildTagString(tags map[string]string) string {
 
 // BuildMetricString formats a metric into a log string.
 func (l *LogBackend) BuildMetricString(m job.Metric) string {
+	if l.format.Mode != "" {
+		return l.buildRecord([]logField{
+			{"time", m.Timestamp.In(l.location).Format(time.RFC3339Nano)},
+			{"type", "metric"},
+			{"job", m.Job},
+			{"url", m.URL},
+			{"timing", m.Timing},
+			{"value", m.Value},
+			{"tags", m.Tags},
+		})
+	}
 	replacer := strings.NewReplacer(
 		"%job", m.Job,
 		"%timing", m.Timing,
@@ -114,11 +143,138 @@ func (l *LogBackend) BuildMetricString(m job.Metric) string {
 
 // BuildEventString formats an event into a log string.
 func (l *LogBackend) BuildEventString(e job.Event) string {
+	if l.format.Mode != "" {
+		return l.buildRecord([]logField{
+			{"time", e.Timestamp.In(l.location).Format(time.RFC3339Nano)},
+			{"type", "event"},
+			{"name", e.Name},
+			{"status", e.ServerStatus},
+			{"severity", string(e.Level())},
+			{"failed", e.Failed()},
+			{"reason", e.Reason},
+			{"url", e.URL},
+			{"duration_ms", e.Duration.Seconds() * 1000},
+			{"message", e.Summary()},
+			{"tags", e.Tags},
+		})
+	}
 	replacer := strings.NewReplacer(
 		"%name", e.Name,
 		"%status", fmt.Sprint(e.ServerStatus),
+		"%severity", string(e.Level()),
+		"%reason", e.Reason,
+		"%url", e.URL,
+		"%duration", fmt.Sprintf("%.6g", e.Duration.Seconds()*1000),
+		"%message", e.Summary(),
 		"%time", e.Timestamp.In(l.location).Format(l.timeFormat),
 		"%tags", l.BuildTagString(e.Tags),
 	)
 	return replacer.Replace(l.format.Event)
 }
+
+// logField is one field of a structured log record. Its value is a string,
+// int, float64, bool or tag map.
+type logField struct {
+	key   string
+	value any
+}
+
+// buildRecord formats fields as a one-line JSON object or logfmt record.
+// Empty strings and tag maps are left out, and tags are sorted by name.
+func (l *LogBackend) buildRecord(fields []logField) string {
+	fields = slices.DeleteFunc(fields, func(f logField) bool {
+		switch v := f.value.(type) {
+		case string:
+			return v == ""
+		case map[string]string:
+			return len(v) == 0
+		}
+		return false
+	})
+	if l.format.Mode == LogFormatJSON {
+		return buildJSONRecord(fields)
+	}
+	return buildLogfmtRecord(fields)
+}
+
+func buildJSONRecord(fields []logField) string {
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	// Keep the & in URLs readable.
+	enc.SetEscapeHTML(false)
+	encode := func(v any) {
+		// None of the value types can fail to encode. Maps are encoded with
+		// sorted keys.
+		_ = enc.Encode(v)
+		// Drop the newline Encode adds.
+		b.Truncate(b.Len() - 1)
+	}
+	b.WriteByte('{')
+	for i, f := range fields {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		encode(f.key)
+		b.WriteByte(':')
+		v := f.value
+		if x, ok := v.(float64); ok && (math.IsNaN(x) || math.IsInf(x, 0)) {
+			// JSON has no NaN or infinity.
+			v = strconv.FormatFloat(x, 'g', -1, 64)
+		}
+		encode(v)
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
+
+func buildLogfmtRecord(fields []logField) string {
+	var b strings.Builder
+	write := func(key, value string) {
+		if b.Len() > 0 {
+			b.WriteByte(' ')
+		}
+		b.WriteString(logfmtKey(key))
+		b.WriteByte('=')
+		b.WriteString(logfmtValue(value))
+	}
+	for _, f := range fields {
+		switch v := f.value.(type) {
+		case string:
+			write(f.key, v)
+		case int:
+			write(f.key, strconv.Itoa(v))
+		case float64:
+			write(f.key, strconv.FormatFloat(v, 'g', -1, 64))
+		case bool:
+			write(f.key, strconv.FormatBool(v))
+		case map[string]string:
+			for _, name := range slices.Sorted(maps.Keys(v)) {
+				write(f.key+"."+name, v[name])
+			}
+		}
+	}
+	b.WriteByte('\n')
+	return b.String()
+}
+
+// logfmtKey replaces the characters a logfmt key can't contain with
+// underscores.
+func logfmtKey(key string) string {
+	return strings.Map(func(r rune) rune {
+		if r <= ' ' || r == '=' || r == '"' || r == 0x7f {
+			return '_'
+		}
+		return r
+	}, key)
+}
+
+// logfmtValue quotes value if it is empty or contains spaces, quotes, equals
+// signs or control characters.
+func logfmtValue(value string) string {
+	if value == "" || strings.ContainsFunc(value, func(r rune) bool {
+		return r <= ' ' || r == '=' || r == '"' || r == '\\' || r == 0x7f
+	}) {
+		return strconv.Quote(value)
+	}
+	return value
+}
@@ -1,6 +1,7 @@
 package storage
 
 import (
+	"math"
 	"strings"
 	"testing"
 	"time"
@@ -107,6 +108,96 @@ func TestBuildEventString(t *testing.T) {
 	}
 }
 
+func TestBuildEventString_Reason(t *testing.T) {
+	b := newTestLogBackend(t)
+	b.format.Event = "%name %status %reason"
+
+	got := b.BuildEventString(job.Event{Name: "db", Reason: "connect: connection refused"})
+	if want := "db 0 connect: connection refused"; got != want {
+		t.Errorf("BuildEventString() = %q, want %q", got, want)
+	}
+}
+
+func TestBuildEventString_Details(t *testing.T) {
+	b := newTestLogBackend(t)
+	b.format.Event = "%severity %url %duration %message"
+
+	got := b.BuildEventString(job.Event{
+		Name:     "web",
+		Severity: job.SeverityWarning,
+		URL:      "https://example.com",
+		Duration: 1500 * time.Microsecond,
+		Message:  "web succeeded with a warning",
+	})
+	if want := "warning https://example.com 1.5 web succeeded with a warning"; got != want {
+		t.Errorf("BuildEventString() = %q, want %q", got, want)
+	}
+}
+
+func TestLogBackend_structured(t *testing.T) {
+	ts := time.Date(2024, 6, 15, 10, 30, 0, 123456789, time.UTC)
+	metric := job.Metric{
+		Job:       "web",
+		Timing:    "dns_duration_milliseconds",
+		Value:     42.5,
+		URL:       "https://example.com/?a=1&b=2",
+		Timestamp: ts,
+		Tags:      map[string]string{"region": "us-east", "env": "prod", "team": "web ops"},
+	}
+	event := job.Event{
+		Name:         "web",
+		ServerStatus: 503,
+		Timestamp:    ts,
+		Severity:     job.SeverityCritical,
+		URL:          "https://example.com",
+		Duration:     1500 * time.Millisecond,
+		Message:      `web returned "503"`,
+	}
+
+	tests := []struct {
+		mode       string
+		wantMetric string
+		wantEvent  string
+	}{
+		{
+			mode:       "json",
+			wantMetric: `{"time":"2024-06-15T10:30:00.123456789Z","type":"metric","job":"web","url":"https://example.com/?a=1&b=2","timing":"dns_duration_milliseconds","value":42.5,"tags":{"env":"prod","region":"us-east","team":"web ops"}}` + "\n",
+			wantEvent:  `{"time":"2024-06-15T10:30:00.123456789Z","type":"event","name":"web","status":503,"severity":"critical","failed":true,"url":"https://example.com","duration_ms":1500,"message":"web returned \"503\""}` + "\n",
+		},
+		{
+			mode:       "logfmt",
+			wantMetric: `time=2024-06-15T10:30:00.123456789Z type=metric job=web url="https://example.com/?a=1&b=2" timing=dns_duration_milliseconds value=42.5 tags.env=prod tags.region=us-east tags.team="web ops"` + "\n",
+			wantEvent:  `time=2024-06-15T10:30:00.123456789Z type=event name=web status=503 severity=critical failed=true url=https://example.com duration_ms=1500 message="web returned \"503\""` + "\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			b, err := NewLogBackend(config.LogConfig{File: "stdout", Format: config.FormatConfig{Mode: tt.mode}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			b.location = time.UTC
+			if got := b.BuildMetricString(metric); got != tt.wantMetric {
+				t.Errorf("BuildMetricString() = %s, want %s", got, tt.wantMetric)
+			}
+			if got := b.BuildEventString(event); got != tt.wantEvent {
+				t.Errorf("BuildEventString() = %s, want %s", got, tt.wantEvent)
+			}
+		})
+	}
+}
+
+func TestLogBackend_JSON_nonFinite(t *testing.T) {
+	b, err := NewLogBackend(config.LogConfig{File: "stdout", Format: config.FormatConfig{Mode: LogFormatJSON}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := b.BuildMetricString(job.Metric{Job: "web", Timing: "t", Value: math.Inf(1), Timestamp: time.Unix(0, 0)})
+	if !strings.Contains(got, `"value":"+Inf"`) {
+		t.Errorf("BuildMetricString() = %s, want value +Inf as a string", got)
+	}
+}
+
 func TestBuildTagString(t *testing.T) {
 	tests := []struct {
 		name string
@@ -174,6 +265,15 @@ func TestNewLogBackend(t *testing.T) {
 			name: "stderr",
 			cfg:  config.LogConfig{File: "stderr"},
 		},
+		{
+			name: "json",
+			cfg:  config.LogConfig{File: "stdout", Format: config.FormatConfig{Mode: "json"}},
+		},
+		{
+			name:    "unknown format",
+			cfg:     config.LogConfig{File: "stdout", Format: config.FormatConfig{Mode: "xml"}},
+			wantErr: true,
+		},
 		{
 			name:    "invalid location",
 			cfg:     config.LogConfig{File: "stdout", Time: config.TimeConfig{Location: "Invalid/Zone"}},
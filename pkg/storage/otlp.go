@@ -0,0 +1,377 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/chrissnell/crabby/pkg/config"
+	"github.com/chrissnell/crabby/pkg/job"
+	collogs "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	colmetrics "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
+)
+
+// OTLP transport protocols.
+const (
+	OTLPProtocolGRPC = "grpc"
+	OTLPProtocolHTTP = "http"
+)
+
+const (
+	defaultOTLPGRPCEndpoint = "localhost:4317"
+	defaultOTLPHTTPEndpoint = "http://localhost:4318"
+	defaultOTLPBatchSize    = 512
+)
+
+// OTLPBackend sends metrics and events to an OpenTelemetry collector over
+// OTLP/gRPC or OTLP/HTTP. Metrics are exported as gauge data points and
+// events as log records, with tags as attributes. Queued items are exported
+// in batches of up to the configured batch size.
+type OTLPBackend struct {
+	config    config.OTLPConfig
+	namespace string
+	timeout   time.Duration
+	resource  *resourcepb.Resource
+	scope     *commonpb.InstrumentationScope
+
+	// Set for OTLP/gRPC.
+	conn    *grpc.ClientConn
+	metrics colmetrics.MetricsServiceClient
+	logs    collogs.LogsServiceClient
+
+	// Set for OTLP/HTTP.
+	client     *http.Client
+	metricsURL string
+	logsURL    string
+}
+
+// NewOTLPBackend creates a new OTLP backend. The endpoint is a host:port for
+// gRPC and a base URL for HTTP, to which /v1/metrics and /v1/logs are added.
+func NewOTLPBackend(cfg config.OTLPConfig, requestTimeout time.Duration) (*OTLPBackend, error) {
+	if cfg.Protocol == "" {
+		cfg.Protocol = OTLPProtocolGRPC
+	}
+	if cfg.BatchSize < 0 {
+		return nil, fmt.Errorf("batch-size must not be negative")
+	}
+	if cfg.BatchSize == 0 {
+		cfg.BatchSize = defaultOTLPBatchSize
+	}
+	if cfg.ServiceName == "" {
+		cfg.ServiceName = "crabby"
+	}
+	if requestTimeout == 0 {
+		requestTimeout = 15 * time.Second
+	}
+
+	o := &OTLPBackend{
+		config:    cfg,
+		namespace: cfg.Namespace,
+		timeout:   requestTimeout,
+		resource: &resourcepb.Resource{
+			Attributes: []*commonpb.KeyValue{otlpString("service.name", cfg.ServiceName)},
+		},
+		scope: &commonpb.InstrumentationScope{Name: "github.com/chrissnell/crabby"},
+	}
+	if o.namespace == "" {
+		o.namespace = "crabby"
+	}
+
+	tlsConfig, err := newTLSConfig(cfg.CaCert, cfg.SkipCertificateValidation)
+	if err != nil {
+		return nil, err
+	}
+
+	switch cfg.Protocol {
+	case OTLPProtocolGRPC:
+		target := cfg.Endpoint
+		if target == "" {
+			target = defaultOTLPGRPCEndpoint
+		}
+		creds := credentials.NewTLS(tlsConfig)
+		if cfg.Insecure || strings.HasPrefix(target, "http://") {
+			creds = insecure.NewCredentials()
+		}
+		target = strings.TrimPrefix(strings.TrimPrefix(target, "http://"), "https://")
+		conn, err := grpc.NewClient(target, grpc.WithTransportCredentials(creds))
+		if err != nil {
+			return nil, fmt.Errorf("creating OTLP gRPC client: %w", err)
+		}
+		o.conn = conn
+		o.metrics = colmetrics.NewMetricsServiceClient(conn)
+		o.logs = collogs.NewLogsServiceClient(conn)
+	case OTLPProtocolHTTP:
+		endpoint := strings.TrimSuffix(cfg.Endpoint, "/")
+		if endpoint == "" {
+			endpoint = defaultOTLPHTTPEndpoint
+		}
+		o.client = &http.Client{
+			Transport: &http.Transport{
+				Proxy:               http.ProxyFromEnvironment,
+				TLSHandshakeTimeout: 10 * time.Second,
+				TLSClientConfig:     tlsConfig,
+			},
+			Timeout: requestTimeout,
+		}
+		o.metricsURL = endpoint + "/v1/metrics"
+		o.logsURL = endpoint + "/v1/logs"
+	default:
+		return nil, fmt.Errorf("unknown OTLP protocol %q (want %q or %q)", cfg.Protocol, OTLPProtocolGRPC, OTLPProtocolHTTP)
+	}
+	return o, nil
+}
+
+func (o *OTLPBackend) Name() string                  { return "otlp" }
+func (o *OTLPBackend) Start(_ context.Context) error { return nil }
+
+// Close closes the gRPC connection, if any.
+func (o *OTLPBackend) Close() error {
+	if o.conn != nil {
+		return o.conn.Close()
+	}
+	return nil
+}
+
+// BatchSize returns the maximum number of metrics and events per export.
+func (o *OTLPBackend) BatchSize() int { return o.config.BatchSize }
+
+// SendMetric exports a single metric.
+func (o *OTLPBackend) SendMetric(ctx context.Context, m job.Metric) error {
+	return o.SendBatch(ctx, []job.Metric{m}, nil)
+}
+
+// SendEvent exports a single event.
+func (o *OTLPBackend) SendEvent(ctx context.Context, e job.Event) error {
+	return o.SendBatch(ctx, nil, []job.Event{e})
+}
+
+// SendBatch exports metrics in one request and events in another. The
+// storage queue never passes both at once, so a failed export is retried
+// without resending the other kind.
+func (o *OTLPBackend) SendBatch(ctx context.Context, metrics []job.Metric, events []job.Event) error {
+	if len(metrics) > 0 {
+		if err := o.exportMetrics(ctx, o.metricsRequest(metrics)); err != nil {
+			return err
+		}
+	}
+	if len(events) > 0 {
+		if err := o.exportLogs(ctx, o.logsRequest(events, time.Now())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (o *OTLPBackend) exportMetrics(ctx context.Context, req *colmetrics.ExportMetricsServiceRequest) error {
+	resp := &colmetrics.ExportMetricsServiceResponse{}
+	if o.conn != nil {
+		ctx, cancel := o.grpcContext(ctx)
+		defer cancel()
+		var err error
+		if resp, err = o.metrics.Export(ctx, req); err != nil {
+			return fmt.Errorf("exporting OTLP metrics: %w", err)
+		}
+	} else if err := o.post(ctx, o.metricsURL, req, resp); err != nil {
+		return err
+	}
+	if ps := resp.GetPartialSuccess(); ps.GetRejectedDataPoints() > 0 {
+		slog.Warn("OTLP collector rejected data points", "rejected", ps.GetRejectedDataPoints(), "message", ps.GetErrorMessage())
+	}
+	return nil
+}
+
+func (o *OTLPBackend) exportLogs(ctx context.Context, req *collogs.ExportLogsServiceRequest) error {
+	resp := &collogs.ExportLogsServiceResponse{}
+	if o.conn != nil {
+		ctx, cancel := o.grpcContext(ctx)
+		defer cancel()
+		var err error
+		if resp, err = o.logs.Export(ctx, req); err != nil {
+			return fmt.Errorf("exporting OTLP logs: %w", err)
+		}
+	} else if err := o.post(ctx, o.logsURL, req, resp); err != nil {
+		return err
+	}
+	if ps := resp.GetPartialSuccess(); ps.GetRejectedLogRecords() > 0 {
+		slog.Warn("OTLP collector rejected log records", "rejected", ps.GetRejectedLogRecords(), "message", ps.GetErrorMessage())
+	}
+	return nil
+}
+
+// grpcContext bounds a gRPC export by the request timeout and attaches the
+// configured headers.
+func (o *OTLPBackend) grpcContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if len(o.config.Headers) > 0 {
+		ctx = metadata.NewOutgoingContext(ctx, metadata.New(o.config.Headers))
+	}
+	return context.WithTimeout(ctx, o.timeout)
+}
+
+// post sends req to an OTLP/HTTP endpoint as protobuf and decodes the
+// response into resp.
+func (o *OTLPBackend) post(ctx context.Context, url string, req, resp proto.Message) error {
+	body, err := proto.Marshal(req)
+	if err != nil {
+		return fmt.Errorf("encoding OTLP request: %w", err)
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	httpReq.Header.Set("Content-Type", "application/x-protobuf")
+	for k, v := range o.config.Headers {
+		httpReq.Header.Set(k, v)
+	}
+
+	res, err := o.client.Do(httpReq)
+	if err != nil {
+		return fmt.Errorf("OTLP request failed: %w", err)
+	}
+	defer res.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(res.Body, 1<<20))
+	if err != nil {
+		return fmt.Errorf("reading OTLP response: %w", err)
+	}
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return fmt.Errorf("OTLP collector returned %w", &StatusError{StatusCode: res.StatusCode})
+	}
+	if err := proto.Unmarshal(data, resp); err != nil {
+		slog.Warn("decoding OTLP response", "url", url, "error", err)
+	}
+	return nil
+}
+
+// metricsRequest converts metrics to gauges, one per metric name, named
+// <namespace>.<timing> and with the job, URL and tags as attributes.
+func (o *OTLPBackend) metricsRequest(metrics []job.Metric) *colmetrics.ExportMetricsServiceRequest {
+	var out []*metricspb.Metric
+	byName := make(map[string]*metricspb.Gauge)
+	for _, m := range metrics {
+		name := o.namespace + "." + m.Timing
+		g, ok := byName[name]
+		if !ok {
+			g = &metricspb.Gauge{}
+			om := &metricspb.Metric{Name: name, Data: &metricspb.Metric_Gauge{Gauge: g}}
+			if strings.HasSuffix(m.Timing, "_milliseconds") {
+				om.Unit = "ms"
+			}
+			byName[name] = g
+			out = append(out, om)
+		}
+		attrs := otlpAttributes(m.Tags, otlpString("crabby.job", m.Job))
+		if m.URL != "" {
+			attrs = append(attrs, otlpString("url.full", m.URL))
+		}
+		g.DataPoints = append(g.DataPoints, &metricspb.NumberDataPoint{
+			Attributes:   attrs,
+			TimeUnixNano: uint64(m.Timestamp.UnixNano()),
+			Value:        &metricspb.NumberDataPoint_AsDouble{AsDouble: m.Value},
+		})
+	}
+	return &colmetrics.ExportMetricsServiceRequest{
+		ResourceMetrics: []*metricspb.ResourceMetrics{{
+			Resource:     o.resource,
+			ScopeMetrics: []*metricspb.ScopeMetrics{{Scope: o.scope, Metrics: out}},
+		}},
+	}
+}
+
+// logsRequest converts events to log records. Healthy events are logged at
+// INFO severity, warnings at WARN and other failures at ERROR.
+func (o *OTLPBackend) logsRequest(events []job.Event, now time.Time) *collogs.ExportLogsServiceRequest {
+	records := make([]*logspb.LogRecord, 0, len(events))
+	for _, e := range events {
+		severity, severityText := logspb.SeverityNumber_SEVERITY_NUMBER_ERROR, "ERROR"
+		switch e.Level() {
+		case job.SeverityOK:
+			severity, severityText = logspb.SeverityNumber_SEVERITY_NUMBER_INFO, "INFO"
+		case job.SeverityWarning:
+			severity, severityText = logspb.SeverityNumber_SEVERITY_NUMBER_WARN, "WARN"
+		}
+
+		attrs := otlpAttributes(e.Tags, otlpString("crabby.job", e.Name))
+		if e.ServerStatus > 0 {
+			attrs = append(attrs, &commonpb.KeyValue{
+				Key:   "http.response.status_code",
+				Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_IntValue{IntValue: int64(e.ServerStatus)}},
+			})
+		}
+		if e.Reason != "" {
+			attrs = append(attrs, otlpString("crabby.reason", e.Reason))
+		}
+		if e.URL != "" {
+			attrs = append(attrs, otlpString("url.full", e.URL))
+		}
+		if e.Duration > 0 {
+			attrs = append(attrs, &commonpb.KeyValue{
+				Key:   "crabby.duration_ms",
+				Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_DoubleValue{DoubleValue: e.Duration.Seconds() * 1000}},
+			})
+		}
+		records = append(records, &logspb.LogRecord{
+			TimeUnixNano:         uint64(e.Timestamp.UnixNano()),
+			ObservedTimeUnixNano: uint64(now.UnixNano()),
+			SeverityNumber:       severity,
+			SeverityText:         severityText,
+			Body:                 &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: e.Summary()}},
+			Attributes:           attrs,
+		})
+	}
+	return &collogs.ExportLogsServiceRequest{
+		ResourceLogs: []*logspb.ResourceLogs{{
+			Resource:  o.resource,
+			ScopeLogs: []*logspb.ScopeLogs{{Scope: o.scope, LogRecords: records}},
+		}},
+	}
+}
+
+// otlpAttributes returns first followed by tags as string attributes, sorted
+// by key.
+func otlpAttributes(tags map[string]string, first ...*commonpb.KeyValue) []*commonpb.KeyValue {
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	attrs := append(make([]*commonpb.KeyValue, 0, len(first)+len(keys)), first...)
+	for _, k := range keys {
+		attrs = append(attrs, otlpString(k, tags[k]))
+	}
+	return attrs
+}
+
+func otlpString(key, value string) *commonpb.KeyValue {
+	return &commonpb.KeyValue{Key: key, Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: value}}}
+}
+
+// grpcHTTPStatus maps a gRPC status code to the HTTP status with the same
+// retry treatment, following the OTLP specification: codes it calls
+// retryable become 503 (or 429 for ResourceExhausted) and the rest become
+// 400. It returns 0 for OK and Canceled.
+func grpcHTTPStatus(c codes.Code) int {
+	switch c {
+	case codes.OK, codes.Canceled:
+		return 0
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	case codes.Unavailable, codes.DeadlineExceeded, codes.Aborted, codes.OutOfRange, codes.DataLoss:
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusBadRequest
+}
@@ -0,0 +1,275 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/chrissnell/crabby/pkg/config"
+	"github.com/chrissnell/crabby/pkg/job"
+	collogs "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	colmetrics "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// fakeCollector is an in-process stand-in for an OpenTelemetry collector
+// that records what it receives over OTLP/gRPC.
+type fakeCollector struct {
+	colmetrics.UnimplementedMetricsServiceServer
+
+	mu       sync.Mutex
+	metrics  []*colmetrics.ExportMetricsServiceRequest
+	logs     []*collogs.ExportLogsServiceRequest
+	metadata []metadata.MD
+	// err, if set, is returned from every export.
+	err error
+}
+
+func (f *fakeCollector) Export(ctx context.Context, req *colmetrics.ExportMetricsServiceRequest) (*colmetrics.ExportMetricsServiceResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return nil, f.err
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	f.metadata = append(f.metadata, md)
+	f.metrics = append(f.metrics, req)
+	return &colmetrics.ExportMetricsServiceResponse{}, nil
+}
+
+// fakeLogsServer adapts fakeCollector to the logs service, whose Export
+// method has a different signature.
+type fakeLogsServer struct {
+	collogs.UnimplementedLogsServiceServer
+	c *fakeCollector
+}
+
+func (s fakeLogsServer) Export(ctx context.Context, req *collogs.ExportLogsServiceRequest) (*collogs.ExportLogsServiceResponse, error) {
+	s.c.mu.Lock()
+	defer s.c.mu.Unlock()
+	if s.c.err != nil {
+		return nil, s.c.err
+	}
+	s.c.logs = append(s.c.logs, req)
+	return &collogs.ExportLogsServiceResponse{}, nil
+}
+
+func startFakeCollector(t *testing.T) (*fakeCollector, string) {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &fakeCollector{}
+	srv := grpc.NewServer()
+	colmetrics.RegisterMetricsServiceServer(srv, c)
+	collogs.RegisterLogsServiceServer(srv, fakeLogsServer{c: c})
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+	return c, lis.Addr().String()
+}
+
+func attrMap(attrs []*commonpb.KeyValue) map[string]string {
+	m := make(map[string]string)
+	for _, kv := range attrs {
+		if v, ok := kv.GetValue().GetValue().(*commonpb.AnyValue_IntValue); ok {
+			m[kv.GetKey()] = strconv.FormatInt(v.IntValue, 10)
+			continue
+		}
+		m[kv.GetKey()] = kv.GetValue().GetStringValue()
+	}
+	return m
+}
+
+var (
+	otlpTestMetrics = []job.Metric{
+		{Job: "web", URL: "https://example.com", Timing: "dns_duration_milliseconds", Value: 12.5, Timestamp: time.Unix(1700000000, 0), Tags: map[string]string{"env": "prod"}},
+		{Job: "api", Timing: "dns_duration_milliseconds", Value: 3, Timestamp: time.Unix(1700000000, 0)},
+		{Job: "web", Timing: "probe_success", Value: 1, Timestamp: time.Unix(1700000000, 0)},
+	}
+	otlpTestEvents = []job.Event{
+		{Name: "web", ServerStatus: 200, Timestamp: time.Unix(1700000000, 0)},
+		{Name: "api", Reason: "connect: connection refused", Timestamp: time.Unix(1700000000, 0), Tags: map[string]string{"team": "payments"}},
+	}
+)
+
+// checkOTLPRequests checks the requests produced from otlpTestMetrics and
+// otlpTestEvents.
+func checkOTLPRequests(t *testing.T, mreq *colmetrics.ExportMetricsServiceRequest, lreq *collogs.ExportLogsServiceRequest) {
+	t.Helper()
+
+	rm := mreq.GetResourceMetrics()[0]
+	if got := attrMap(rm.GetResource().GetAttributes())["service.name"]; got != "crabby" {
+		t.Errorf("service.name = %q, want crabby", got)
+	}
+	metrics := rm.GetScopeMetrics()[0].GetMetrics()
+	if len(metrics) != 2 {
+		t.Fatalf("got %d metrics, want 2 (grouped by name)", len(metrics))
+	}
+	dns := metrics[0]
+	if dns.GetName() != "crabby.dns_duration_milliseconds" || dns.GetUnit() != "ms" {
+		t.Errorf("metric = %s (%s), want crabby.dns_duration_milliseconds (ms)", dns.GetName(), dns.GetUnit())
+	}
+	points := dns.GetGauge().GetDataPoints()
+	if len(points) != 2 {
+		t.Fatalf("got %d data points, want 2", len(points))
+	}
+	attrs := attrMap(points[0].GetAttributes())
+	if attrs["crabby.job"] != "web" || attrs["url.full"] != "https://example.com" || attrs["env"] != "prod" {
+		t.Errorf("data point attributes = %v", attrs)
+	}
+	if points[0].GetAsDouble() != 12.5 || points[0].GetTimeUnixNano() != uint64(time.Unix(1700000000, 0).UnixNano()) {
+		t.Errorf("data point = %v", points[0])
+	}
+
+	records := lreq.GetResourceLogs()[0].GetScopeLogs()[0].GetLogRecords()
+	if len(records) != 2 {
+		t.Fatalf("got %d log records, want 2", len(records))
+	}
+	if r := records[0]; r.GetSeverityNumber() != logspb.SeverityNumber_SEVERITY_NUMBER_INFO ||
+		r.GetBody().GetStringValue() != "web returned status 200" ||
+		attrMap(r.GetAttributes())["http.response.status_code"] != "200" {
+		t.Errorf("healthy record = %v", r)
+	}
+	if r := records[1]; r.GetSeverityNumber() != logspb.SeverityNumber_SEVERITY_NUMBER_ERROR ||
+		r.GetBody().GetStringValue() != "api failed: connect: connection refused" ||
+		attrMap(r.GetAttributes())["team"] != "payments" {
+		t.Errorf("failed record = %v", r)
+	}
+}
+
+func TestOTLPBackend_gRPC(t *testing.T) {
+	c, addr := startFakeCollector(t)
+	b, err := NewOTLPBackend(config.OTLPConfig{
+		Endpoint: addr,
+		Insecure: true,
+		Headers:  map[string]string{"x-api-key": "secret"},
+	}, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	if err := b.SendBatch(context.Background(), otlpTestMetrics, otlpTestEvents); err != nil {
+		t.Fatalf("SendBatch() error = %v", err)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.metrics) != 1 || len(c.logs) != 1 {
+		t.Fatalf("collector got %d metric and %d log requests, want 1 each", len(c.metrics), len(c.logs))
+	}
+	checkOTLPRequests(t, c.metrics[0], c.logs[0])
+	if got := c.metadata[0].Get("x-api-key"); len(got) != 1 || got[0] != "secret" {
+		t.Errorf("x-api-key metadata = %v, want secret", got)
+	}
+}
+
+func TestOTLPBackend_gRPCError(t *testing.T) {
+	c, addr := startFakeCollector(t)
+	c.err = status.Error(codes.Unavailable, "collector overloaded")
+	b, err := NewOTLPBackend(config.OTLPConfig{Endpoint: addr, Insecure: true}, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	err = b.SendMetric(context.Background(), otlpTestMetrics[0])
+	if got := classifySendError(err); got != Retry5xx {
+		t.Errorf("classifySendError(%v) = %q, want %q", err, got, Retry5xx)
+	}
+}
+
+func TestOTLPBackend_HTTP(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		mreq  = &colmetrics.ExportMetricsServiceRequest{}
+		lreq  = &collogs.ExportLogsServiceRequest{}
+		paths []string
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		paths = append(paths, r.URL.Path)
+		if r.Header.Get("Content-Type") != "application/x-protobuf" || r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		var msg proto.Message = mreq
+		if r.URL.Path == "/v1/logs" {
+			msg = lreq
+		}
+		if err := proto.Unmarshal(body, msg); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer srv.Close()
+
+	b, err := NewOTLPBackend(config.OTLPConfig{
+		Endpoint: srv.URL + "/",
+		Protocol: OTLPProtocolHTTP,
+		Headers:  map[string]string{"Authorization": "Bearer token"},
+	}, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := b.SendBatch(context.Background(), otlpTestMetrics, otlpTestEvents); err != nil {
+		t.Fatalf("SendBatch() error = %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if got := strings.Join(paths, ","); got != "/v1/metrics,/v1/logs" {
+		t.Errorf("paths = %s, want /v1/metrics,/v1/logs", got)
+	}
+	checkOTLPRequests(t, mreq, lreq)
+}
+
+func TestOTLPBackend_HTTPError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer srv.Close()
+
+	b, err := NewOTLPBackend(config.OTLPConfig{Endpoint: srv.URL, Protocol: OTLPProtocolHTTP}, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = b.SendEvent(context.Background(), otlpTestEvents[0])
+	if got := classifySendError(err); got != Retry429 {
+		t.Errorf("classifySendError(%v) = %q, want %q", err, got, Retry429)
+	}
+}
+
+func TestNewOTLPBackend_invalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     config.OTLPConfig
+		wantErr string
+	}{
+		{name: "unknown protocol", cfg: config.OTLPConfig{Protocol: "udp"}, wantErr: `unknown OTLP protocol "udp"`},
+		{name: "negative batch size", cfg: config.OTLPConfig{BatchSize: -1}, wantErr: "batch-size"},
+		{name: "missing CA", cfg: config.OTLPConfig{CaCert: "/nonexistent/ca.pem"}, wantErr: "reading ca-cert"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewOTLPBackend(tt.cfg, 0)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error = %v, want containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -2,8 +2,14 @@ package storage
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strconv"
+	"sync"
 	"time"
 
 	"github.com/PagerDuty/go-pagerduty"
@@ -11,13 +17,33 @@ import (
 	"github.com/chrissnell/crabby/pkg/job"
 )
 
-// PagerDutyBackend sends events to PagerDuty.
+// incident is an open PagerDuty incident for one job.
+type incident struct {
+	DedupKey     string    `json:"dedup_key"`
+	TriggeredAt  time.Time `json:"triggered_at"`
+	Acknowledged bool      `json:"acknowledged,omitempty"`
+	// EventKeys are the eventTimestamps entries that throttle re-triggers
+	// of this incident. They are saved so that an acknowledged incident
+	// isn't triggered again after a restart.
+	EventKeys []string `json:"event_keys,omitempty"`
+}
+
+// PagerDutyBackend sends events to PagerDuty. Each job has at most one open
+// incident, identified by a stable dedup key: failures trigger it and the
+// job's next successful result resolves it.
 type PagerDutyBackend struct {
-	config          config.PagerDutyConfig
+	config config.PagerDutyConfig
+	// manageEvent sends an event to the PagerDuty Events API. Tests replace it.
+	manageEvent func(context.Context, pagerduty.V2Event) (*pagerduty.V2EventResponse, error)
+
+	mu              sync.Mutex
 	eventTimestamps map[string]time.Time
+	incidents       map[string]*incident
 }
 
-// NewPagerDutyBackend creates a new PagerDuty backend.
+// NewPagerDutyBackend creates a new PagerDuty backend. If the config names a
+// state file, incidents left open by a previous run are loaded from it so
+// they can still be resolved.
 func NewPagerDutyBackend(cfg config.PagerDutyConfig) (*PagerDutyBackend, error) {
 	if cfg.RoutingKey == "" {
 		return nil, errors.New("missing PagerDuty routing key")
@@ -31,61 +57,226 @@ func NewPagerDutyBackend(cfg config.PagerDutyConfig) (*PagerDutyBackend, error)
 	if cfg.EventDuration == 0 {
 		cfg.EventDuration = time.Hour
 	}
+	for _, sev := range cfg.AcknowledgeSeverities {
+		switch job.Severity(sev) {
+		case job.SeverityWarning, job.SeverityError, job.SeverityCritical:
+		default:
+			return nil, fmt.Errorf("invalid PagerDuty acknowledge severity %q", sev)
+		}
+	}
 
-	return &PagerDutyBackend{
+	p := &PagerDutyBackend{
 		config:          cfg,
+		manageEvent:     pagerduty.ManageEventWithContext,
 		eventTimestamps: make(map[string]time.Time),
-	}, nil
+		incidents:       make(map[string]*incident),
+	}
+	if err := p.loadState(); err != nil {
+		return nil, err
+	}
+	return p, nil
 }
 
 func (p *PagerDutyBackend) Name() string                  { return "pagerduty" }
 func (p *PagerDutyBackend) Start(_ context.Context) error { return nil }
 func (p *PagerDutyBackend) Close() error                  { return nil }
 
-// SendEvent sends an event to PagerDuty for error responses.
+// DedupKey returns the dedup key of the incident for a job. It is the same
+// for every run, so repeated failures update one incident.
+func (p *PagerDutyBackend) DedupKey(jobName string) string {
+	return fmt.Sprintf("%v.%v", p.config.Namespace, jobName)
+}
+
+// SendEvent triggers an incident at the event's severity for error responses
+// and failed probes, and resolves the job's open incident once it succeeds
+// again. Events at one of the acknowledge severities acknowledge the open
+// incident instead. While a job keeps failing with the same status, the
+// trigger is repeated at most once per event duration, and not at all once
+// the incident has been acknowledged.
 func (p *PagerDutyBackend) SendEvent(ctx context.Context, e job.Event) error {
-	if e.ServerStatus < 400 {
-		return nil
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	severity := pagerDutySeverity(e)
+	if severity == "" {
+		return p.resolve(ctx, e)
+	}
+	if slices.Contains(p.config.AcknowledgeSeverities, severity) {
+		return p.acknowledge(ctx, e)
 	}
 
 	eventKey := fmt.Sprintf("%s-%d", e.Name, e.ServerStatus)
+	inc := p.incidents[e.Name]
+	if inc != nil && inc.Acknowledged && slices.Contains(inc.EventKeys, eventKey) {
+		return nil
+	}
 	lastOccurrence := p.eventTimestamps[eventKey]
 	if !e.Timestamp.After(lastOccurrence.Add(p.config.EventDuration)) {
 		return nil
 	}
 
-	p.eventTimestamps[eventKey] = e.Timestamp
-
-	eventName := fmt.Sprintf("%v.%v", p.config.Namespace, e.Name)
-
-	var severity string
-	if e.ServerStatus < 500 {
-		severity = "error"
-	} else {
-		severity = "critical"
-	}
-
-	dedupKey := fmt.Sprintf("%s-%d", eventKey, e.Timestamp.UnixNano())
-	event := pagerduty.V2Event{
+	dedupKey := p.DedupKey(e.Name)
+	err := p.send(ctx, pagerduty.V2Event{
 		Client:     p.config.Client,
 		Action:     "trigger",
 		DedupKey:   dedupKey,
 		RoutingKey: p.config.RoutingKey,
 		Payload: &pagerduty.V2Payload{
-			Summary:   fmt.Sprintf("%v returned status %v", eventName, e.ServerStatus),
+			Summary:   fmt.Sprintf("%v: %v", p.config.Namespace, e.Summary()),
 			Source:    p.config.Client,
 			Severity:  severity,
 			Timestamp: e.Timestamp.Format("2006-01-02T15:04:05.000-0700"),
-			Details:   e.Tags,
+			Details:   pagerDutyDetails(e),
 		},
+	})
+	if err != nil {
+		return err
+	}
+
+	p.eventTimestamps[eventKey] = e.Timestamp
+	if inc == nil {
+		inc = &incident{DedupKey: dedupKey, TriggeredAt: e.Timestamp}
+		p.incidents[e.Name] = inc
+	}
+	if !slices.Contains(inc.EventKeys, eventKey) {
+		inc.EventKeys = append(inc.EventKeys, eventKey)
+	}
+	return p.saveState()
+}
+
+// pagerDutySeverity returns the PagerDuty severity for e, or "" if e is
+// healthy. Events without a severity, such as those spooled by earlier
+// versions, only count as failures with a reason or a 4xx or 5xx status.
+func pagerDutySeverity(e job.Event) string {
+	if e.Severity == "" && e.ServerStatus < 400 && e.Reason == "" {
+		return ""
+	}
+	switch e.Level() {
+	case job.SeverityOK:
+		return ""
+	case job.SeverityWarning:
+		return "warning"
+	case job.SeverityError:
+		return "error"
+	}
+	return "critical"
+}
+
+// pagerDutyDetails returns the custom details of the incident triggered by
+// e: its tags along with the probe's URL, status, reason, duration and
+// message.
+func pagerDutyDetails(e job.Event) map[string]string {
+	details := make(map[string]string, len(e.Tags)+5)
+	maps.Copy(details, e.Tags)
+	for k, v := range map[string]string{
+		"url":     e.URL,
+		"reason":  e.Reason,
+		"message": e.Message,
+	} {
+		if v != "" {
+			details[k] = v
+		}
+	}
+	if e.ServerStatus > 0 {
+		details["status"] = strconv.Itoa(e.ServerStatus)
+	}
+	if e.Duration > 0 {
+		details["duration"] = e.Duration.String()
+	}
+	return details
+}
+
+// resolve resolves the open incident for the job that produced e, if any.
+// p.mu must be held.
+func (p *PagerDutyBackend) resolve(ctx context.Context, e job.Event) error {
+	inc, ok := p.incidents[e.Name]
+	if !ok {
+		return nil
+	}
+	err := p.send(ctx, pagerduty.V2Event{
+		Client:     p.config.Client,
+		Action:     "resolve",
+		DedupKey:   inc.DedupKey,
+		RoutingKey: p.config.RoutingKey,
+	})
+	if err != nil {
+		return err
+	}
+
+	delete(p.incidents, e.Name)
+	for _, k := range inc.EventKeys {
+		delete(p.eventTimestamps, k)
+	}
+	return p.saveState()
+}
+
+// acknowledge acknowledges the open incident for the job that produced e,
+// if it has one that isn't acknowledged yet. PagerDuty stops escalating it,
+// and it is still resolved when the job recovers. p.mu must be held.
+func (p *PagerDutyBackend) acknowledge(ctx context.Context, e job.Event) error {
+	inc, ok := p.incidents[e.Name]
+	if !ok || inc.Acknowledged {
+		return nil
 	}
+	err := p.send(ctx, pagerduty.V2Event{
+		Client:     p.config.Client,
+		Action:     "acknowledge",
+		DedupKey:   inc.DedupKey,
+		RoutingKey: p.config.RoutingKey,
+	})
+	if err != nil {
+		return err
+	}
+	inc.Acknowledged = true
+	return p.saveState()
+}
 
-	response, err := pagerduty.ManageEventWithContext(ctx, event)
+func (p *PagerDutyBackend) send(ctx context.Context, event pagerduty.V2Event) error {
+	response, err := p.manageEvent(ctx, event)
 	if err != nil {
-		return fmt.Errorf("sending PagerDuty event: %w", err)
+		return fmt.Errorf("sending PagerDuty %s event: %w", event.Action, err)
 	}
 	if response.Status != "success" {
-		return fmt.Errorf("PagerDuty event failed, response: %+v", response)
+		return fmt.Errorf("PagerDuty %s event failed, response: %+v", event.Action, response)
+	}
+	return nil
+}
+
+// loadState reads open incidents from the state file, if one is configured
+// and exists.
+func (p *PagerDutyBackend) loadState() error {
+	if p.config.StateFile == "" {
+		return nil
+	}
+	data, err := os.ReadFile(p.config.StateFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("reading PagerDuty state: %w", err)
+	}
+	if err := json.Unmarshal(data, &p.incidents); err != nil {
+		return fmt.Errorf("parsing PagerDuty state %s: %w", p.config.StateFile, err)
+	}
+	return nil
+}
+
+// saveState writes the open incidents to the state file, if one is
+// configured. p.mu must be held.
+func (p *PagerDutyBackend) saveState() error {
+	if p.config.StateFile == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(p.incidents, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding PagerDuty state: %w", err)
+	}
+	tmp := p.config.StateFile + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("writing PagerDuty state: %w", err)
+	}
+	if err := os.Rename(tmp, p.config.StateFile); err != nil {
+		return fmt.Errorf("writing PagerDuty state: %w", err)
 	}
 	return nil
 }
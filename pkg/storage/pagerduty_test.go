@@ -2,9 +2,14 @@ package storage
 
 import (
 	"context"
+	"errors"
+	"maps"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/PagerDuty/go-pagerduty"
 	"github.com/chrissnell/crabby/pkg/config"
 	"github.com/chrissnell/crabby/pkg/job"
 )
@@ -24,6 +29,11 @@ func TestNewPagerDutyBackend(t *testing.T) {
 			name: "valid config",
 			cfg:  config.PagerDutyConfig{RoutingKey: "test-key"},
 		},
+		{
+			name:    "invalid acknowledge severity",
+			cfg:     config.PagerDutyConfig{RoutingKey: "test-key", AcknowledgeSeverities: []string{"ok"}},
+			wantErr: true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -121,3 +131,264 @@ func TestPagerDutyBackend_SendEvent_deduplication(t *testing.T) {
 		t.Errorf("eventTimestamps was updated for deduped event: got %v, want %v", ts, now)
 	}
 }
+
+// fakePagerDuty records the events a PagerDutyBackend sends.
+type fakePagerDuty struct {
+	events []pagerduty.V2Event
+	err    error
+}
+
+func (f *fakePagerDuty) manageEvent(_ context.Context, e pagerduty.V2Event) (*pagerduty.V2EventResponse, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	f.events = append(f.events, e)
+	return &pagerduty.V2EventResponse{Status: "success", DedupKey: e.DedupKey}, nil
+}
+
+func (f *fakePagerDuty) actions() string {
+	var s []string
+	for _, e := range f.events {
+		s = append(s, e.Action+":"+e.DedupKey)
+	}
+	return strings.Join(s, ",")
+}
+
+func newTestPagerDuty(t *testing.T, cfg config.PagerDutyConfig) (*PagerDutyBackend, *fakePagerDuty) {
+	t.Helper()
+	cfg.RoutingKey = "test-key"
+	b, err := NewPagerDutyBackend(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fake := &fakePagerDuty{}
+	b.manageEvent = fake.manageEvent
+	return b, fake
+}
+
+func TestPagerDutyBackend_SendEvent_lifecycle(t *testing.T) {
+	b, fake := newTestPagerDuty(t, config.PagerDutyConfig{EventDuration: time.Hour})
+	ctx := context.Background()
+	now := time.Now()
+
+	steps := []job.Event{
+		{Name: "web", ServerStatus: 200, Timestamp: now},                                                 // no incident: nothing sent
+		{Name: "web", ServerStatus: 503, Timestamp: now.Add(time.Minute)},                                // trigger
+		{Name: "web", ServerStatus: 503, Timestamp: now.Add(2 * time.Minute)},                            // throttled
+		{Name: "web", ServerStatus: 0, Reason: "timeout: deadline", Timestamp: now.Add(3 * time.Minute)}, // new failure mode: trigger
+		{Name: "web", ServerStatus: 200, Timestamp: now.Add(4 * time.Minute)},                            // resolve
+		{Name: "web", ServerStatus: 200, Timestamp: now.Add(5 * time.Minute)},                            // already resolved
+		{Name: "web", ServerStatus: 503, Timestamp: now.Add(6 * time.Minute)},                            // fails again: trigger at once
+	}
+	for _, e := range steps {
+		if err := b.SendEvent(ctx, e); err != nil {
+			t.Fatalf("SendEvent(%+v): %v", e, err)
+		}
+	}
+
+	want := "trigger:crabby.web,trigger:crabby.web,resolve:crabby.web,trigger:crabby.web"
+	if got := fake.actions(); got != want {
+		t.Errorf("sent %s, want %s", got, want)
+	}
+	if fake.events[2].Payload != nil {
+		t.Errorf("resolve event has a payload: %+v", fake.events[2].Payload)
+	}
+	if got := fake.events[1].Payload.Summary; got != "crabby: web failed: timeout: deadline" {
+		t.Errorf("summary = %q", got)
+	}
+}
+
+func TestPagerDutyBackend_SendEvent_severity(t *testing.T) {
+	tests := []struct {
+		name         string
+		event        job.Event
+		wantSeverity string // "" if nothing is sent
+	}{
+		{name: "legacy 4xx", event: job.Event{ServerStatus: 404}, wantSeverity: "error"},
+		{name: "legacy 5xx", event: job.Event{ServerStatus: 502}, wantSeverity: "critical"},
+		{name: "legacy reason", event: job.Event{Reason: "timeout"}, wantSeverity: "critical"},
+		{name: "warning", event: job.Event{ServerStatus: 0, Severity: job.SeverityWarning, Reason: "certificate expires in 3 days"}, wantSeverity: "warning"},
+		{name: "critical", event: job.Event{ServerStatus: 200, Severity: job.SeverityCritical, Reason: "assertion failed"}, wantSeverity: "critical"},
+		{name: "ok without status", event: job.Event{Severity: job.SeverityOK}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, fake := newTestPagerDuty(t, config.PagerDutyConfig{})
+			e := tt.event
+			e.Name, e.Timestamp = "web", time.Now()
+			if err := b.SendEvent(context.Background(), e); err != nil {
+				t.Fatal(err)
+			}
+			if tt.wantSeverity == "" {
+				if len(fake.events) != 0 {
+					t.Errorf("sent %s, want nothing", fake.actions())
+				}
+				return
+			}
+			if len(fake.events) != 1 || fake.events[0].Payload.Severity != tt.wantSeverity {
+				t.Errorf("sent %+v, want one trigger with severity %s", fake.events, tt.wantSeverity)
+			}
+		})
+	}
+}
+
+func TestPagerDutyBackend_SendEvent_details(t *testing.T) {
+	b, fake := newTestPagerDuty(t, config.PagerDutyConfig{})
+	err := b.SendEvent(context.Background(), job.Event{
+		Name:         "web",
+		ServerStatus: 503,
+		Timestamp:    time.Now(),
+		Tags:         map[string]string{"team": "payments"},
+		Severity:     job.SeverityCritical,
+		URL:          "https://example.com",
+		Duration:     1200 * time.Millisecond,
+		Message:      "web (https://example.com) returned status 503 after 1.2s",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"team":     "payments",
+		"url":      "https://example.com",
+		"status":   "503",
+		"duration": "1.2s",
+		"message":  "web (https://example.com) returned status 503 after 1.2s",
+	}
+	got, _ := fake.events[0].Payload.Details.(map[string]string)
+	if !maps.Equal(got, want) {
+		t.Errorf("details = %v, want %v", fake.events[0].Payload.Details, want)
+	}
+}
+
+func TestPagerDutyBackend_SendEvent_summary(t *testing.T) {
+	b, fake := newTestPagerDuty(t, config.PagerDutyConfig{Namespace: "prod"})
+	err := b.SendEvent(context.Background(), job.Event{
+		Name:      "checkout",
+		Timestamp: time.Now(),
+		Severity:  job.SeverityCritical,
+		Reason:    "body does not contain \"Order placed\"",
+		Message:   "checkout flow is broken: no order confirmation",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := fake.events[0].Payload.Summary, "prod: checkout flow is broken: no order confirmation"; got != want {
+		t.Errorf("summary = %q, want %q", got, want)
+	}
+}
+
+func TestPagerDutyBackend_SendEvent_failedSendKeepsState(t *testing.T) {
+	b, fake := newTestPagerDuty(t, config.PagerDutyConfig{})
+	ctx := context.Background()
+	now := time.Now()
+
+	fake.err = errors.New("connection refused")
+	if err := b.SendEvent(ctx, job.Event{Name: "web", ServerStatus: 500, Timestamp: now}); err == nil {
+		t.Fatal("expected an error")
+	}
+	// The failed trigger didn't open an incident, so a retry is sent.
+	fake.err = nil
+	if err := b.SendEvent(ctx, job.Event{Name: "web", ServerStatus: 500, Timestamp: now}); err != nil {
+		t.Fatal(err)
+	}
+	// A failed resolve leaves the incident open for the next success.
+	fake.err = errors.New("connection refused")
+	if err := b.SendEvent(ctx, job.Event{Name: "web", ServerStatus: 200, Timestamp: now}); err == nil {
+		t.Fatal("expected an error")
+	}
+	fake.err = nil
+	if err := b.SendEvent(ctx, job.Event{Name: "web", ServerStatus: 200, Timestamp: now}); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := fake.actions(), "trigger:crabby.web,resolve:crabby.web"; got != want {
+		t.Errorf("sent %s, want %s", got, want)
+	}
+}
+
+func TestPagerDutyBackend_SendEvent_acknowledge(t *testing.T) {
+	b, fake := newTestPagerDuty(t, config.PagerDutyConfig{
+		Namespace:             "prod",
+		AcknowledgeSeverities: []string{"warning"},
+		EventDuration:         time.Nanosecond,
+	})
+	ctx := context.Background()
+	now := time.Now()
+	warning := job.Event{Name: "api", Severity: job.SeverityWarning, Reason: "slow"}
+
+	// A warning without an open incident doesn't open one.
+	warning.Timestamp = now
+	if err := b.SendEvent(ctx, warning); err != nil {
+		t.Fatal(err)
+	}
+	for i, e := range []job.Event{
+		{Name: "api", ServerStatus: 502, Timestamp: now.Add(1 * time.Second)},
+		warning,
+		warning,
+		// Once acknowledged, the same failure isn't triggered again...
+		{Name: "api", ServerStatus: 502, Timestamp: now.Add(2 * time.Second)},
+		// ...but a different one is.
+		{Name: "api", ServerStatus: 504, Timestamp: now.Add(3 * time.Second)},
+		{Name: "api", ServerStatus: 200, Timestamp: now.Add(4 * time.Second)},
+	} {
+		if err := b.SendEvent(ctx, e); err != nil {
+			t.Fatalf("event %d: %v", i, err)
+		}
+	}
+	if got, want := fake.actions(), "trigger:prod.api,acknowledge:prod.api,trigger:prod.api,resolve:prod.api"; got != want {
+		t.Errorf("sent %s, want %s", got, want)
+	}
+}
+
+func TestPagerDutyBackend_StateFile(t *testing.T) {
+	state := filepath.Join(t.TempDir(), "pagerduty.json")
+	ctx := context.Background()
+
+	b, _ := newTestPagerDuty(t, config.PagerDutyConfig{StateFile: state})
+	if err := b.SendEvent(ctx, job.Event{Name: "web", ServerStatus: 500, Timestamp: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+
+	// After a restart, the incident opened by the previous run is resolved.
+	b, fake := newTestPagerDuty(t, config.PagerDutyConfig{StateFile: state})
+	if err := b.SendEvent(ctx, job.Event{Name: "web", ServerStatus: 200, Timestamp: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := fake.actions(), "resolve:crabby.web"; got != want {
+		t.Errorf("sent %s, want %s", got, want)
+	}
+
+	b, fake = newTestPagerDuty(t, config.PagerDutyConfig{StateFile: state})
+	if err := b.SendEvent(ctx, job.Event{Name: "web", ServerStatus: 200, Timestamp: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+	if len(fake.events) != 0 {
+		t.Errorf("resolved incident was resolved again: %s", fake.actions())
+	}
+}
+
+func TestPagerDutyBackend_StateFile_acknowledged(t *testing.T) {
+	state := filepath.Join(t.TempDir(), "pagerduty.json")
+	cfg := config.PagerDutyConfig{StateFile: state, AcknowledgeSeverities: []string{"warning"}, EventDuration: time.Nanosecond}
+	ctx := context.Background()
+	now := time.Now()
+
+	b, _ := newTestPagerDuty(t, cfg)
+	for _, e := range []job.Event{
+		{Name: "web", ServerStatus: 500, Timestamp: now},
+		{Name: "web", Severity: job.SeverityWarning, Reason: "slow", Timestamp: now.Add(time.Second)},
+	} {
+		if err := b.SendEvent(ctx, e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// After a restart, the acknowledged incident isn't triggered again for
+	// the same failure.
+	b, fake := newTestPagerDuty(t, cfg)
+	if err := b.SendEvent(ctx, job.Event{Name: "web", ServerStatus: 500, Timestamp: now.Add(2 * time.Second)}); err != nil {
+		t.Fatal(err)
+	}
+	if len(fake.events) != 0 {
+		t.Errorf("acknowledged incident was triggered again: %s", fake.actions())
+	}
+}
@@ -4,32 +4,121 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
+	"maps"
 	"net/http"
+	"slices"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/chrissnell/crabby/pkg/config"
 	"github.com/chrissnell/crabby/pkg/job"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	dto "github.com/prometheus/client_model/go"
+	"google.golang.org/protobuf/proto"
 )
 
-// PrometheusBackend exposes metrics via a Prometheus endpoint.
+// Ways of exposing a timing metric.
+const (
+	TimingHistogram = "histogram"
+	TimingSummary   = "summary"
+	TimingGauge     = "gauge"
+)
+
+// DefaultPrometheusBuckets are the histogram buckets used for timings, in
+// milliseconds, unless the config sets its own.
+var DefaultPrometheusBuckets = []float64{5, 10, 25, 50, 100, 250, 500, 1000, 2500, 5000, 10000}
+
+var defaultSummaryObjectives = map[float64]float64{0.5: 0.05, 0.9: 0.01, 0.99: 0.001}
+
+// PrometheusBackend exposes metrics via a Prometheus endpoint. Timings (metrics
+// whose names end in _milliseconds) are recorded as histograms or summaries so
+// that every sample counts, and everything else is exposed as a gauge. Each
+// probe_success sample also updates last_run_timestamp_seconds for the job.
+//
+// Jobs may carry different tags, so a metric's label names are the union of
+// the labels of all its series, and a series without one of them exposes it
+// as empty. Series that haven't been updated within the series TTL are
+// dropped at the next scrape.
 type PrometheusBackend struct {
-	listenAddr        string
-	namespace         string
-	registry          *prometheus.Registry
-	registeredMetrics map[string]*prometheus.GaugeVec
-	server            *http.Server
+	listenAddr string
+	namespace  string
+	config     config.PrometheusConfig
+	seriesTTL  time.Duration
+	registry   *prometheus.Registry
+	server     *http.Server
+	// now returns the current time. Tests replace it.
+	now func() time.Time
+
+	mu       sync.Mutex
+	families map[string]*prometheusFamily
+}
+
+// prometheusFamily holds every series of one metric name.
+type prometheusFamily struct {
+	name   string
+	help   string
+	typ    string
+	timing string
+	// labelNames is the sorted union of the series' label names.
+	labelNames []string
+	desc       *prometheus.Desc
+	series     map[string]*prometheusSeries
+}
+
+// prometheusSeries is one label set of a family. Its metric carries no labels
+// of its own; they are attached from the family's label names on collection.
+type prometheusSeries struct {
+	labels  map[string]string
+	metric  prometheus.Metric
+	updated time.Time
 }
 
 // NewPrometheusBackend creates a new Prometheus backend.
-func NewPrometheusBackend(cfg config.PrometheusConfig) *PrometheusBackend {
-	return &PrometheusBackend{
-		listenAddr:        cfg.ListenAddr,
-		namespace:         strings.ReplaceAll(cfg.Namespace, "-", "_"),
-		registry:          prometheus.NewRegistry(),
-		registeredMetrics: make(map[string]*prometheus.GaugeVec),
+func NewPrometheusBackend(cfg config.PrometheusConfig) (*PrometheusBackend, error) {
+	types := map[string]string{"timing-type": cfg.TimingType}
+	for name, t := range cfg.Timings {
+		types["timings."+name+".type"] = t.Type
+	}
+	for field, t := range types {
+		switch t {
+		case "", TimingHistogram, TimingSummary, TimingGauge:
+		default:
+			return nil, fmt.Errorf("%s: unknown timing type %q (want %s, %s or %s)",
+				field, t, TimingHistogram, TimingSummary, TimingGauge)
+		}
 	}
+	if !slices.IsSorted(cfg.Buckets) {
+		return nil, fmt.Errorf("buckets must be in increasing order")
+	}
+	for name, t := range cfg.Timings {
+		if !slices.IsSorted(t.Buckets) {
+			return nil, fmt.Errorf("timings.%s.buckets must be in increasing order", name)
+		}
+	}
+	var ttl time.Duration
+	if cfg.SeriesTTL != "" {
+		var err error
+		ttl, err = time.ParseDuration(cfg.SeriesTTL)
+		if err != nil || ttl < 0 {
+			return nil, fmt.Errorf("invalid series-ttl %q", cfg.SeriesTTL)
+		}
+	}
+
+	p := &PrometheusBackend{
+		listenAddr: cfg.ListenAddr,
+		namespace:  strings.ReplaceAll(cfg.Namespace, "-", "_"),
+		config:     cfg,
+		seriesTTL:  ttl,
+		registry:   prometheus.NewRegistry(),
+		now:        time.Now,
+		families:   make(map[string]*prometheusFamily),
+	}
+	if err := p.registry.Register(p); err != nil {
+		return nil, fmt.Errorf("registering Prometheus collector: %w", err)
+	}
+	return p, nil
 }
 
 func (p *PrometheusBackend) Name() string { return "prometheus" }
@@ -68,39 +157,245 @@ func (p *PrometheusBackend) Close() error {
 
 // SendMetric records a metric value for Prometheus scraping.
 func (p *PrometheusBackend) SendMetric(_ context.Context, m job.Metric) error {
+	tags := prometheusLabels(m.Tags)
+	tags["crabby_job"] = m.Job
+	tags["url"] = m.URL
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if err := p.record(m.Timing, p.timingType(m), tags, m.Value); err != nil {
+		return err
+	}
+	if m.Timing == "probe_success" {
+		return p.record("last_run_timestamp_seconds", TimingGauge, tags, float64(m.Timestamp.UnixNano())/1e9)
+	}
+	return nil
+}
+
+// record sets or observes value in the series of the named family with the
+// given labels, creating either on first use. p.mu must be held.
+func (p *PrometheusBackend) record(timing, typ string, labels map[string]string, value float64) error {
+	metricName := p.metricName(timing)
+	f, present := p.families[metricName]
+	if !present {
+		f = &prometheusFamily{
+			name:   metricName,
+			help:   "Crabby metric " + timing,
+			typ:    typ,
+			timing: timing,
+			series: make(map[string]*prometheusSeries),
+		}
+		if typ != TimingGauge {
+			f.help = "Crabby timing metric, in milliseconds"
+		}
+		p.families[metricName] = f
+	}
+
+	key := seriesKey(labels)
+	s, present := f.series[key]
+	if !present {
+		s = &prometheusSeries{labels: labels, metric: p.newMetric(f)}
+		f.series[key] = s
+		f.updateLabelNames()
+	}
+	s.updated = p.now()
+
+	switch m := s.metric.(type) {
+	case prometheus.Gauge:
+		m.Set(value)
+	case prometheus.Observer:
+		m.Observe(value)
+	default:
+		return fmt.Errorf("metric %v has no way to record values", metricName)
+	}
+	return nil
+}
+
+func (p *PrometheusBackend) metricName(timing string) string {
+	return prometheusMetricName(p.namespace, timing)
+}
+
+// prometheusMetricName returns the Prometheus name of a timing: the
+// namespace (default crabby) and timing joined by an underscore, with dots
+// replaced.
+func prometheusMetricName(namespace, timing string) string {
 	var metricName string
-	if p.namespace == "" {
-		metricName = fmt.Sprintf("crabby_%v", m.Timing)
+	if namespace == "" {
+		metricName = fmt.Sprintf("crabby_%v", timing)
 	} else {
-		metricName = fmt.Sprintf("%v_%v", p.namespace, m.Timing)
+		metricName = fmt.Sprintf("%v_%v", namespace, timing)
 	}
+	return strings.ReplaceAll(metricName, ".", "_")
+}
 
-	if m.Tags == nil {
-		m.Tags = make(map[string]string)
+// prometheusLabelName replaces the characters not allowed in a classic
+// Prometheus label name with underscores.
+func prometheusLabelName(name string) string {
+	b := []byte(name)
+	for i, c := range b {
+		if !(c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' && i > 0) {
+			b[i] = '_'
+		}
 	}
-	m.Tags["crabby_job"] = m.Job
-	m.Tags["url"] = m.URL
+	return string(b)
+}
 
-	metricName = strings.ReplaceAll(metricName, ".", "_")
-	labelNames := MakePrometheusLabels(m.Tags)
+// prometheusLabels returns tags as Prometheus labels, with their names made
+// valid by prometheusLabelName. Tags with empty names or values are left
+// out, and if several names become the same label, the first in sorted order
+// wins.
+func prometheusLabels(tags map[string]string) map[string]string {
+	labels := make(map[string]string, len(tags)+2)
+	for _, k := range slices.Sorted(maps.Keys(tags)) {
+		name := prometheusLabelName(k)
+		if _, dup := labels[name]; name == "" || dup || tags[k] == "" {
+			continue
+		}
+		labels[name] = tags[k]
+	}
+	return labels
+}
+
+// timingType returns how m should be exposed: the configured type for job
+// timings, and a gauge for everything else.
+func (p *PrometheusBackend) timingType(m job.Metric) string {
+	if !strings.HasSuffix(m.Timing, "_milliseconds") || m.Job == "internal_metrics" {
+		return TimingGauge
+	}
+	if t := p.config.Timings[m.Timing].Type; t != "" {
+		return t
+	}
+	if p.config.TimingType != "" {
+		return p.config.TimingType
+	}
+	return TimingHistogram
+}
 
-	if gv, present := p.registeredMetrics[metricName]; present {
-		metric, err := gv.GetMetricWith(m.Tags)
-		if err != nil {
-			return fmt.Errorf("getting metric %v with tags %+v: %w", metricName, m.Tags, err)
+// newMetric returns an unlabelled metric of f's type.
+func (p *PrometheusBackend) newMetric(f *prometheusFamily) prometheus.Metric {
+	switch f.typ {
+	case TimingHistogram:
+		buckets := p.config.Timings[f.timing].Buckets
+		if len(buckets) == 0 {
+			buckets = p.config.Buckets
 		}
-		metric.Set(m.Value)
-	} else {
-		p.registeredMetrics[metricName] = prometheus.NewGaugeVec(
-			prometheus.GaugeOpts{
-				Name: metricName,
-				Help: "Crabby timing metric, in milliseconds",
-			},
-			labelNames,
-		)
-		p.registry.MustRegister(p.registeredMetrics[metricName])
+		if len(buckets) == 0 {
+			buckets = DefaultPrometheusBuckets
+		}
+		opts := prometheus.HistogramOpts{
+			Name:    f.name,
+			Help:    f.help,
+			Buckets: buckets,
+		}
+		if p.config.NativeHistograms {
+			opts.NativeHistogramBucketFactor = 1.1
+		}
+		return prometheus.NewHistogram(opts)
+	case TimingSummary:
+		objectives := p.config.SummaryObjectives
+		if len(objectives) == 0 {
+			objectives = defaultSummaryObjectives
+		}
+		return prometheus.NewSummary(prometheus.SummaryOpts{
+			Name:       f.name,
+			Help:       f.help,
+			Objectives: objectives,
+		})
+	}
+	return prometheus.NewGauge(prometheus.GaugeOpts{Name: f.name, Help: f.help})
+}
+
+// Describe sends no descriptors, which makes the backend an unchecked
+// collector: its families' label names change as series come and go.
+func (p *PrometheusBackend) Describe(chan<- *prometheus.Desc) {}
+
+// Collect drops expired series and sends the rest, labelled with their
+// family's label names.
+func (p *PrometheusBackend) Collect(ch chan<- prometheus.Metric) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := p.now()
+	for name, f := range p.families {
+		expired := false
+		for key, s := range f.series {
+			if p.seriesTTL > 0 && now.Sub(s.updated) > p.seriesTTL {
+				delete(f.series, key)
+				expired = true
+			}
+		}
+		if len(f.series) == 0 {
+			delete(p.families, name)
+			continue
+		}
+		if expired {
+			f.updateLabelNames()
+		}
+		for _, s := range f.series {
+			ch <- &labeledMetric{desc: f.desc, metric: s.metric, labels: f.labelPairs(s)}
+		}
+	}
+}
+
+// updateLabelNames recomputes f's label names from its series.
+func (f *prometheusFamily) updateLabelNames() {
+	var names []string
+	for _, s := range f.series {
+		for k := range s.labels {
+			if !slices.Contains(names, k) {
+				names = append(names, k)
+			}
+		}
+	}
+	slices.Sort(names)
+	if f.desc == nil || !slices.Equal(names, f.labelNames) {
+		f.labelNames = names
+		f.desc = prometheus.NewDesc(f.name, f.help, names, nil)
+	}
+}
+
+// labelPairs returns s's value for each of f's label names, in order.
+func (f *prometheusFamily) labelPairs(s *prometheusSeries) []*dto.LabelPair {
+	pairs := make([]*dto.LabelPair, len(f.labelNames))
+	for i, name := range f.labelNames {
+		pairs[i] = &dto.LabelPair{Name: proto.String(name), Value: proto.String(s.labels[name])}
+	}
+	return pairs
+}
+
+// seriesKey identifies a label set.
+func seriesKey(labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	var b strings.Builder
+	for _, k := range keys {
+		b.WriteString(k)
+		b.WriteByte(0xff)
+		b.WriteString(labels[k])
+		b.WriteByte(0xff)
 	}
+	return b.String()
+}
+
+// labeledMetric exposes an unlabelled metric under a family's descriptor and
+// label values.
+type labeledMetric struct {
+	desc   *prometheus.Desc
+	metric prometheus.Metric
+	labels []*dto.LabelPair
+}
 
+func (m *labeledMetric) Desc() *prometheus.Desc { return m.desc }
+
+func (m *labeledMetric) Write(out *dto.Metric) error {
+	if err := m.metric.Write(out); err != nil {
+		return err
+	}
+	out.Label = m.labels
 	return nil
 }
 
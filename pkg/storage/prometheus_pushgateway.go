@@ -0,0 +1,213 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/chrissnell/crabby/pkg/config"
+	"github.com/chrissnell/crabby/pkg/job"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/push"
+	"github.com/prometheus/common/expfmt"
+	"github.com/prometheus/common/model"
+)
+
+const defaultPushgatewayBatchSize = 500
+
+// PushgatewayBackend pushes metrics to a Prometheus Pushgateway as gauges.
+// Each crabby job gets its own group, keyed by a crabby_job label plus the
+// configured grouping labels, so jobs don't overwrite each other's metrics.
+type PushgatewayBackend struct {
+	config    config.PushgatewayConfig
+	namespace string
+	doer      pushgatewayDoer
+}
+
+// NewPushgatewayBackend creates a new Pushgateway backend.
+func NewPushgatewayBackend(cfg config.PushgatewayConfig, requestTimeout time.Duration) (*PushgatewayBackend, error) {
+	if cfg.URL == "" {
+		return nil, errors.New("missing pushgateway url")
+	}
+	if cfg.Job == "" {
+		cfg.Job = "crabby"
+	}
+	for name := range cfg.Grouping {
+		if !model.LabelName(name).IsValid() {
+			return nil, fmt.Errorf("invalid grouping label name %q", name)
+		}
+		if name == "job" || name == "crabby_job" {
+			return nil, fmt.Errorf("grouping label %q is set by crabby", name)
+		}
+	}
+	if cfg.BatchSize < 0 {
+		return nil, errors.New("batch-size must not be negative")
+	}
+	if cfg.BatchSize == 0 {
+		cfg.BatchSize = defaultPushgatewayBatchSize
+	}
+	client, err := newHTTPClient(cfg.CaCert, cfg.SkipCertificateValidation, requestTimeout)
+	if err != nil {
+		return nil, err
+	}
+	return &PushgatewayBackend{
+		config:    cfg,
+		namespace: strings.ReplaceAll(cfg.Namespace, "-", "_"),
+		doer:      pushgatewayDoer{client: client, auth: cfg.HTTPAuthConfig},
+	}, nil
+}
+
+func (p *PushgatewayBackend) Name() string                  { return "prometheus_pushgateway" }
+func (p *PushgatewayBackend) Start(_ context.Context) error { return nil }
+func (p *PushgatewayBackend) Close() error                  { return nil }
+
+// BatchSize returns the maximum number of metrics pushed at once.
+func (p *PushgatewayBackend) BatchSize() int { return p.config.BatchSize }
+
+// SendMetric pushes a single metric.
+func (p *PushgatewayBackend) SendMetric(ctx context.Context, m job.Metric) error {
+	return p.SendBatch(ctx, []job.Metric{m}, nil)
+}
+
+// SendBatch pushes metrics, one request per crabby job. Pushes use POST, so
+// only the metrics being pushed are replaced within a job's group. Events
+// are ignored.
+func (p *PushgatewayBackend) SendBatch(ctx context.Context, metrics []job.Metric, _ []job.Event) error {
+	var jobs []string
+	byJob := make(map[string][]job.Metric)
+	for _, m := range metrics {
+		if _, ok := byJob[m.Job]; !ok {
+			jobs = append(jobs, m.Job)
+		}
+		byJob[m.Job] = append(byJob[m.Job], m)
+	}
+	for _, name := range jobs {
+		if err := p.push(ctx, name, byJob[name]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// push sends one job's metrics to its group.
+func (p *PushgatewayBackend) push(ctx context.Context, name string, metrics []job.Metric) error {
+	reg := prometheus.NewRegistry()
+	if err := reg.Register(p.collector(metrics)); err != nil {
+		return err
+	}
+	pusher := push.New(p.config.URL, p.config.Job).
+		Grouping("crabby_job", name).
+		Gatherer(reg).
+		Client(p.doer).
+		Format(expfmt.NewFormat(expfmt.TypeTextPlain))
+	for k, v := range p.config.Grouping {
+		pusher = pusher.Grouping(k, v)
+	}
+	if err := pusher.AddContext(ctx); err != nil {
+		return fmt.Errorf("pushing %s to pushgateway: %w", name, err)
+	}
+	return nil
+}
+
+// reservedLabel reports whether name is already part of the grouping key
+// and so can't be used as a metric label.
+func (p *PushgatewayBackend) reservedLabel(name string) bool {
+	if name == "job" || name == "crabby_job" {
+		return true
+	}
+	_, ok := p.config.Grouping[name]
+	return ok
+}
+
+// collector returns gauges for metrics, keeping the latest sample of each
+// series. Series of the same name share a label set: the union of their
+// labels, with missing ones left empty.
+func (p *PushgatewayBackend) collector(metrics []job.Metric) pushgatewayCollector {
+	type series struct {
+		labels map[string]string
+		metric job.Metric
+	}
+	var names []string
+	timings := make(map[string]string)
+	families := make(map[string]map[string]*series)
+	labelNames := make(map[string]map[string]bool)
+	for _, m := range metrics {
+		name := prometheusMetricName(p.namespace, m.Timing)
+		labels := make(map[string]string)
+		if m.URL != "" {
+			labels["url"] = m.URL
+		}
+		for k, v := range m.Tags {
+			if k = prometheusLabelName(k); v != "" && !p.reservedLabel(k) {
+				labels[k] = v
+			}
+		}
+		if _, ok := families[name]; !ok {
+			names = append(names, name)
+			timings[name] = m.Timing
+			families[name] = make(map[string]*series)
+			labelNames[name] = make(map[string]bool)
+		}
+		for k := range labels {
+			labelNames[name][k] = true
+		}
+		key := seriesKey(labels)
+		if s, ok := families[name][key]; !ok || !m.Timestamp.Before(s.metric.Timestamp) {
+			families[name][key] = &series{labels: labels, metric: m}
+		}
+	}
+
+	var c pushgatewayCollector
+	for _, name := range names {
+		var keys []string
+		for k := range labelNames[name] {
+			keys = append(keys, k)
+		}
+		slices.Sort(keys)
+		desc := prometheus.NewDesc(name, "Crabby metric "+timings[name], keys, nil)
+		for _, s := range families[name] {
+			values := make([]string, len(keys))
+			for i, k := range keys {
+				values[i] = s.labels[k]
+			}
+			c = append(c, prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, s.metric.Value, values...))
+		}
+	}
+	return c
+}
+
+// pushgatewayCollector is an unchecked collector of ready-made metrics.
+type pushgatewayCollector []prometheus.Metric
+
+func (c pushgatewayCollector) Describe(chan<- *prometheus.Desc) {}
+
+func (c pushgatewayCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, m := range c {
+		ch <- m
+	}
+}
+
+// pushgatewayDoer adds the configured headers and credentials to each push
+// and turns error responses into a *StatusError so they're retried like
+// those of other backends.
+type pushgatewayDoer struct {
+	client *http.Client
+	auth   config.HTTPAuthConfig
+}
+
+func (d pushgatewayDoer) Do(req *http.Request) (*http.Response, error) {
+	setHTTPAuth(req, d.auth)
+	res, err := d.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkResponse("pushgateway", res); err != nil {
+		res.Body.Close()
+		return nil, err
+	}
+	return res, nil
+}
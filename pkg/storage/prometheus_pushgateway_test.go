@@ -0,0 +1,147 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/chrissnell/crabby/pkg/config"
+	"github.com/chrissnell/crabby/pkg/job"
+)
+
+func TestPushgatewayBackend_SendBatch(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		pushes = make(map[string]string)
+		auth   []string
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		pushes[r.URL.Path] = string(body)
+		user, pass, _ := r.BasicAuth()
+		auth = append(auth, user+":"+pass)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	b, err := NewPushgatewayBackend(config.PushgatewayConfig{
+		URL:            srv.URL,
+		Grouping:       map[string]string{"instance": "edge-1"},
+		HTTPAuthConfig: config.HTTPAuthConfig{Username: "crabby", Password: "secret"},
+	}, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ts := time.Unix(1700000000, 0)
+	err = b.SendBatch(context.Background(), []job.Metric{
+		{Job: "web", URL: "https://example.com", Timing: "dns_duration_milliseconds", Value: 12.5, Timestamp: ts, Tags: map[string]string{"env": "prod", "instance": "ignored"}},
+		{Job: "web", URL: "https://example.com", Timing: "dns_duration_milliseconds", Value: 10, Timestamp: ts.Add(time.Second), Tags: map[string]string{"env": "prod"}},
+		{Job: "web", Timing: "dns_duration_milliseconds", Value: 3, Timestamp: ts},
+		{Job: "api/v2", Timing: "probe_success", Value: 1, Timestamp: ts},
+	}, nil)
+	if err != nil {
+		t.Fatalf("SendBatch() error = %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	groups := make(map[string]string, len(pushes))
+	keys := make([]string, 0, len(pushes))
+	for path, body := range pushes {
+		key := groupingKey(path)
+		groups[key] = body
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	const (
+		// Values with slashes are base64-encoded.
+		apiKey = "crabby_job@base64=YXBpL3Yy,instance=edge-1,job=crabby"
+		webKey = "crabby_job=web,instance=edge-1,job=crabby"
+	)
+	if want := []string{webKey, apiKey}; !slices.Equal(keys, want) {
+		t.Fatalf("grouping keys = %v, want %v", keys, want)
+	}
+
+	web := groups[webKey]
+	for _, want := range []string{
+		`crabby_dns_duration_milliseconds{env="prod",url="https://example.com"} 10`,
+		`crabby_dns_duration_milliseconds{env="",url=""} 3`,
+	} {
+		if !strings.Contains(web, want) {
+			t.Errorf("web push missing %s:\n%s", want, web)
+		}
+	}
+	if strings.Contains(web, "12.5") || strings.Contains(web, "ignored") {
+		t.Errorf("web push has a stale sample or a grouping label:\n%s", web)
+	}
+	if !strings.Contains(groups[apiKey], "crabby_probe_success 1") {
+		t.Errorf("api push = %s", groups[apiKey])
+	}
+	for _, a := range auth {
+		if a != "crabby:secret" {
+			t.Errorf("basic auth = %q, want crabby:secret", a)
+		}
+	}
+}
+
+// groupingKey returns the grouping labels of a push URL path as sorted
+// name=value pairs. The Pushgateway client doesn't order them.
+func groupingKey(path string) string {
+	parts := strings.Split(strings.TrimPrefix(path, "/metrics/"), "/")
+	var pairs []string
+	for i := 0; i+1 < len(parts); i += 2 {
+		pairs = append(pairs, parts[i]+"="+parts[i+1])
+	}
+	slices.Sort(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func TestPushgatewayBackend_error(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer srv.Close()
+
+	b, err := NewPushgatewayBackend(config.PushgatewayConfig{URL: srv.URL}, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = b.SendMetric(context.Background(), job.Metric{Job: "web", Timing: "probe_success", Value: 1, Timestamp: time.Now()})
+	if got := classifySendError(err); got != Retry429 {
+		t.Errorf("classifySendError(%v) = %q, want %q", err, got, Retry429)
+	}
+}
+
+func TestNewPushgatewayBackend_invalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     config.PushgatewayConfig
+		wantErr string
+	}{
+		{name: "no url", wantErr: "missing pushgateway url"},
+		{name: "invalid grouping label", cfg: config.PushgatewayConfig{URL: "http://x", Grouping: map[string]string{"": "a"}}, wantErr: "invalid grouping label name"},
+		{name: "reserved grouping label", cfg: config.PushgatewayConfig{URL: "http://x", Grouping: map[string]string{"job": "a"}}, wantErr: "is set by crabby"},
+		{name: "negative batch size", cfg: config.PushgatewayConfig{URL: "http://x", BatchSize: -1}, wantErr: "batch-size"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewPushgatewayBackend(tt.cfg, 0)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error = %v, want containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,168 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"math"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/chrissnell/crabby/pkg/config"
+	"github.com/chrissnell/crabby/pkg/job"
+	"github.com/golang/snappy"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+const defaultRemoteWriteBatchSize = 500
+
+// PrometheusRemoteWriteBackend pushes metrics to any Prometheus
+// remote-write endpoint as snappy-compressed protobuf. Each metric becomes a
+// sample of the series the Prometheus backend would expose, with the job,
+// URL and tags as labels.
+type PrometheusRemoteWriteBackend struct {
+	config    config.PrometheusRemoteWriteConfig
+	namespace string
+	client    *http.Client
+}
+
+// NewPrometheusRemoteWriteBackend creates a new remote-write backend.
+func NewPrometheusRemoteWriteBackend(cfg config.PrometheusRemoteWriteConfig, requestTimeout time.Duration) (*PrometheusRemoteWriteBackend, error) {
+	if cfg.URL == "" {
+		return nil, errors.New("missing remote-write url")
+	}
+	if cfg.BatchSize < 0 {
+		return nil, errors.New("batch-size must not be negative")
+	}
+	if cfg.BatchSize == 0 {
+		cfg.BatchSize = defaultRemoteWriteBatchSize
+	}
+	client, err := newHTTPClient(cfg.CaCert, cfg.SkipCertificateValidation, requestTimeout)
+	if err != nil {
+		return nil, err
+	}
+	return &PrometheusRemoteWriteBackend{
+		config:    cfg,
+		namespace: strings.ReplaceAll(cfg.Namespace, "-", "_"),
+		client:    client,
+	}, nil
+}
+
+func (r *PrometheusRemoteWriteBackend) Name() string                  { return "prometheus_remote_write" }
+func (r *PrometheusRemoteWriteBackend) Start(_ context.Context) error { return nil }
+func (r *PrometheusRemoteWriteBackend) Close() error                  { return nil }
+
+// BatchSize returns the maximum number of samples per write request.
+func (r *PrometheusRemoteWriteBackend) BatchSize() int { return r.config.BatchSize }
+
+// SendMetric writes a single sample.
+func (r *PrometheusRemoteWriteBackend) SendMetric(ctx context.Context, m job.Metric) error {
+	return r.SendBatch(ctx, []job.Metric{m}, nil)
+}
+
+// SendBatch writes metrics in one remote-write request. Events are ignored.
+func (r *PrometheusRemoteWriteBackend) SendBatch(ctx context.Context, metrics []job.Metric, _ []job.Event) error {
+	if len(metrics) == 0 {
+		return nil
+	}
+	body := snappy.Encode(nil, r.writeRequest(metrics))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.config.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("User-Agent", "crabby")
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	setHTTPAuth(req, r.config.HTTPAuthConfig)
+
+	res, err := r.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("remote-write request failed: %w", err)
+	}
+	defer res.Body.Close()
+	return checkResponse("remote-write endpoint", res)
+}
+
+// promLabel is a Prometheus label pair.
+type promLabel struct {
+	name, value string
+}
+
+// remoteWriteSeries is one series of a WriteRequest.
+type remoteWriteSeries struct {
+	labels  []promLabel
+	samples []job.Metric
+}
+
+// writeRequest encodes metrics as a remote-write WriteRequest protobuf.
+// Samples of the same series are sent together, in timestamp order.
+func (r *PrometheusRemoteWriteBackend) writeRequest(metrics []job.Metric) []byte {
+	var order []string
+	series := make(map[string]*remoteWriteSeries)
+	for _, m := range metrics {
+		labels := r.labels(m)
+		var key strings.Builder
+		for _, l := range labels {
+			key.WriteString(l.name + "\xff" + l.value + "\xff")
+		}
+		s, ok := series[key.String()]
+		if !ok {
+			s = &remoteWriteSeries{labels: labels}
+			series[key.String()] = s
+			order = append(order, key.String())
+		}
+		s.samples = append(s.samples, m)
+	}
+
+	var req []byte
+	for _, key := range order {
+		s := series[key]
+		slices.SortStableFunc(s.samples, func(a, b job.Metric) int { return a.Timestamp.Compare(b.Timestamp) })
+
+		var ts []byte
+		for _, l := range s.labels {
+			var lb []byte
+			lb = protowire.AppendTag(lb, 1, protowire.BytesType)
+			lb = protowire.AppendString(lb, l.name)
+			lb = protowire.AppendTag(lb, 2, protowire.BytesType)
+			lb = protowire.AppendString(lb, l.value)
+			ts = protowire.AppendTag(ts, 1, protowire.BytesType)
+			ts = protowire.AppendBytes(ts, lb)
+		}
+		for _, m := range s.samples {
+			var sb []byte
+			sb = protowire.AppendTag(sb, 1, protowire.Fixed64Type)
+			sb = protowire.AppendFixed64(sb, math.Float64bits(m.Value))
+			sb = protowire.AppendTag(sb, 2, protowire.VarintType)
+			sb = protowire.AppendVarint(sb, uint64(m.Timestamp.UnixMilli()))
+			ts = protowire.AppendTag(ts, 2, protowire.BytesType)
+			ts = protowire.AppendBytes(ts, sb)
+		}
+		req = protowire.AppendTag(req, 1, protowire.BytesType)
+		req = protowire.AppendBytes(req, ts)
+	}
+	return req
+}
+
+// labels returns m's series labels sorted by name, as remote write
+// requires. Each name appears once: __name__, crabby_job and url take
+// precedence over tags with the same name.
+func (r *PrometheusRemoteWriteBackend) labels(m job.Metric) []promLabel {
+	set := prometheusLabels(m.Tags)
+	set["__name__"] = prometheusMetricName(r.namespace, m.Timing)
+	set["crabby_job"] = m.Job
+	delete(set, "url")
+	if m.URL != "" {
+		set["url"] = m.URL
+	}
+	labels := make([]promLabel, 0, len(set))
+	for _, name := range slices.Sorted(maps.Keys(set)) {
+		labels = append(labels, promLabel{name, set[name]})
+	}
+	return labels
+}
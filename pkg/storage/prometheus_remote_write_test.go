@@ -0,0 +1,210 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chrissnell/crabby/pkg/config"
+	"github.com/chrissnell/crabby/pkg/job"
+	"github.com/golang/snappy"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// walkFields calls fn with each field of the protobuf message b. fn returns
+// the length of the field's value.
+func walkFields(t *testing.T, b []byte, fn func(num protowire.Number, b []byte) int) {
+	t.Helper()
+	for len(b) > 0 {
+		num, _, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			t.Fatalf("bad tag: %v", protowire.ParseError(n))
+		}
+		b = b[n:]
+		if n = fn(num, b); n < 0 {
+			t.Fatalf("bad field %d: %v", num, protowire.ParseError(n))
+		}
+		b = b[n:]
+	}
+}
+
+// decodeWriteRequest decodes a WriteRequest into one string per series,
+// "name=value,... value@ms value@ms".
+func decodeWriteRequest(t *testing.T, b []byte) []string {
+	t.Helper()
+	var series []string
+	walkFields(t, b, func(_ protowire.Number, b []byte) int {
+		ts, n := protowire.ConsumeBytes(b)
+		var labels, samples []string
+		walkFields(t, ts, func(num protowire.Number, b []byte) int {
+			msg, n := protowire.ConsumeBytes(b)
+			var parts []string
+			walkFields(t, msg, func(field protowire.Number, b []byte) int {
+				switch {
+				case num == 1:
+					s, n := protowire.ConsumeString(b)
+					parts = append(parts, s)
+					return n
+				case field == 1:
+					bits, n := protowire.ConsumeFixed64(b)
+					parts = append(parts, strconv.FormatFloat(math.Float64frombits(bits), 'f', -1, 64))
+					return n
+				default:
+					ms, n := protowire.ConsumeVarint(b)
+					parts = append(parts, strconv.FormatUint(ms, 10))
+					return n
+				}
+			})
+			if num == 1 {
+				labels = append(labels, strings.Join(parts, "="))
+			} else {
+				samples = append(samples, strings.Join(parts, "@"))
+			}
+			return n
+		})
+		series = append(series, strings.Join(labels, ",")+" "+strings.Join(samples, " "))
+		return n
+	})
+	return series
+}
+
+func TestPrometheusRemoteWriteBackend_SendBatch(t *testing.T) {
+	var (
+		got     []string
+		headers http.Header
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers = r.Header
+		body, _ := io.ReadAll(r.Body)
+		req, err := snappy.Decode(nil, body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		got = decodeWriteRequest(t, req)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	b, err := NewPrometheusRemoteWriteBackend(config.PrometheusRemoteWriteConfig{
+		URL:       srv.URL,
+		Namespace: "edge-probes",
+		HTTPAuthConfig: config.HTTPAuthConfig{
+			Headers:     map[string]string{"X-Scope-OrgID": "team-a"},
+			BearerToken: "token",
+		},
+	}, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.BatchSize() != defaultRemoteWriteBatchSize {
+		t.Errorf("BatchSize() = %d, want %d", b.BatchSize(), defaultRemoteWriteBatchSize)
+	}
+
+	ts := time.UnixMilli(1700000000000)
+	err = b.SendBatch(context.Background(), []job.Metric{
+		{Job: "web", URL: "https://example.com", Timing: "dns_duration_milliseconds", Value: 12.5, Timestamp: ts.Add(time.Second), Tags: map[string]string{"env-name": "prod"}},
+		{Job: "api", Timing: "probe_success", Value: 0, Timestamp: ts},
+		{Job: "web", URL: "https://example.com", Timing: "dns_duration_milliseconds", Value: 10, Timestamp: ts, Tags: map[string]string{"env-name": "prod"}},
+	}, nil)
+	if err != nil {
+		t.Fatalf("SendBatch() error = %v", err)
+	}
+
+	want := []string{
+		"__name__=edge_probes_dns_duration_milliseconds,crabby_job=web,env_name=prod,url=https://example.com 10@1700000000000 12.5@1700000001000",
+		"__name__=edge_probes_probe_success,crabby_job=api 0@1700000000000",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("series =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	for k, want := range map[string]string{
+		"Content-Encoding":                  "snappy",
+		"Content-Type":                      "application/x-protobuf",
+		"X-Prometheus-Remote-Write-Version": "0.1.0",
+		"X-Scope-Orgid":                     "team-a",
+		"Authorization":                     "Bearer token",
+	} {
+		if got := headers.Get(k); got != want {
+			t.Errorf("header %s = %q, want %q", k, got, want)
+		}
+	}
+}
+
+func TestPrometheusRemoteWriteBackend_labels(t *testing.T) {
+	b, err := NewPrometheusRemoteWriteBackend(config.PrometheusRemoteWriteConfig{URL: "http://x"}, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		m    job.Metric
+		want []promLabel
+	}{
+		{
+			name: "reserved tags are overridden",
+			m:    job.Metric{Job: "web", URL: "https://example.com", Timing: "probe_success", Tags: map[string]string{"url": "u", "crabby-job": "j", "__name__": "n"}},
+			want: []promLabel{{"__name__", "crabby_probe_success"}, {"crabby_job", "web"}, {"url", "https://example.com"}},
+		},
+		{
+			name: "url tag without a URL",
+			m:    job.Metric{Job: "web", Timing: "probe_success", Tags: map[string]string{"url": "u"}},
+			want: []promLabel{{"__name__", "crabby_probe_success"}, {"crabby_job", "web"}},
+		},
+		{
+			name: "tags sanitizing to one name",
+			m:    job.Metric{Job: "web", Timing: "probe_success", Tags: map[string]string{"k8s.pod": "a", "k8s-pod": "b"}},
+			want: []promLabel{{"__name__", "crabby_probe_success"}, {"crabby_job", "web"}, {"k8s_pod", "b"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := b.labels(tt.m); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("labels() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPrometheusRemoteWriteBackend_error(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	b, err := NewPrometheusRemoteWriteBackend(config.PrometheusRemoteWriteConfig{URL: srv.URL}, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = b.SendMetric(context.Background(), job.Metric{Job: "web", Timing: "probe_success", Value: 1, Timestamp: time.Now()})
+	if got := classifySendError(err); got != Retry5xx {
+		t.Errorf("classifySendError(%v) = %q, want %q", err, got, Retry5xx)
+	}
+}
+
+func TestNewPrometheusRemoteWriteBackend_invalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     config.PrometheusRemoteWriteConfig
+		wantErr string
+	}{
+		{name: "no url", wantErr: "missing remote-write url"},
+		{name: "negative batch size", cfg: config.PrometheusRemoteWriteConfig{URL: "http://x", BatchSize: -1}, wantErr: "batch-size"},
+		{name: "missing CA", cfg: config.PrometheusRemoteWriteConfig{URL: "http://x", HTTPAuthConfig: config.HTTPAuthConfig{CaCert: "/nonexistent/ca.pem"}}, wantErr: "reading ca-cert"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewPrometheusRemoteWriteBackend(tt.cfg, 0)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error = %v, want containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
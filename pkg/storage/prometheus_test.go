@@ -1,10 +1,16 @@
 package storage
 
 import (
+	"context"
+	"maps"
 	"sort"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/chrissnell/crabby/pkg/config"
+	"github.com/chrissnell/crabby/pkg/job"
+	dto "github.com/prometheus/client_model/go"
 )
 
 func TestMakePrometheusLabels(t *testing.T) {
@@ -84,10 +90,13 @@ func TestNewPrometheusBackend_namespace_sanitization(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			b := NewPrometheusBackend(config.PrometheusConfig{
+			b, err := NewPrometheusBackend(config.PrometheusConfig{
 				ListenAddr: ":9090",
 				Namespace:  tt.namespace,
 			})
+			if err != nil {
+				t.Fatal(err)
+			}
 			if b.namespace != tt.want {
 				t.Errorf("namespace = %q, want %q", b.namespace, tt.want)
 			}
@@ -96,8 +105,235 @@ func TestNewPrometheusBackend_namespace_sanitization(t *testing.T) {
 }
 
 func TestNewPrometheusBackend_name(t *testing.T) {
-	b := NewPrometheusBackend(config.PrometheusConfig{ListenAddr: ":9090"})
+	b, err := NewPrometheusBackend(config.PrometheusConfig{ListenAddr: ":9090"})
+	if err != nil {
+		t.Fatal(err)
+	}
 	if b.Name() != "prometheus" {
 		t.Errorf("Name() = %q, want %q", b.Name(), "prometheus")
 	}
 }
+
+// gatherFamilies returns the backend's metric families by name.
+func gatherFamilies(t *testing.T, b *PrometheusBackend) map[string]*dto.MetricFamily {
+	t.Helper()
+	mfs, err := b.registry.Gather()
+	if err != nil {
+		t.Fatalf("Gather() error = %v", err)
+	}
+	byName := make(map[string]*dto.MetricFamily)
+	for _, mf := range mfs {
+		byName[mf.GetName()] = mf
+	}
+	return byName
+}
+
+func TestNewPrometheusBackend_invalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     config.PrometheusConfig
+		wantErr string
+	}{
+		{name: "unknown type", cfg: config.PrometheusConfig{TimingType: "counter"}, wantErr: `timing-type: unknown timing type "counter"`},
+		{
+			name:    "unknown per-timing type",
+			cfg:     config.PrometheusConfig{Timings: map[string]config.PrometheusTimingConfig{"dns_duration_milliseconds": {Type: "bar"}}},
+			wantErr: "timings.dns_duration_milliseconds.type",
+		},
+		{name: "unsorted buckets", cfg: config.PrometheusConfig{Buckets: []float64{10, 5}}, wantErr: "increasing order"},
+		{name: "bad series ttl", cfg: config.PrometheusConfig{SeriesTTL: "soon"}, wantErr: `invalid series-ttl "soon"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewPrometheusBackend(tt.cfg)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error = %v, want containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPrometheusBackend_SendMetric_types(t *testing.T) {
+	b, err := NewPrometheusBackend(config.PrometheusConfig{
+		Buckets: []float64{10, 100},
+		Timings: map[string]config.PrometheusTimingConfig{
+			"time_to_first_byte_milliseconds": {Type: TimingSummary},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	now := time.Unix(1700000000, 0)
+	send := func(timing string, value float64) {
+		t.Helper()
+		err := b.SendMetric(ctx, job.Metric{Job: "web", URL: "https://example.com", Timing: timing, Value: value, Timestamp: now})
+		if err != nil {
+			t.Fatalf("SendMetric(%s) error = %v", timing, err)
+		}
+	}
+	// Every sample counts, including the first.
+	for _, v := range []float64{5, 50, 500} {
+		send("dns_duration_milliseconds", v)
+		send("time_to_first_byte_milliseconds", v)
+	}
+	send("probe_success", 1)
+	send("probe_status_code", 200)
+
+	mfs := gatherFamilies(t, b)
+
+	h := mfs["crabby_dns_duration_milliseconds"]
+	if h.GetType() != dto.MetricType_HISTOGRAM {
+		t.Fatalf("dns_duration type = %v, want histogram", h.GetType())
+	}
+	hist := h.GetMetric()[0].GetHistogram()
+	if hist.GetSampleCount() != 3 || hist.GetSampleSum() != 555 {
+		t.Errorf("histogram count/sum = %d/%v, want 3/555", hist.GetSampleCount(), hist.GetSampleSum())
+	}
+	if got := hist.GetBucket()[0].GetCumulativeCount(); got != 1 {
+		t.Errorf("le=10 bucket = %d, want 1", got)
+	}
+
+	s := mfs["crabby_time_to_first_byte_milliseconds"]
+	if s.GetType() != dto.MetricType_SUMMARY || s.GetMetric()[0].GetSummary().GetSampleCount() != 3 {
+		t.Errorf("time_to_first_byte = %v, want a summary with 3 samples", s)
+	}
+
+	for name, want := range map[string]float64{
+		"crabby_probe_success":              1,
+		"crabby_probe_status_code":          200,
+		"crabby_last_run_timestamp_seconds": 1700000000,
+	} {
+		mf, ok := mfs[name]
+		if !ok {
+			t.Errorf("missing %s", name)
+			continue
+		}
+		if got := mf.GetMetric()[0].GetGauge().GetValue(); mf.GetType() != dto.MetricType_GAUGE || got != want {
+			t.Errorf("%s = %v (%v), want gauge %v", name, got, mf.GetType(), want)
+		}
+	}
+}
+
+func TestPrometheusBackend_SendMetric_gaugeTimings(t *testing.T) {
+	b, err := NewPrometheusBackend(config.PrometheusConfig{TimingType: TimingGauge})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range []float64{5, 7} {
+		if err := b.SendMetric(context.Background(), job.Metric{Job: "web", Timing: "dns_duration_milliseconds", Value: v}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mf := gatherFamilies(t, b)["crabby_dns_duration_milliseconds"]
+	if got := mf.GetMetric()[0].GetGauge().GetValue(); got != 7 {
+		t.Errorf("gauge = %v, want last value 7", got)
+	}
+}
+
+func TestPrometheusBackend_differingLabels(t *testing.T) {
+	b, err := NewPrometheusBackend(config.PrometheusConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	for _, m := range []job.Metric{
+		{Job: "web", URL: "https://a.example.com", Timing: "probe_success", Value: 1, Tags: map[string]string{"env": "prod"}},
+		{Job: "api", URL: "https://b.example.com", Timing: "probe_success", Value: 0, Tags: map[string]string{"team": "payments"}},
+		{Job: "dns", Timing: "probe_success", Value: 1},
+	} {
+		if err := b.SendMetric(ctx, m); err != nil {
+			t.Fatalf("SendMetric(%s) error = %v", m.Job, err)
+		}
+	}
+
+	mf := gatherFamilies(t, b)["crabby_probe_success"]
+	if len(mf.GetMetric()) != 3 {
+		t.Fatalf("got %d series, want 3", len(mf.GetMetric()))
+	}
+	values := make(map[string]float64)
+	for _, m := range mf.GetMetric() {
+		var names []string
+		labels := make(map[string]string)
+		for _, l := range m.GetLabel() {
+			names = append(names, l.GetName())
+			labels[l.GetName()] = l.GetValue()
+		}
+		if got, want := strings.Join(names, ","), "crabby_job,env,team,url"; got != want {
+			t.Errorf("series %v has labels %s, want %s", labels, got, want)
+		}
+		values[labels["crabby_job"]] = m.GetGauge().GetValue()
+		if labels["crabby_job"] == "api" && (labels["env"] != "" || labels["team"] != "payments") {
+			t.Errorf("api series labels = %v", labels)
+		}
+	}
+	if values["web"] != 1 || values["api"] != 0 || values["dns"] != 1 {
+		t.Errorf("values = %v", values)
+	}
+
+	// Tag names are sanitized, as in the push backends.
+	if err := b.SendMetric(ctx, job.Metric{Job: "web", Timing: "probe_success", Tags: map[string]string{"k8s.pod": "x"}}); err != nil {
+		t.Errorf("SendMetric() with tag k8s.pod: %v", err)
+	}
+}
+
+func TestPrometheusLabels(t *testing.T) {
+	got := prometheusLabels(map[string]string{
+		"team":    "payments",
+		"k8s.pod": "web-1",
+		"k8s-pod": "web-2",
+		"9lives":  "cat",
+		"empty":   "",
+		"":        "nameless",
+	})
+	want := map[string]string{"team": "payments", "k8s_pod": "web-2", "_lives": "cat"}
+	if !maps.Equal(got, want) {
+		t.Errorf("prometheusLabels() = %v, want %v", got, want)
+	}
+}
+
+func TestPrometheusBackend_seriesTTL(t *testing.T) {
+	b, err := NewPrometheusBackend(config.PrometheusConfig{SeriesTTL: "10m"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	b.now = func() time.Time { return now }
+
+	ctx := context.Background()
+	send := func(jobName string, tags map[string]string) {
+		t.Helper()
+		if err := b.SendMetric(ctx, job.Metric{Job: jobName, Timing: "dns_duration_milliseconds", Value: 5, Tags: tags}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	send("old", map[string]string{"env": "staging"})
+	now = now.Add(8 * time.Minute)
+	send("new", nil)
+
+	if got := len(gatherFamilies(t, b)["crabby_dns_duration_milliseconds"].GetMetric()); got != 2 {
+		t.Fatalf("got %d series before expiry, want 2", got)
+	}
+
+	// The old job's series expires, and the label only it had goes with it.
+	now = now.Add(5 * time.Minute)
+	mf := gatherFamilies(t, b)["crabby_dns_duration_milliseconds"]
+	if len(mf.GetMetric()) != 1 {
+		t.Fatalf("got %d series after expiry, want 1", len(mf.GetMetric()))
+	}
+	for _, l := range mf.GetMetric()[0].GetLabel() {
+		if l.GetName() == "env" {
+			t.Error("expired series' label is still exposed")
+		}
+		if l.GetName() == "crabby_job" && l.GetValue() != "new" {
+			t.Errorf("remaining series is %s, want new", l.GetValue())
+		}
+	}
+
+	// Once every series has expired, the metric disappears.
+	now = now.Add(time.Hour)
+	if _, ok := gatherFamilies(t, b)["crabby_dns_duration_milliseconds"]; ok {
+		t.Error("metric with only expired series is still exposed")
+	}
+}
@@ -0,0 +1,438 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/chrissnell/crabby/pkg/config"
+	"github.com/chrissnell/crabby/pkg/job"
+)
+
+// Overflow policies for a full backend queue.
+const (
+	// OverflowDrop discards new items while the queue is full, so a slow
+	// backend never delays the jobs.
+	OverflowDrop = "drop"
+	// OverflowBlock makes senders wait for room in the queue.
+	OverflowBlock = "block"
+)
+
+const (
+	defaultQueueSize    = 1000
+	defaultFlushTimeout = 10 * time.Second
+)
+
+// queueOptions is the validated form of a config.QueueConfig.
+type queueOptions struct {
+	size         int
+	workers      int
+	overflow     string
+	flushTimeout time.Duration
+}
+
+// parseQueueConfig validates c and fills in defaults: a 1000-item queue, one
+// worker, the drop policy and a 10s flush timeout.
+func parseQueueConfig(c config.QueueConfig) (queueOptions, error) {
+	o := queueOptions{
+		size:         defaultQueueSize,
+		workers:      1,
+		overflow:     OverflowDrop,
+		flushTimeout: defaultFlushTimeout,
+	}
+	if c.Size < 0 {
+		return o, fmt.Errorf("queue size must not be negative")
+	}
+	if c.Size > 0 {
+		o.size = c.Size
+	}
+	if c.Workers < 0 {
+		return o, fmt.Errorf("queue workers must not be negative")
+	}
+	if c.Workers > 0 {
+		o.workers = c.Workers
+	}
+	switch c.Overflow {
+	case "":
+	case OverflowDrop, OverflowBlock:
+		o.overflow = c.Overflow
+	default:
+		return o, fmt.Errorf("unknown queue overflow policy %q (want %q or %q)", c.Overflow, OverflowDrop, OverflowBlock)
+	}
+	if c.FlushTimeout != "" {
+		d, err := time.ParseDuration(c.FlushTimeout)
+		if err != nil || d < 0 {
+			return o, fmt.Errorf("invalid queue flush timeout %q", c.FlushTimeout)
+		}
+		o.flushTimeout = d
+	}
+	return o, nil
+}
+
+// queueItem is a metric or an event waiting to be sent to a backend.
+type queueItem struct {
+	metric  job.Metric
+	event   job.Event
+	isEvent bool
+}
+
+func (it queueItem) kind() string {
+	if it.isEvent {
+		return "event"
+	}
+	return "metric"
+}
+
+// backendQueue buffers sends to one backend and delivers them from its own
+// worker goroutines, retrying failures according to its retry policy. If a
+// spool is configured, items that still can't be delivered are written to
+// disk and replayed in order once the backend recovers.
+type backendQueue struct {
+	// name identifies the backend instance in logs, spool files and
+	// internal metrics.
+	name       string
+	backend    Backend
+	opts       queueOptions
+	retry      retryPolicy
+	spoolOpts  spoolOptions
+	route      route
+	relabel    relabeler
+	items      chan queueItem
+	spool      *spool
+	replayDone chan struct{}
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	dropped  atomic.Uint64
+	dropping atomic.Bool
+	// Send latency accumulated since the last InternalMetrics call.
+	latencyNanos atomic.Int64
+	sends        atomic.Int64
+}
+
+func newBackendQueue(name string, b Backend, opts queueOptions, retry retryPolicy, spoolOpts spoolOptions, route route) *backendQueue {
+	return &backendQueue{
+		name:      name,
+		backend:   b,
+		opts:      opts,
+		retry:     retry,
+		spoolOpts: spoolOpts,
+		route:     route,
+		items:     make(chan queueItem, opts.size),
+	}
+}
+
+// start opens the queue's spool, if any, and launches its workers. Sends use
+// a context derived from ctx that outlives its cancellation, so queued items
+// can still be flushed on shutdown.
+func (q *backendQueue) start(ctx context.Context) error {
+	if q.spoolOpts.dir != "" {
+		sp, err := openSpool(q.spoolOpts.dir, q.name, q.spoolOpts.maxItems)
+		if err != nil {
+			return err
+		}
+		q.spool = sp
+	}
+
+	q.ctx, q.cancel = context.WithCancel(context.WithoutCancel(ctx))
+	for range q.opts.workers {
+		q.wg.Add(1)
+		go q.work()
+	}
+	if q.spool != nil {
+		q.replayDone = make(chan struct{})
+		go q.replayLoop()
+	}
+	return nil
+}
+
+func (q *backendQueue) work() {
+	defer q.wg.Done()
+	for it := range q.items {
+		batch := q.collect(it)
+		if q.ctx.Err() != nil {
+			// Flush timed out; keep what's left for the next run if we can.
+			for _, it := range batch {
+				q.spoolOrDrop(it)
+			}
+			continue
+		}
+		q.deliver(batch)
+	}
+}
+
+// collect returns it together with the items already queued behind it, up
+// to the backend's batch size. Backends that don't implement BatchSender get
+// one item at a time.
+func (q *backendQueue) collect(it queueItem) []queueItem {
+	batch := []queueItem{it}
+	bs, ok := q.backend.(BatchSender)
+	if !ok {
+		return batch
+	}
+	for len(batch) < bs.BatchSize() {
+		select {
+		case next, ok := <-q.items:
+			if !ok {
+				return batch
+			}
+			batch = append(batch, next)
+		default:
+			return batch
+		}
+	}
+	return batch
+}
+
+// deliver sends the metrics in batch and then its events. They are sent and
+// retried separately, so that a backend that exports them in separate
+// requests never resends metrics because its events failed, or vice versa.
+// Events an EventAdmitter turns away are dropped before the first attempt.
+func (q *backendQueue) deliver(batch []queueItem) {
+	admitter, _ := q.backend.(EventAdmitter)
+	var metrics, events []queueItem
+	for _, it := range batch {
+		switch {
+		case !it.isEvent:
+			metrics = append(metrics, it)
+		case admitter == nil || admitter.AdmitEvent(it.event):
+			events = append(events, it)
+		}
+	}
+	for _, b := range [][]queueItem{metrics, events} {
+		if len(b) > 0 {
+			q.deliverKind(b)
+		}
+	}
+}
+
+// deliverKind sends batch, which holds items of one kind, retrying according
+// to the queue's retry policy. While the spool holds items, new ones join the
+// back of it so that the backend receives everything in order.
+func (q *backendQueue) deliverKind(batch []queueItem) {
+	if q.spool != nil && q.spool.len() > 0 {
+		for _, it := range batch {
+			q.spoolOrDrop(it)
+		}
+		return
+	}
+
+	err := q.retry.do(q.ctx, func() error { return q.send(batch) })
+	if err == nil {
+		return
+	}
+	if q.spool != nil && (q.retry.retryable(err) || q.ctx.Err() != nil) {
+		slog.Warn("backend unavailable, spooling", "backend", q.name, "items", len(batch), "error", err)
+		for _, it := range batch {
+			q.spoolOrDrop(it)
+		}
+		return
+	}
+	slog.Error("sending "+batchKind(batch), "backend", q.name, "items", len(batch), "error", err)
+}
+
+// send makes a single attempt at delivering batch. Batches of more than one
+// item only reach backends that implement BatchSender.
+func (q *backendQueue) send(batch []queueItem) error {
+	start := time.Now()
+	var err error
+	if bs, ok := q.backend.(BatchSender); ok {
+		var metrics []job.Metric
+		var events []job.Event
+		for _, it := range batch {
+			if it.isEvent {
+				events = append(events, it.event)
+			} else {
+				metrics = append(metrics, it.metric)
+			}
+		}
+		err = bs.SendBatch(q.ctx, metrics, events)
+	} else if it := batch[0]; it.isEvent {
+		err = q.backend.(EventSender).SendEvent(q.ctx, it.event)
+	} else {
+		err = q.backend.(MetricSender).SendMetric(q.ctx, it.metric)
+	}
+	q.latencyNanos.Add(int64(time.Since(start)))
+	q.sends.Add(1)
+	return err
+}
+
+// batchKind describes the items in batch for log messages.
+func batchKind(batch []queueItem) string {
+	if len(batch) == 1 {
+		return batch[0].kind()
+	}
+	return "batch"
+}
+
+// spoolOrDrop writes it to the spool, or counts it as dropped if there is no
+// spool or the spool can't take it.
+func (q *backendQueue) spoolOrDrop(it queueItem) {
+	if q.spool != nil {
+		err := q.spool.append(it)
+		if err == nil {
+			return
+		}
+		slog.Error("spooling "+it.kind(), "backend", q.name, "error", err)
+	}
+	q.dropped.Add(1)
+}
+
+// replayLoop replays the spool immediately and then every replay interval
+// until the queue is closed.
+func (q *backendQueue) replayLoop() {
+	defer close(q.replayDone)
+	ticker := time.NewTicker(q.spoolOpts.replayInterval)
+	defer ticker.Stop()
+	for {
+		q.replay()
+		select {
+		case <-ticker.C:
+		case <-q.ctx.Done():
+			return
+		}
+	}
+}
+
+func (q *backendQueue) replay() {
+	if q.spool.len() == 0 {
+		return
+	}
+	n, err := q.spool.replay(func(it queueItem) error {
+		err := q.send([]queueItem{it})
+		if err != nil && !q.retry.retryable(err) && q.ctx.Err() == nil {
+			// This item will never be accepted; don't let it hold up the rest.
+			slog.Error("discarding spooled "+it.kind(), "backend", q.name, "error", err)
+			q.dropped.Add(1)
+			return nil
+		}
+		return err
+	})
+	if n > 0 {
+		slog.Info("replayed spooled items", "backend", q.name, "items", n, "remaining", q.spool.len())
+	}
+	if err != nil && q.ctx.Err() == nil {
+		slog.Warn("backend still unavailable, keeping spooled items", "backend", q.name, "error", err)
+	}
+}
+
+// accepts reports whether the backend takes items of its kind.
+func (q *backendQueue) accepts(it queueItem) bool {
+	if it.isEvent {
+		_, ok := q.backend.(EventSender)
+		return ok
+	}
+	_, ok := q.backend.(MetricSender)
+	return ok
+}
+
+// relabelAndEnqueue applies the queue's relabel rules to a metric and queues
+// it unless they drop it. Events are queued as they are.
+func (q *backendQueue) relabelAndEnqueue(ctx context.Context, it queueItem) {
+	if !it.isEvent {
+		m, ok := q.relabel.apply(it.metric)
+		if !ok {
+			return
+		}
+		it.metric = m
+	}
+	q.enqueue(ctx, it)
+}
+
+// enqueue adds it to the queue, applying the overflow policy if it is full.
+// Under the block policy, a sender whose ctx is cancelled gives up and the
+// item is dropped.
+func (q *backendQueue) enqueue(ctx context.Context, it queueItem) {
+	select {
+	case q.items <- it:
+		q.resumed()
+		return
+	default:
+	}
+	if q.opts.overflow == OverflowBlock {
+		select {
+		case q.items <- it:
+			q.resumed()
+			return
+		case <-ctx.Done():
+		}
+	}
+	q.drop()
+}
+
+func (q *backendQueue) drop() {
+	q.dropped.Add(1)
+	if !q.dropping.Swap(true) {
+		slog.Warn("storage queue full, dropping items", "backend", q.name, "size", q.opts.size)
+	}
+}
+
+func (q *backendQueue) resumed() {
+	if q.dropping.Load() && q.dropping.Swap(false) {
+		slog.Info("storage queue accepting items again", "backend", q.name,
+			"dropped_total", q.dropped.Load())
+	}
+}
+
+// close stops accepting items and waits up to the flush timeout for the
+// workers to deliver what is queued. Items still queued after that are
+// spooled if a spool is configured, and dropped otherwise.
+func (q *backendQueue) close() {
+	close(q.items)
+	if q.cancel == nil {
+		// Never started.
+		return
+	}
+	done := make(chan struct{})
+	go func() {
+		q.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(q.opts.flushTimeout):
+		slog.Warn("storage queue flush timed out", "backend", q.name, "remaining", len(q.items))
+		q.cancel()
+		<-done
+	}
+	q.cancel()
+
+	if q.spool != nil {
+		<-q.replayDone
+		if n := q.spool.len(); n > 0 {
+			slog.Info("items left in spool", "backend", q.name, "items", n)
+		}
+		if err := q.spool.close(); err != nil {
+			slog.Error("closing spool", "backend", q.name, "error", err)
+		}
+	}
+}
+
+// internalMetrics reports the queue's depth, total drops, the mean send
+// latency since the previous call and, with a spool, the number of spooled
+// items.
+func (q *backendQueue) internalMetrics() []job.Metric {
+	tags := map[string]string{"backend": q.name}
+	mk := func(name string, value float64) job.Metric {
+		return job.MakeMetric(name, value, "internal_metrics", "", tags)
+	}
+
+	var latency float64
+	if n := q.sends.Swap(0); n > 0 {
+		latency = time.Duration(q.latencyNanos.Swap(0)/n).Seconds() * 1000
+	}
+	metrics := []job.Metric{
+		mk("storage.queue_depth", float64(len(q.items))),
+		mk("storage.dropped", float64(q.dropped.Load())),
+		mk("storage.send_latency_milliseconds", latency),
+	}
+	if q.spool != nil {
+		metrics = append(metrics, mk("storage.spooled", float64(q.spool.len())))
+	}
+	return metrics
+}
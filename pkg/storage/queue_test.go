@@ -0,0 +1,458 @@
+package storage
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/chrissnell/crabby/pkg/config"
+	"github.com/chrissnell/crabby/pkg/job"
+)
+
+// gatedBackend is a MetricSender whose sends wait until release is closed.
+type gatedBackend struct {
+	mockBackend
+	release chan struct{}
+
+	mu      sync.Mutex
+	metrics []job.Metric
+}
+
+func (g *gatedBackend) SendMetric(ctx context.Context, m job.Metric) error {
+	select {
+	case <-g.release:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.metrics = append(g.metrics, m)
+	return nil
+}
+
+func (g *gatedBackend) sent() int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return len(g.metrics)
+}
+
+func TestParseQueueConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		c       config.QueueConfig
+		want    queueOptions
+		wantErr string
+	}{
+		{
+			name: "defaults",
+			want: queueOptions{size: 1000, workers: 1, overflow: OverflowDrop, flushTimeout: 10 * time.Second},
+		},
+		{
+			name: "custom",
+			c:    config.QueueConfig{Size: 50, Workers: 4, Overflow: "block", FlushTimeout: "2s"},
+			want: queueOptions{size: 50, workers: 4, overflow: OverflowBlock, flushTimeout: 2 * time.Second},
+		},
+		{name: "negative size", c: config.QueueConfig{Size: -1}, wantErr: "size"},
+		{name: "negative workers", c: config.QueueConfig{Workers: -2}, wantErr: "workers"},
+		{name: "unknown policy", c: config.QueueConfig{Overflow: "spill"}, wantErr: `unknown queue overflow policy "spill"`},
+		{name: "bad flush timeout", c: config.QueueConfig{FlushTimeout: "later"}, wantErr: "flush timeout"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseQueueConfig(tt.c)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("parseQueueConfig() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDistributor_SlowBackendDoesNotBlock(t *testing.T) {
+	slow := &gatedBackend{mockBackend: mockBackend{name: "slow"}, release: make(chan struct{})}
+	fast := &mockMetricBackend{mockBackend: mockBackend{name: "fast"}}
+
+	d := NewDistributor()
+	if err := d.AddBackendWithOptions(slow, BackendOptions{DeliveryConfig: config.DeliveryConfig{Queue: config.QueueConfig{Size: 2}}}); err != nil {
+		t.Fatal(err)
+	}
+	d.AddBackend(fast)
+	if err := d.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	metrics := make([]job.Metric, 10)
+	sent := make(chan struct{})
+	go func() {
+		d.SendMetrics(context.Background(), metrics)
+		close(sent)
+	}()
+	select {
+	case <-sent:
+	case <-time.After(2 * time.Second):
+		t.Fatal("SendMetrics blocked on a slow backend")
+	}
+
+	close(slow.release)
+	d.Close()
+
+	if len(fast.metrics) != 10 {
+		t.Errorf("fast backend got %d metrics, want 10", len(fast.metrics))
+	}
+	// One item in flight plus two queued; the rest were dropped.
+	if got := slow.sent(); got > 3 {
+		t.Errorf("slow backend got %d metrics, want at most 3", got)
+	}
+	dropped := metricValue(t, d.InternalMetrics(), "slow", "storage.dropped")
+	if int(dropped)+slow.sent() != 10 {
+		t.Errorf("dropped = %v, sent = %d, want a total of 10", dropped, slow.sent())
+	}
+}
+
+func TestDistributor_BlockPolicy(t *testing.T) {
+	slow := &gatedBackend{mockBackend: mockBackend{name: "slow"}, release: make(chan struct{})}
+
+	d := NewDistributor()
+	if err := d.AddBackendWithOptions(slow, BackendOptions{DeliveryConfig: config.DeliveryConfig{Queue: config.QueueConfig{Size: 1, Overflow: "block"}}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	sent := make(chan struct{})
+	go func() {
+		d.SendMetrics(context.Background(), make([]job.Metric, 5))
+		close(sent)
+	}()
+	select {
+	case <-sent:
+		t.Fatal("SendMetrics returned before the queue had room")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(slow.release)
+	<-sent
+	d.Close()
+	if got := slow.sent(); got != 5 {
+		t.Errorf("slow backend got %d metrics, want 5", got)
+	}
+
+	// A cancelled sender gives up instead of waiting.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	blocked := &gatedBackend{mockBackend: mockBackend{name: "blocked"}, release: make(chan struct{})}
+	d = NewDistributor()
+	if err := d.AddBackendWithOptions(blocked, BackendOptions{DeliveryConfig: config.DeliveryConfig{Queue: config.QueueConfig{Size: 1, Overflow: "block"}}}); err != nil {
+		t.Fatal(err)
+	}
+	d.SendMetrics(ctx, make([]job.Metric, 3))
+	if got := metricValue(t, d.InternalMetrics(), "blocked", "storage.dropped"); got != 2 {
+		t.Errorf("dropped = %v, want 2", got)
+	}
+}
+
+func TestDistributor_CloseFlushTimeout(t *testing.T) {
+	stuck := &gatedBackend{mockBackend: mockBackend{name: "stuck"}, release: make(chan struct{})}
+
+	d := NewDistributor()
+	if err := d.AddBackendWithOptions(stuck, BackendOptions{DeliveryConfig: config.DeliveryConfig{Queue: config.QueueConfig{FlushTimeout: "50ms"}}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	d.SendMetrics(context.Background(), make([]job.Metric, 3))
+
+	closed := make(chan struct{})
+	go func() {
+		d.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Close did not return after the flush timeout")
+	}
+	if !stuck.closed {
+		t.Error("backend was not closed")
+	}
+	if got := metricValue(t, d.InternalMetrics(), "stuck", "storage.dropped"); got != 2 {
+		t.Errorf("dropped = %v, want 2", got)
+	}
+
+	// Sends after Close are ignored.
+	d.SendMetrics(context.Background(), make([]job.Metric, 1))
+}
+
+func TestDistributor_InternalMetrics(t *testing.T) {
+	d := NewDistributor()
+	d.AddBackend(&mockMetricBackend{mockBackend: mockBackend{name: "m"}})
+	d.AddBackend(&mockBackend{name: "plain"})
+	d.SendMetrics(context.Background(), make([]job.Metric, 3))
+
+	metrics := d.InternalMetrics()
+	if len(metrics) != 3 {
+		t.Fatalf("got %d metrics, want 3 for the one sending backend: %+v", len(metrics), metrics)
+	}
+	for _, m := range metrics {
+		if m.Job != "internal_metrics" || m.Tags["backend"] != "m" {
+			t.Errorf("metric %+v: want job internal_metrics and backend tag m", m)
+		}
+	}
+	if got := metricValue(t, metrics, "m", "storage.queue_depth"); got != 3 {
+		t.Errorf("queue_depth = %v, want 3", got)
+	}
+}
+
+func metricValue(t *testing.T, metrics []job.Metric, backend, timing string) float64 {
+	t.Helper()
+	for _, m := range metrics {
+		if m.Tags["backend"] == backend && m.Timing == timing {
+			return m.Value
+		}
+	}
+	t.Fatalf("no %s metric for backend %s in %+v", timing, backend, metrics)
+	return 0
+}
+
+// flakyBackend is a MetricSender that fails with a 503 if down is set.
+type flakyBackend struct {
+	mockBackend
+	mu      sync.Mutex
+	down    bool
+	calls   int
+	metrics []job.Metric
+}
+
+func (f *flakyBackend) SendMetric(_ context.Context, m job.Metric) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls++
+	if f.down {
+		return &StatusError{StatusCode: 503}
+	}
+	f.metrics = append(f.metrics, m)
+	return nil
+}
+
+func (f *flakyBackend) received() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var jobs []string
+	for _, m := range f.metrics {
+		jobs = append(jobs, m.Job)
+	}
+	return jobs
+}
+
+func TestDistributor_RetryThenSpoolAcrossRestart(t *testing.T) {
+	dir := t.TempDir()
+	opts := BackendOptions{DeliveryConfig: config.DeliveryConfig{
+		Retry: config.RetryConfig{Attempts: 2, InitialBackoff: "1ms"},
+		Spool: config.SpoolConfig{Dir: dir, ReplayInterval: "10ms"},
+	}}
+	metrics := func(jobs ...string) []job.Metric {
+		var ms []job.Metric
+		for _, j := range jobs {
+			ms = append(ms, job.Metric{Job: j})
+		}
+		return ms
+	}
+
+	// The backend is down for the whole first run: everything is retried,
+	// then spooled, and the spool survives Close.
+	b := &flakyBackend{mockBackend: mockBackend{name: "influxdb"}, down: true}
+	d := NewDistributor()
+	if err := d.AddBackendWithOptions(b, opts); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	d.SendMetrics(context.Background(), metrics("a", "b"))
+	d.SendMetrics(context.Background(), metrics("c"))
+	d.Close()
+	if b.calls < 2 {
+		t.Errorf("backend called %d times, want the first item retried", b.calls)
+	}
+	if got := b.received(); len(got) != 0 {
+		t.Fatalf("backend received %v while down", got)
+	}
+
+	// After a restart the backend is back: spooled items are replayed first,
+	// in order, followed by new ones.
+	b = &flakyBackend{mockBackend: mockBackend{name: "influxdb"}}
+	d = NewDistributor()
+	if err := d.AddBackendWithOptions(b, opts); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for len(b.received()) < 3 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	d.SendMetrics(context.Background(), metrics("d"))
+	d.Close()
+
+	if got, want := strings.Join(b.received(), ","), "a,b,c,d"; got != want {
+		t.Errorf("backend received %s, want %s", got, want)
+	}
+}
+
+func TestDistributor_NonRetryableErrorNotSpooled(t *testing.T) {
+	b := &errBackend{mockBackend: mockBackend{name: "splunk_hec"}, err: &StatusError{StatusCode: 400}}
+	d := NewDistributor()
+	if err := d.AddBackendWithOptions(b, BackendOptions{DeliveryConfig: config.DeliveryConfig{Spool: config.SpoolConfig{Dir: t.TempDir()}}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	d.SendMetrics(context.Background(), make([]job.Metric, 2))
+	if got := metricValue(t, d.InternalMetrics(), "splunk_hec", "storage.spooled"); got != 0 {
+		t.Errorf("spooled = %v, want 0", got)
+	}
+	d.Close()
+	if b.calls != 2 {
+		t.Errorf("backend called %d times, want 2 (no retries)", b.calls)
+	}
+}
+
+// errBackend is a MetricSender that always fails with err.
+type errBackend struct {
+	mockBackend
+	err   error
+	calls int
+}
+
+func (e *errBackend) SendMetric(context.Context, job.Metric) error {
+	e.calls++
+	return e.err
+}
+
+// batchBackend is a BatchSender that records the size of each batch.
+type batchBackend struct {
+	mockBackend
+	release chan struct{}
+
+	mu      sync.Mutex
+	batches []int
+	events  int
+}
+
+func (b *batchBackend) BatchSize() int { return 4 }
+
+func (b *batchBackend) SendBatch(_ context.Context, metrics []job.Metric, events []job.Event) error {
+	<-b.release
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.batches = append(b.batches, len(metrics)+len(events))
+	b.events += len(events)
+	return nil
+}
+
+func (b *batchBackend) SendMetric(ctx context.Context, m job.Metric) error {
+	return b.SendBatch(ctx, []job.Metric{m}, nil)
+}
+
+func (b *batchBackend) SendEvent(ctx context.Context, e job.Event) error {
+	return b.SendBatch(ctx, nil, []job.Event{e})
+}
+
+func TestDistributor_Batches(t *testing.T) {
+	b := &batchBackend{mockBackend: mockBackend{name: "otlp"}, release: make(chan struct{})}
+	d := NewDistributor()
+	d.AddBackend(b)
+	if err := d.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// The worker takes the first item and waits; the rest queue up behind it.
+	d.SendMetrics(context.Background(), make([]job.Metric, 7))
+	d.SendEvents(context.Background(), make([]job.Event, 2))
+	close(b.release)
+	d.Close()
+
+	total := 0
+	for _, n := range b.batches {
+		if n > 4 {
+			t.Errorf("batch of %d items, want at most 4", n)
+		}
+		total += n
+	}
+	if total != 9 || b.events != 2 {
+		t.Errorf("sent %d items including %d events, want 9 including 2", total, b.events)
+	}
+	if len(b.batches) >= 9 {
+		t.Errorf("sent %d batches, want queued items batched together", len(b.batches))
+	}
+}
+
+// halfFailingBackend is a BatchSender whose event exports fail the first
+// time, like an OTLP collector that rejects a logs request.
+type halfFailingBackend struct {
+	mockBackend
+	mu      sync.Mutex
+	metrics int
+	failed  bool
+}
+
+func (b *halfFailingBackend) BatchSize() int { return 10 }
+
+func (b *halfFailingBackend) SendBatch(_ context.Context, metrics []job.Metric, events []job.Event) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.metrics += len(metrics)
+	if len(events) > 0 && !b.failed {
+		b.failed = true
+		return &StatusError{StatusCode: 503}
+	}
+	return nil
+}
+
+func (b *halfFailingBackend) SendMetric(ctx context.Context, m job.Metric) error {
+	return b.SendBatch(ctx, []job.Metric{m}, nil)
+}
+
+func (b *halfFailingBackend) SendEvent(ctx context.Context, e job.Event) error {
+	return b.SendBatch(ctx, nil, []job.Event{e})
+}
+
+func TestDistributor_BatchRetrySendsMetricsOnce(t *testing.T) {
+	b := &halfFailingBackend{mockBackend: mockBackend{name: "otlp"}}
+	d := NewDistributor()
+	if err := d.AddBackendWithOptions(b, BackendOptions{DeliveryConfig: config.DeliveryConfig{
+		Retry: config.RetryConfig{Attempts: 3, InitialBackoff: "1ms"},
+	}}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Queue items before starting so they are collected into one batch.
+	d.SendMetrics(context.Background(), make([]job.Metric, 3))
+	d.SendEvents(context.Background(), make([]job.Event, 1))
+	if err := d.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	d.Close()
+
+	if !b.failed {
+		t.Fatal("event export never failed")
+	}
+	if b.metrics != 3 {
+		t.Errorf("exported %d metrics, want 3 (none resent by the event retry)", b.metrics)
+	}
+}
@@ -0,0 +1,207 @@
+package storage
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/chrissnell/crabby/pkg/config"
+	"github.com/chrissnell/crabby/pkg/job"
+)
+
+// Relabel actions. Apart from hash, they behave like Prometheus's.
+const (
+	RelabelReplace   = "replace"
+	RelabelKeep      = "keep"
+	RelabelDrop      = "drop"
+	RelabelHash      = "hash"
+	RelabelHashMod   = "hashmod"
+	RelabelLabelMap  = "labelmap"
+	RelabelLabelDrop = "labeldrop"
+	RelabelLabelKeep = "labelkeep"
+	RelabelLowercase = "lowercase"
+	RelabelUppercase = "uppercase"
+)
+
+// Labels holding a metric's fields while it is relabelled. Any other label
+// starting with __ is dropped afterwards, so it can hold temporary values.
+const (
+	relabelTimingLabel = "__name__"
+	relabelJobLabel    = "__job__"
+	relabelURLLabel    = "__url__"
+)
+
+// relabelStep is the validated form of a config.RelabelConfig.
+type relabelStep struct {
+	action       string
+	sourceLabels []string
+	separator    string
+	regex        *regexp.Regexp
+	target       string
+	replacement  string
+	modulus      uint64
+}
+
+// relabeler is a relabel pipeline. A nil relabeler leaves metrics alone.
+type relabeler []relabelStep
+
+// parseRelabelConfigs validates cs and fills in Prometheus's defaults: the
+// replace action, a ";" separator, the regex (.*) and the replacement $1.
+func parseRelabelConfigs(cs []config.RelabelConfig) (relabeler, error) {
+	var r relabeler
+	for i, c := range cs {
+		s := relabelStep{
+			action:       c.Action,
+			sourceLabels: c.SourceLabels,
+			separator:    ";",
+			target:       c.TargetLabel,
+			replacement:  "$1",
+			modulus:      c.Modulus,
+		}
+		if s.action == "" {
+			s.action = RelabelReplace
+		}
+		if c.Separator != nil {
+			s.separator = *c.Separator
+		}
+		if c.Replacement != nil {
+			s.replacement = *c.Replacement
+		}
+		regex := c.Regex
+		if regex == "" {
+			regex = "(.*)"
+		}
+		re, err := regexp.Compile("^(?:" + regex + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("relabel %d: invalid regex %q: %w", i, c.Regex, err)
+		}
+		s.regex = re
+
+		switch s.action {
+		case RelabelReplace, RelabelHash, RelabelLowercase, RelabelUppercase:
+			if s.target == "" {
+				return nil, fmt.Errorf("relabel %d: %s needs a target-label", i, s.action)
+			}
+		case RelabelHashMod:
+			if s.target == "" {
+				return nil, fmt.Errorf("relabel %d: hashmod needs a target-label", i)
+			}
+			if s.modulus == 0 {
+				return nil, fmt.Errorf("relabel %d: hashmod needs a modulus", i)
+			}
+		case RelabelKeep, RelabelDrop:
+			if len(s.sourceLabels) == 0 {
+				return nil, fmt.Errorf("relabel %d: %s needs source-labels", i, s.action)
+			}
+		case RelabelLabelMap, RelabelLabelDrop, RelabelLabelKeep:
+		default:
+			return nil, fmt.Errorf("relabel %d: unknown action %q", i, s.action)
+		}
+		r = append(r, s)
+	}
+	return r, nil
+}
+
+// apply runs m through the pipeline. It returns false if m was dropped,
+// including when it's left without a timing name or job.
+func (r relabeler) apply(m job.Metric) (job.Metric, bool) {
+	if len(r) == 0 {
+		return m, true
+	}
+	labels := make(map[string]string, len(m.Tags)+3)
+	maps.Copy(labels, m.Tags)
+	labels[relabelTimingLabel] = m.Timing
+	labels[relabelJobLabel] = m.Job
+	labels[relabelURLLabel] = m.URL
+
+	for _, s := range r {
+		if !s.apply(labels) {
+			return m, false
+		}
+	}
+
+	m.Timing = labels[relabelTimingLabel]
+	m.Job = labels[relabelJobLabel]
+	m.URL = labels[relabelURLLabel]
+	if m.Timing == "" || m.Job == "" {
+		return m, false
+	}
+	m.Tags = make(map[string]string, len(labels))
+	for k, v := range labels {
+		if !strings.HasPrefix(k, "__") && v != "" {
+			m.Tags[k] = v
+		}
+	}
+	return m, true
+}
+
+// apply performs one step on labels, returning false to drop the metric.
+// As in Prometheus, setting a label to the empty string removes it.
+func (s relabelStep) apply(labels map[string]string) bool {
+	values := make([]string, len(s.sourceLabels))
+	for i, name := range s.sourceLabels {
+		values[i] = labels[name]
+	}
+	value := strings.Join(values, s.separator)
+
+	set := func(name, v string) {
+		if v == "" {
+			delete(labels, name)
+			return
+		}
+		labels[name] = v
+	}
+
+	switch s.action {
+	case RelabelKeep:
+		return s.regex.MatchString(value)
+	case RelabelDrop:
+		return !s.regex.MatchString(value)
+	case RelabelReplace:
+		match := s.regex.FindStringSubmatchIndex(value)
+		if match == nil {
+			return true
+		}
+		target := string(s.regex.ExpandString(nil, s.target, value, match))
+		set(target, string(s.regex.ExpandString(nil, s.replacement, value, match)))
+	case RelabelHash:
+		if value != "" {
+			sum := sha256.Sum256([]byte(value))
+			set(s.target, hex.EncodeToString(sum[:8]))
+		}
+	case RelabelHashMod:
+		sum := md5.Sum([]byte(value))
+		set(s.target, strconv.FormatUint(binary.BigEndian.Uint64(sum[8:])%s.modulus, 10))
+	case RelabelLowercase:
+		set(s.target, strings.ToLower(value))
+	case RelabelUppercase:
+		set(s.target, strings.ToUpper(value))
+	case RelabelLabelMap:
+		// Sorted so the result doesn't depend on map order when two labels
+		// map to the same name.
+		for _, name := range slices.Sorted(maps.Keys(labels)) {
+			if match := s.regex.FindStringSubmatchIndex(name); match != nil {
+				set(string(s.regex.ExpandString(nil, s.replacement, name, match)), labels[name])
+			}
+		}
+	case RelabelLabelDrop, RelabelLabelKeep:
+		// Only tags are affected; the metric's own fields can't be removed
+		// this way.
+		for name := range labels {
+			if strings.HasPrefix(name, "__") {
+				continue
+			}
+			if s.regex.MatchString(name) == (s.action == RelabelLabelDrop) {
+				delete(labels, name)
+			}
+		}
+	}
+	return true
+}
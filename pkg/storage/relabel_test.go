@@ -0,0 +1,224 @@
+package storage
+
+import (
+	"context"
+	"maps"
+	"strings"
+	"testing"
+
+	"github.com/chrissnell/crabby/pkg/config"
+	"github.com/chrissnell/crabby/pkg/job"
+)
+
+func ptr(s string) *string { return &s }
+
+func TestParseRelabelConfigs_invalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		c       []config.RelabelConfig
+		wantErr string
+	}{
+		{name: "bad regex", c: []config.RelabelConfig{{TargetLabel: "a", Regex: "web("}}, wantErr: `relabel 0: invalid regex "web("`},
+		{name: "unknown action", c: []config.RelabelConfig{{TargetLabel: "a"}, {Action: "rename"}}, wantErr: `relabel 1: unknown action "rename"`},
+		{name: "replace without target", c: []config.RelabelConfig{{SourceLabels: []string{"a"}}}, wantErr: "replace needs a target-label"},
+		{name: "hashmod without modulus", c: []config.RelabelConfig{{Action: "hashmod", TargetLabel: "shard"}}, wantErr: "hashmod needs a modulus"},
+		{name: "keep without source", c: []config.RelabelConfig{{Action: "keep", Regex: "web"}}, wantErr: "keep needs source-labels"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseRelabelConfigs(tt.c)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error = %v, want containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRelabeler_apply(t *testing.T) {
+	in := job.Metric{
+		Job:    "checkout",
+		URL:    "https://shop.example.com/cart",
+		Timing: "dns_duration_milliseconds",
+		Value:  12,
+		Tags:   map[string]string{"region": "us-east", "env": "prod"},
+	}
+
+	tests := []struct {
+		name     string
+		c        []config.RelabelConfig
+		wantDrop bool
+		want     job.Metric
+	}{
+		{name: "no rules", want: in},
+		{
+			name: "rename timing",
+			c: []config.RelabelConfig{{
+				SourceLabels: []string{"__name__"},
+				Regex:        "(.*)_milliseconds",
+				TargetLabel:  "__name__",
+				Replacement:  ptr("${1}_ms"),
+			}},
+			want: job.Metric{Job: "checkout", URL: in.URL, Timing: "dns_duration_ms", Value: 12, Tags: in.Tags},
+		},
+		{
+			name: "replace without a match leaves the target",
+			c: []config.RelabelConfig{{
+				SourceLabels: []string{"__name__"},
+				Regex:        "tls_.*",
+				TargetLabel:  "__name__",
+				Replacement:  ptr("tls"),
+			}},
+			want: in,
+		},
+		{
+			name: "add a tag from the url",
+			c: []config.RelabelConfig{{
+				SourceLabels: []string{"__url__"},
+				Regex:        "https?://([^/]+)/.*",
+				TargetLabel:  "host",
+			}},
+			want: job.Metric{Job: "checkout", URL: in.URL, Timing: in.Timing, Value: 12, Tags: map[string]string{"region": "us-east", "env": "prod", "host": "shop.example.com"}},
+		},
+		{
+			name: "join sources",
+			c: []config.RelabelConfig{{
+				SourceLabels: []string{"env", "region"},
+				Separator:    ptr("/"),
+				TargetLabel:  "site",
+			}},
+			want: job.Metric{Job: "checkout", URL: in.URL, Timing: in.Timing, Value: 12, Tags: map[string]string{"region": "us-east", "env": "prod", "site": "prod/us-east"}},
+		},
+		{
+			name: "empty replacement removes a tag",
+			c:    []config.RelabelConfig{{TargetLabel: "env", Replacement: ptr("")}},
+			want: job.Metric{Job: "checkout", URL: in.URL, Timing: in.Timing, Value: 12, Tags: map[string]string{"region": "us-east"}},
+		},
+		{
+			name:     "keep",
+			c:        []config.RelabelConfig{{Action: "keep", SourceLabels: []string{"__job__"}, Regex: "blog"}},
+			wantDrop: true,
+		},
+		{
+			name:     "drop",
+			c:        []config.RelabelConfig{{Action: "drop", SourceLabels: []string{"__name__"}, Regex: "dns_.*"}},
+			wantDrop: true,
+		},
+		{
+			name:     "removing the timing drops",
+			c:        []config.RelabelConfig{{TargetLabel: "__name__", Replacement: ptr("")}},
+			wantDrop: true,
+		},
+		{
+			name: "labeldrop leaves fields",
+			c:    []config.RelabelConfig{{Action: "labeldrop", Regex: "env|__.*"}},
+			want: job.Metric{Job: "checkout", URL: in.URL, Timing: in.Timing, Value: 12, Tags: map[string]string{"region": "us-east"}},
+		},
+		{
+			name: "labelkeep",
+			c:    []config.RelabelConfig{{Action: "labelkeep", Regex: "env"}},
+			want: job.Metric{Job: "checkout", URL: in.URL, Timing: in.Timing, Value: 12, Tags: map[string]string{"env": "prod"}},
+		},
+		{
+			name: "labelmap",
+			c:    []config.RelabelConfig{{Action: "labelmap", Regex: "__(job|url)__", Replacement: ptr("crabby_$1")}},
+			want: job.Metric{Job: "checkout", URL: in.URL, Timing: in.Timing, Value: 12, Tags: map[string]string{"region": "us-east", "env": "prod", "crabby_job": "checkout", "crabby_url": in.URL}},
+		},
+		{
+			name: "uppercase",
+			c:    []config.RelabelConfig{{Action: "uppercase", SourceLabels: []string{"env"}, TargetLabel: "env"}},
+			want: job.Metric{Job: "checkout", URL: in.URL, Timing: in.Timing, Value: 12, Tags: map[string]string{"region": "us-east", "env": "PROD"}},
+		},
+		{
+			name: "hash the url",
+			c: []config.RelabelConfig{
+				{Action: "hash", SourceLabels: []string{"__url__"}, TargetLabel: "url_hash"},
+				{TargetLabel: "__url__", Replacement: ptr("")},
+			},
+			want: job.Metric{Job: "checkout", Timing: in.Timing, Value: 12, Tags: map[string]string{"region": "us-east", "env": "prod", "url_hash": "aebca4f73e8e9c15"}},
+		},
+		{
+			name: "hashmod",
+			c:    []config.RelabelConfig{{Action: "hashmod", SourceLabels: []string{"__job__"}, TargetLabel: "shard", Modulus: 4}},
+			want: job.Metric{Job: "checkout", URL: in.URL, Timing: in.Timing, Value: 12, Tags: map[string]string{"region": "us-east", "env": "prod", "shard": "3"}},
+		},
+		{
+			name: "temporary labels are discarded",
+			c: []config.RelabelConfig{
+				{SourceLabels: []string{"region"}, Regex: "us-(.*)", TargetLabel: "__tmp_side"},
+				{SourceLabels: []string{"__tmp_side"}, TargetLabel: "side"},
+			},
+			want: job.Metric{Job: "checkout", URL: in.URL, Timing: in.Timing, Value: 12, Tags: map[string]string{"region": "us-east", "env": "prod", "side": "east"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := parseRelabelConfigs(tt.c)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, ok := r.apply(in)
+			if ok == tt.wantDrop {
+				t.Fatalf("kept = %v, want %v", ok, !tt.wantDrop)
+			}
+			if tt.wantDrop {
+				return
+			}
+			if got.Job != tt.want.Job || got.URL != tt.want.URL || got.Timing != tt.want.Timing || got.Value != tt.want.Value || !maps.Equal(got.Tags, tt.want.Tags) {
+				t.Errorf("apply() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+	if len(in.Tags) != 2 {
+		t.Errorf("apply() modified the input's tags: %v", in.Tags)
+	}
+}
+
+func TestDistributor_Relabel(t *testing.T) {
+	renamed := &mockMetricBackend{mockBackend: mockBackend{name: "renamed"}}
+	plain := &mockMetricBackend{mockBackend: mockBackend{name: "plain"}}
+
+	d := NewDistributor()
+	if err := d.SetRelabeling([]config.RelabelConfig{
+		{Action: "drop", SourceLabels: []string{"__job__"}, Regex: "canary"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.AddBackendWithOptions(renamed, BackendOptions{DeliveryConfig: config.DeliveryConfig{Relabel: []config.RelabelConfig{
+		{SourceLabels: []string{"__name__"}, Regex: "(.*)_milliseconds", TargetLabel: "__name__", Replacement: ptr("${1}_ms")},
+	}}}); err != nil {
+		t.Fatal(err)
+	}
+	d.AddBackend(plain)
+	if err := d.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	d.SendMetrics(context.Background(), []job.Metric{
+		{Job: "web", Timing: "dns_duration_milliseconds"},
+		{Job: "canary", Timing: "dns_duration_milliseconds"},
+	})
+	d.Close()
+
+	for _, tt := range []struct {
+		name string
+		got  []job.Metric
+		want string
+	}{
+		{"renamed", renamed.metrics, "dns_duration_ms"},
+		{"plain", plain.metrics, "dns_duration_milliseconds"},
+	} {
+		if len(tt.got) != 1 || tt.got[0].Timing != tt.want {
+			t.Errorf("%s got %+v, want one %s metric", tt.name, tt.got, tt.want)
+		}
+	}
+}
+
+func TestDistributor_SetRelabeling_invalid(t *testing.T) {
+	d := NewDistributor()
+	if err := d.SetRelabeling([]config.RelabelConfig{{Action: "bogus"}}); err == nil {
+		t.Error("SetRelabeling() error = nil, want error")
+	}
+	err := d.AddBackendWithOptions(&mockMetricBackend{mockBackend: mockBackend{name: "m"}}, BackendOptions{DeliveryConfig: config.DeliveryConfig{Relabel: []config.RelabelConfig{{Regex: "("}}}})
+	if err == nil {
+		t.Error("AddBackendWithOptions() error = nil, want error")
+	}
+}
@@ -0,0 +1,165 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/PagerDuty/go-pagerduty"
+	"github.com/chrissnell/crabby/pkg/config"
+	"github.com/chrissnell/crabby/pkg/job"
+	influxhttp "github.com/influxdata/influxdb-client-go/v2/api/http"
+	"google.golang.org/grpc/status"
+)
+
+// Send error classes a retry policy can select, in addition to the
+// job.Failure* connection classes.
+const (
+	// Retry5xx matches any HTTP 5xx status from a backend.
+	Retry5xx = "5xx"
+	// Retry429 matches an HTTP 429 Too Many Requests status.
+	Retry429 = "429"
+)
+
+var defaultRetryOn = []string{job.FailureDNS, job.FailureConnect, job.FailureTimeout, Retry5xx, Retry429}
+
+// StatusError is returned by HTTP-based backends when the server responds
+// with an unsuccessful status.
+type StatusError struct {
+	StatusCode int
+}
+
+func (e *StatusError) Error() string { return "status " + strconv.Itoa(e.StatusCode) }
+
+// retryPolicy is the validated form of a config.RetryConfig.
+type retryPolicy struct {
+	attempts       int
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+	retryOn        []string
+}
+
+// parseRetryConfig validates c and fills in defaults: three attempts, backoff
+// doubling from 500ms up to 30s, and retrying DNS, connection, timeout, 5xx
+// and 429 errors.
+func parseRetryConfig(c config.RetryConfig) (retryPolicy, error) {
+	p := retryPolicy{
+		attempts:       3,
+		initialBackoff: 500 * time.Millisecond,
+		maxBackoff:     30 * time.Second,
+		retryOn:        defaultRetryOn,
+	}
+	if c.Attempts < 0 {
+		return p, fmt.Errorf("retry attempts must not be negative")
+	}
+	if c.Attempts > 0 {
+		p.attempts = c.Attempts
+	}
+	for _, f := range []struct {
+		name string
+		s    string
+		d    *time.Duration
+	}{
+		{"initial-backoff", c.InitialBackoff, &p.initialBackoff},
+		{"max-backoff", c.MaxBackoff, &p.maxBackoff},
+	} {
+		if f.s == "" {
+			continue
+		}
+		d, err := time.ParseDuration(f.s)
+		if err != nil || d < 0 {
+			return p, fmt.Errorf("invalid retry %s %q", f.name, f.s)
+		}
+		*f.d = d
+	}
+	if len(c.RetryOn) > 0 {
+		valid := []string{job.FailureDNS, job.FailureConnect, job.FailureTLS, job.FailureTimeout, Retry5xx, Retry429}
+		for _, class := range c.RetryOn {
+			if !slices.Contains(valid, class) {
+				return p, fmt.Errorf("unknown retry-on class %q (want one of %v)", class, valid)
+			}
+		}
+		p.retryOn = c.RetryOn
+	}
+	return p, nil
+}
+
+// backoff returns the delay before retry number n (starting at 1).
+func (p retryPolicy) backoff(n int) time.Duration {
+	d := p.initialBackoff
+	for i := 1; i < n && d < p.maxBackoff; i++ {
+		d *= 2
+	}
+	return min(d, p.maxBackoff)
+}
+
+// retryable reports whether err falls into one of the policy's classes.
+func (p retryPolicy) retryable(err error) bool {
+	class := classifySendError(err)
+	return class != "" && slices.Contains(p.retryOn, class)
+}
+
+// do calls send until it succeeds, fails with an error the policy doesn't
+// retry, runs out of attempts, or ctx is cancelled. It returns the last
+// error.
+func (p retryPolicy) do(ctx context.Context, send func() error) error {
+	var err error
+	for attempt := 1; ; attempt++ {
+		if err = send(); err == nil || attempt >= p.attempts || !p.retryable(err) {
+			return err
+		}
+		select {
+		case <-time.After(p.backoff(attempt)):
+		case <-ctx.Done():
+			return err
+		}
+	}
+}
+
+// classifySendError returns the retry class of a backend error: Retry5xx or
+// Retry429 for HTTP statuses, a job.Failure* class for connection problems,
+// or "" for anything else, such as other 4xx statuses or encoding errors.
+func classifySendError(err error) string {
+	if code := statusCode(err); code != 0 {
+		switch {
+		case code >= 500:
+			return Retry5xx
+		case code == http.StatusTooManyRequests:
+			return Retry429
+		}
+		return ""
+	}
+	if errors.Is(err, context.Canceled) {
+		return ""
+	}
+	if class := job.ClassifyError(err); class != job.FailureHTTP {
+		return class
+	}
+	return ""
+}
+
+// statusCode extracts the HTTP status from the error types the backends and
+// their client libraries return, or 0 if err doesn't carry one. gRPC
+// statuses are mapped to their HTTP equivalents.
+func statusCode(err error) int {
+	var se *StatusError
+	if errors.As(err, &se) {
+		return se.StatusCode
+	}
+	var pe pagerduty.EventsAPIV2Error
+	if errors.As(err, &pe) {
+		return pe.StatusCode
+	}
+	var ie *influxhttp.Error
+	if errors.As(err, &ie) {
+		return ie.StatusCode
+	}
+	if s, ok := status.FromError(err); ok {
+		return grpcHTTPStatus(s.Code())
+	}
+	return 0
+}
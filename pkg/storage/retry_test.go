@@ -0,0 +1,128 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/PagerDuty/go-pagerduty"
+	"github.com/chrissnell/crabby/pkg/config"
+	"github.com/chrissnell/crabby/pkg/job"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestParseRetryConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		c       config.RetryConfig
+		want    retryPolicy
+		wantErr string
+	}{
+		{
+			name: "defaults",
+			want: retryPolicy{attempts: 3, initialBackoff: 500 * time.Millisecond, maxBackoff: 30 * time.Second, retryOn: defaultRetryOn},
+		},
+		{
+			name: "custom",
+			c:    config.RetryConfig{Attempts: 5, InitialBackoff: "1s", MaxBackoff: "1m", RetryOn: []string{"5xx", "tls"}},
+			want: retryPolicy{attempts: 5, initialBackoff: time.Second, maxBackoff: time.Minute, retryOn: []string{"5xx", "tls"}},
+		},
+		{name: "negative attempts", c: config.RetryConfig{Attempts: -1}, wantErr: "attempts"},
+		{name: "bad backoff", c: config.RetryConfig{InitialBackoff: "soon"}, wantErr: `invalid retry initial-backoff "soon"`},
+		{name: "bad max backoff", c: config.RetryConfig{MaxBackoff: "-1s"}, wantErr: `invalid retry max-backoff "-1s"`},
+		{name: "unknown class", c: config.RetryConfig{RetryOn: []string{"4xx"}}, wantErr: `unknown retry-on class "4xx"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseRetryConfig(tt.c)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("parseRetryConfig() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetryPolicy_backoff(t *testing.T) {
+	p := retryPolicy{initialBackoff: 100 * time.Millisecond, maxBackoff: time.Second}
+	want := []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, 800 * time.Millisecond, time.Second, time.Second}
+	for i, w := range want {
+		if got := p.backoff(i + 1); got != w {
+			t.Errorf("backoff(%d) = %v, want %v", i+1, got, w)
+		}
+	}
+}
+
+func TestClassifySendError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{name: "5xx", err: fmt.Errorf("Splunk HEC returned %w", &StatusError{StatusCode: 503}), want: Retry5xx},
+		{name: "429", err: &StatusError{StatusCode: 429}, want: Retry429},
+		{name: "400", err: &StatusError{StatusCode: 400}, want: ""},
+		{name: "pagerduty 502", err: fmt.Errorf("sending PagerDuty event: %w", pagerduty.EventsAPIV2Error{StatusCode: 502}), want: Retry5xx},
+		{name: "grpc unavailable", err: fmt.Errorf("exporting OTLP metrics: %w", status.Error(codes.Unavailable, "down")), want: Retry5xx},
+		{name: "grpc resource exhausted", err: status.Error(codes.ResourceExhausted, "slow down"), want: Retry429},
+		{name: "grpc invalid argument", err: status.Error(codes.InvalidArgument, "bad"), want: ""},
+		{name: "connection refused", err: &net.OpError{Op: "dial", Err: syscall.ECONNREFUSED}, want: job.FailureConnect},
+		{name: "timeout", err: fmt.Errorf("writing: %w", context.DeadlineExceeded), want: job.FailureTimeout},
+		{name: "canceled", err: context.Canceled, want: ""},
+		{name: "other", err: errors.New("marshaling: bad value"), want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := classifySendError(tt.err); got != tt.want {
+				t.Errorf("classifySendError(%v) = %q, want %q", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetryPolicy_do(t *testing.T) {
+	p := retryPolicy{attempts: 3, initialBackoff: time.Millisecond, maxBackoff: time.Millisecond, retryOn: defaultRetryOn}
+	unavailable := &StatusError{StatusCode: 503}
+
+	tests := []struct {
+		name      string
+		errs      []error
+		wantCalls int
+		wantErr   bool
+	}{
+		{name: "success", errs: []error{nil}, wantCalls: 1},
+		{name: "recovers", errs: []error{unavailable, unavailable, nil}, wantCalls: 3},
+		{name: "gives up", errs: []error{unavailable, unavailable, unavailable, nil}, wantCalls: 3, wantErr: true},
+		{name: "not retryable", errs: []error{&StatusError{StatusCode: 400}, nil}, wantCalls: 1, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			err := p.do(context.Background(), func() error {
+				calls++
+				return tt.errs[calls-1]
+			})
+			if calls != tt.wantCalls {
+				t.Errorf("calls = %d, want %d", calls, tt.wantCalls)
+			}
+			if (err != nil) != tt.wantErr {
+				t.Errorf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,146 @@
+package storage
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+
+	"github.com/chrissnell/crabby/pkg/config"
+)
+
+// Event statuses a route matcher can name instead of a status code pattern.
+const (
+	RouteStatusFailed = "failed"
+	RouteStatusOK     = "ok"
+)
+
+// route is the validated form of a config.RouteConfig.
+type route struct {
+	include  []routeMatcher
+	exclude  []routeMatcher
+	fallback bool
+}
+
+// routeMatcher is the validated form of a config.RouteMatcher. Nil fields
+// match anything.
+type routeMatcher struct {
+	job    *regexp.Regexp
+	timing *regexp.Regexp
+	tags   map[string]*regexp.Regexp
+	// failed, if set, matches events by whether they failed; otherwise
+	// status, if set, matches their status code.
+	failed *bool
+	status *regexp.Regexp
+}
+
+// parseRouteConfig validates c. The zero config accepts everything.
+func parseRouteConfig(c config.RouteConfig) (route, error) {
+	r := route{fallback: c.Default}
+	for i, m := range c.Include {
+		rm, err := parseRouteMatcher(m)
+		if err != nil {
+			return r, fmt.Errorf("route include %d: %w", i, err)
+		}
+		r.include = append(r.include, rm)
+	}
+	for i, m := range c.Exclude {
+		rm, err := parseRouteMatcher(m)
+		if err != nil {
+			return r, fmt.Errorf("route exclude %d: %w", i, err)
+		}
+		r.exclude = append(r.exclude, rm)
+	}
+	return r, nil
+}
+
+func parseRouteMatcher(c config.RouteMatcher) (routeMatcher, error) {
+	var m routeMatcher
+	var err error
+	if m.job, err = compileRouteRegexp("job", c.Job); err != nil {
+		return m, err
+	}
+	if m.timing, err = compileRouteRegexp("timing", c.Timing); err != nil {
+		return m, err
+	}
+	for name, value := range c.Tags {
+		re, err := compileRouteRegexp("tag "+name, value)
+		if err != nil {
+			return m, err
+		}
+		if m.tags == nil {
+			m.tags = make(map[string]*regexp.Regexp)
+		}
+		m.tags[name] = re
+	}
+	switch c.Status {
+	case RouteStatusFailed, RouteStatusOK:
+		failed := c.Status == RouteStatusFailed
+		m.failed = &failed
+	default:
+		if m.status, err = compileRouteRegexp("status", c.Status); err != nil {
+			return m, err
+		}
+	}
+	return m, nil
+}
+
+// compileRouteRegexp compiles pattern anchored at both ends. An empty
+// pattern returns nil, matching anything.
+func compileRouteRegexp(field, pattern string) (*regexp.Regexp, error) {
+	if pattern == "" {
+		return nil, nil
+	}
+	re, err := regexp.Compile("^(?:" + pattern + ")$")
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s pattern %q: %w", field, pattern, err)
+	}
+	return re, nil
+}
+
+// routed reports whether the route has include rules.
+func (r route) routed() bool { return len(r.include) > 0 }
+
+// includes reports whether it passes r's include and exclude rules.
+func (r route) includes(it queueItem) bool {
+	for _, m := range r.exclude {
+		if m.matches(it) {
+			return false
+		}
+	}
+	if len(r.include) == 0 {
+		return true
+	}
+	for _, m := range r.include {
+		if m.matches(it) {
+			return true
+		}
+	}
+	return false
+}
+
+// matches reports whether every set field of m matches it. A timing never
+// matches an event and a status never matches a metric.
+func (m routeMatcher) matches(it queueItem) bool {
+	name, tags := it.metric.Job, it.metric.Tags
+	if it.isEvent {
+		name, tags = it.event.Name, it.event.Tags
+	}
+	if m.job != nil && !m.job.MatchString(name) {
+		return false
+	}
+	for k, re := range m.tags {
+		if !re.MatchString(tags[k]) {
+			return false
+		}
+	}
+	if m.timing != nil && (it.isEvent || !m.timing.MatchString(it.metric.Timing)) {
+		return false
+	}
+	if m.failed != nil && (!it.isEvent || it.event.Failed() != *m.failed) {
+		return false
+	}
+	if m.status != nil && (!it.isEvent || !m.status.MatchString(strconv.Itoa(it.event.ServerStatus))) {
+		return false
+	}
+	return true
+}
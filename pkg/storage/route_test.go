@@ -0,0 +1,163 @@
+package storage
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/chrissnell/crabby/pkg/config"
+	"github.com/chrissnell/crabby/pkg/job"
+)
+
+func TestParseRouteConfig_invalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		c       config.RouteConfig
+		wantErr string
+	}{
+		{name: "bad job", c: config.RouteConfig{Include: []config.RouteMatcher{{Job: "web("}}}, wantErr: `route include 0: invalid job pattern "web("`},
+		{name: "bad tag", c: config.RouteConfig{Exclude: []config.RouteMatcher{{}, {Tags: map[string]string{"tier": "[1"}}}}, wantErr: `route exclude 1: invalid tag tier pattern`},
+		{name: "bad status", c: config.RouteConfig{Include: []config.RouteMatcher{{Status: "down("}}}, wantErr: "invalid status pattern"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseRouteConfig(tt.c)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error = %v, want containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRoute_includes(t *testing.T) {
+	dom := queueItem{metric: job.Metric{Job: "checkout", Timing: "dom_content_loaded_milliseconds", Tags: map[string]string{"tier": "1"}}}
+	dns := queueItem{metric: job.Metric{Job: "blog", Timing: "dns_duration_milliseconds"}}
+	down := queueItem{isEvent: true, event: job.Event{Name: "checkout", ServerStatus: 503, Tags: map[string]string{"tier": "1"}}}
+	up := queueItem{isEvent: true, event: job.Event{Name: "blog", ServerStatus: 200}}
+	items := map[string]queueItem{"dom": dom, "dns": dns, "down": down, "up": up}
+
+	tests := []struct {
+		name string
+		c    config.RouteConfig
+		want []string
+	}{
+		{name: "no rules", want: []string{"dns", "dom", "down", "up"}},
+		{
+			name: "include tag",
+			c:    config.RouteConfig{Include: []config.RouteMatcher{{Tags: map[string]string{"tier": "1"}}}},
+			want: []string{"dom", "down"},
+		},
+		{
+			name: "exclude timing keeps events",
+			c:    config.RouteConfig{Exclude: []config.RouteMatcher{{Timing: "dom_.*"}}},
+			want: []string{"dns", "down", "up"},
+		},
+		{
+			name: "include failed events",
+			c:    config.RouteConfig{Include: []config.RouteMatcher{{Status: "failed"}}},
+			want: []string{"down"},
+		},
+		{
+			name: "status pattern",
+			c:    config.RouteConfig{Include: []config.RouteMatcher{{Status: "2.."}}},
+			want: []string{"up"},
+		},
+		{
+			name: "fields are anded, matchers ored",
+			c: config.RouteConfig{Include: []config.RouteMatcher{
+				{Job: "check.*", Status: "ok"},
+				{Job: "blog", Timing: "dns_.*"},
+			}},
+			want: []string{"dns"},
+		},
+		{
+			name: "job patterns match whole names",
+			c:    config.RouteConfig{Include: []config.RouteMatcher{{Job: "check"}}},
+			want: nil,
+		},
+		{
+			name: "exclude tag",
+			c:    config.RouteConfig{Exclude: []config.RouteMatcher{{Tags: map[string]string{"tier": "1"}}}},
+			want: []string{"dns", "up"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := parseRouteConfig(tt.c)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for name, it := range items {
+				if r.includes(it) {
+					got = append(got, name)
+				}
+			}
+			slices.Sort(got)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("included %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDistributor_Routing(t *testing.T) {
+	payments := &mockEventBackend{mockBackend: mockBackend{name: "pagerduty"}}
+	search := &mockEventBackend{mockBackend: mockBackend{name: "pagerduty"}}
+	fallback := &mockEventBackend{mockBackend: mockBackend{name: "pagerduty"}}
+	// A routed backend of another kind doesn't take items from the default.
+	splunk := &mockFullBackend{mockBackend: mockBackend{name: "splunk_hec"}}
+
+	d := NewDistributor()
+	for _, b := range []struct {
+		b     Backend
+		name  string
+		route config.RouteConfig
+	}{
+		{payments, "pd-payments", config.RouteConfig{Include: []config.RouteMatcher{{Tags: map[string]string{"team": "payments"}}}}},
+		{search, "pd-search", config.RouteConfig{Include: []config.RouteMatcher{{Tags: map[string]string{"team": "search"}}}}},
+		{fallback, "pd-default", config.RouteConfig{Default: true, Exclude: []config.RouteMatcher{{Job: "canary"}}}},
+		{splunk, "splunk", config.RouteConfig{Include: []config.RouteMatcher{{Job: ".*"}}}},
+	} {
+		if err := d.AddBackendWithOptions(b.b, BackendOptions{Name: b.name, DeliveryConfig: config.DeliveryConfig{Route: b.route}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := d.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	d.SendEvents(context.Background(), []job.Event{
+		{Name: "checkout", Tags: map[string]string{"team": "payments"}},
+		{Name: "search-api", Tags: map[string]string{"team": "search"}},
+		{Name: "blog"},
+		{Name: "canary"},
+	})
+	d.SendMetrics(context.Background(), []job.Metric{{Job: "blog"}})
+	d.Close()
+
+	names := func(events []job.Event) []string {
+		var out []string
+		for _, e := range events {
+			out = append(out, e.Name)
+		}
+		return out
+	}
+	for _, tt := range []struct {
+		name string
+		got  []job.Event
+		want []string
+	}{
+		{"pd-payments", payments.events, []string{"checkout"}},
+		{"pd-search", search.events, []string{"search-api"}},
+		{"pd-default", fallback.events, []string{"blog"}},
+		{"splunk", splunk.events, []string{"checkout", "search-api", "blog", "canary"}},
+	} {
+		if got := names(tt.got); !slices.Equal(got, tt.want) {
+			t.Errorf("%s got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+	if len(splunk.metrics) != 1 {
+		t.Errorf("splunk got %d metrics, want 1", len(splunk.metrics))
+	}
+}
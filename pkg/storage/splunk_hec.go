@@ -3,12 +3,9 @@ package storage
 import (
 	"bytes"
 	"context"
-	"crypto/tls"
-	"crypto/x509"
 	"encoding/json"
 	"fmt"
 	"net/http"
-	"os"
 	"time"
 
 	"github.com/chrissnell/crabby/pkg/config"
@@ -30,27 +27,11 @@ func NewSplunkHECBackend(cfg config.SplunkHecConfig, requestTimeout time.Duratio
 		ExpectContinueTimeout: 1 * time.Second,
 	}
 
-	if cfg.CaCert != "" {
-		rootCAs, err := x509.SystemCertPool()
-		if err != nil {
-			return nil, fmt.Errorf("loading system cert pool: %w", err)
-		}
-		if rootCAs == nil {
-			return nil, fmt.Errorf("system certificate pool is nil")
-		}
-		certs, err := os.ReadFile(cfg.CaCert)
-		if err != nil {
-			return nil, fmt.Errorf("reading ca-cert from %s: %w", cfg.CaCert, err)
-		}
-		rootCAs.AppendCertsFromPEM(certs)
-		tr.TLSClientConfig = &tls.Config{
-			RootCAs: rootCAs,
-		}
-	} else {
-		tr.TLSClientConfig = &tls.Config{
-			InsecureSkipVerify: cfg.SkipCertificateValidation,
-		}
+	tlsConfig, err := newTLSConfig(cfg.CaCert, cfg.SkipCertificateValidation)
+	if err != nil {
+		return nil, err
 	}
+	tr.TLSClientConfig = tlsConfig
 
 	if requestTimeout == 0 {
 		requestTimeout = 15 * time.Second
@@ -94,7 +75,22 @@ func (s *SplunkHECBackend) SendEvent(_ context.Context, e job.Event) error {
 	if s.config.EventsIndex != "" {
 		index = s.config.EventsIndex
 	}
-	return s.send(index, sourceType, e.Timestamp, e)
+	return s.send(index, sourceType, e.Timestamp, hecEventData{
+		Event:                e,
+		Severity:             e.Level(),
+		Message:              e.Summary(),
+		DurationMilliseconds: e.Duration.Seconds() * 1000,
+	})
+}
+
+// hecEventData is the body of an event sent to Splunk: the job.Event's
+// fields, with its severity and message always filled in and its duration
+// in milliseconds as well as nanoseconds.
+type hecEventData struct {
+	job.Event
+	Severity             job.Severity
+	Message              string
+	DurationMilliseconds float64
 }
 
 func (s *SplunkHECBackend) send(index, sourceType string, ts time.Time, data interface{}) error {
@@ -128,7 +124,7 @@ func (s *SplunkHECBackend) send(index, sourceType string, ts time.Time, data int
 	defer res.Body.Close()
 
 	if res.StatusCode != 200 {
-		return fmt.Errorf("Splunk HEC returned status %d", res.StatusCode)
+		return fmt.Errorf("Splunk HEC returned %w", &StatusError{StatusCode: res.StatusCode})
 	}
 	return nil
 }
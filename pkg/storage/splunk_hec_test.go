@@ -1,11 +1,16 @@
 package storage
 
 import (
+	"context"
 	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 	"time"
 
 	"github.com/chrissnell/crabby/pkg/config"
+	"github.com/chrissnell/crabby/pkg/job"
 )
 
 func TestHECEvent_JSON(t *testing.T) {
@@ -112,3 +117,41 @@ func TestNewSplunkHECBackend_default_timeout(t *testing.T) {
 		})
 	}
 }
+
+func TestSplunkHECBackend_SendEvent(t *testing.T) {
+	var body []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = io.ReadAll(r.Body)
+	}))
+	defer srv.Close()
+
+	b, err := NewSplunkHECBackend(config.SplunkHecConfig{HecURL: srv.URL}, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = b.SendEvent(context.Background(), job.Event{
+		Name:         "web",
+		ServerStatus: 404,
+		URL:          "https://example.com",
+		Duration:     250 * time.Millisecond,
+		Timestamp:    time.Unix(1700000000, 0),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got struct {
+		Event map[string]any `json:"event"`
+	}
+	if err := json.Unmarshal(body, &got); err != nil {
+		t.Fatal(err)
+	}
+	ev := got.Event
+	if ev["Name"] != "web" || ev["ServerStatus"] != float64(404) || ev["URL"] != "https://example.com" {
+		t.Errorf("event = %v", ev)
+	}
+	// Severity and Message are derived when the event doesn't set them.
+	if ev["Severity"] != "error" || ev["Message"] != "web returned status 404" || ev["DurationMilliseconds"] != float64(250) {
+		t.Errorf("event = %v", ev)
+	}
+}
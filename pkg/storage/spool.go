@@ -0,0 +1,267 @@
+package storage
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/chrissnell/crabby/pkg/config"
+	"github.com/chrissnell/crabby/pkg/job"
+)
+
+const (
+	defaultSpoolMaxItems       = 100000
+	defaultSpoolReplayInterval = 30 * time.Second
+	// spoolCompactEvery is how many replayed items may accumulate at the
+	// head of the spool file before it is rewritten.
+	spoolCompactEvery = 100
+)
+
+var errSpoolFull = errors.New("spool is full")
+
+// spoolOptions is the validated form of a config.SpoolConfig.
+type spoolOptions struct {
+	dir            string
+	maxItems       int
+	replayInterval time.Duration
+}
+
+// parseSpoolConfig validates c and fills in defaults: at most 100000 items,
+// replayed every 30s. A zero spoolOptions.dir means spooling is disabled.
+func parseSpoolConfig(c config.SpoolConfig) (spoolOptions, error) {
+	o := spoolOptions{
+		dir:            c.Dir,
+		maxItems:       defaultSpoolMaxItems,
+		replayInterval: defaultSpoolReplayInterval,
+	}
+	if c.MaxItems < 0 {
+		return o, fmt.Errorf("spool max-items must not be negative")
+	}
+	if c.MaxItems > 0 {
+		o.maxItems = c.MaxItems
+	}
+	if c.ReplayInterval != "" {
+		d, err := time.ParseDuration(c.ReplayInterval)
+		if err != nil || d <= 0 {
+			return o, fmt.Errorf("invalid spool replay-interval %q", c.ReplayInterval)
+		}
+		o.replayInterval = d
+	}
+	return o, nil
+}
+
+// spoolRecord is the on-disk form of a queueItem, one JSON object per line.
+type spoolRecord struct {
+	Metric *job.Metric `json:"metric,omitempty"`
+	Event  *job.Event  `json:"event,omitempty"`
+}
+
+// spool is a disk-backed FIFO of items a backend couldn't accept. Items are
+// appended to a JSON-lines file as they arrive and kept in memory for replay;
+// the file is rewritten periodically to drop replayed items.
+type spool struct {
+	path     string
+	maxItems int
+
+	mu       sync.Mutex
+	f        *os.File
+	items    []queueItem
+	replayed int // items removed from the head since the last rewrite
+}
+
+// openSpool opens (or creates) the spool for backend in dir, loading any
+// items left over from a previous run.
+func openSpool(dir, backend string, maxItems int) (*spool, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("creating spool directory: %w", err)
+	}
+	s := &spool{
+		path:     filepath.Join(dir, backend+".spool.jsonl"),
+		maxItems: maxItems,
+	}
+	damaged, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(s.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("opening spool: %w", err)
+	}
+	s.f = f
+	if damaged {
+		// Rewrite the file so new entries don't get appended to a partial line.
+		if err := s.rewrite(); err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+	if len(s.items) > 0 {
+		slog.Info("loaded spooled items", "backend", backend, "items", len(s.items))
+	}
+	return s, nil
+}
+
+// load reads the items in the spool file, reporting whether any entries
+// were unreadable.
+func (s *spool) load() (damaged bool, err error) {
+	f, err := os.Open(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("opening spool: %w", err)
+	}
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+	sc.Buffer(nil, 1<<20)
+	for line := 1; sc.Scan(); line++ {
+		var rec spoolRecord
+		if err := json.Unmarshal(sc.Bytes(), &rec); err != nil {
+			// Most likely a line cut short by a crash; skip it.
+			slog.Warn("skipping unreadable spool entry", "file", s.path, "line", line, "error", err)
+			damaged = true
+			continue
+		}
+		switch {
+		case rec.Event != nil:
+			s.items = append(s.items, queueItem{event: *rec.Event, isEvent: true})
+		case rec.Metric != nil:
+			s.items = append(s.items, queueItem{metric: *rec.Metric})
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return false, fmt.Errorf("reading spool: %w", err)
+	}
+	return damaged, nil
+}
+
+func marshalSpoolRecord(it queueItem) ([]byte, error) {
+	rec := spoolRecord{Metric: &it.metric}
+	if it.isEvent {
+		rec = spoolRecord{Event: &it.event}
+	}
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return nil, err
+	}
+	return append(b, '\n'), nil
+}
+
+// len returns the number of items waiting in the spool.
+func (s *spool) len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.items)
+}
+
+// append adds it to the tail of the spool.
+func (s *spool) append(it queueItem) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.items) >= s.maxItems {
+		return errSpoolFull
+	}
+	b, err := marshalSpoolRecord(it)
+	if err != nil {
+		return fmt.Errorf("encoding spool entry: %w", err)
+	}
+	if _, err := s.f.Write(b); err != nil {
+		return fmt.Errorf("writing spool: %w", err)
+	}
+	s.items = append(s.items, it)
+	return nil
+}
+
+// replay sends spooled items oldest first until the spool is empty or send
+// fails. It returns the number of items delivered and the error that stopped
+// the replay, if any.
+func (s *spool) replay(send func(queueItem) error) (int, error) {
+	var sent int
+	for {
+		s.mu.Lock()
+		if len(s.items) == 0 {
+			s.mu.Unlock()
+			return sent, nil
+		}
+		head := s.items[0]
+		s.mu.Unlock()
+
+		if err := send(head); err != nil {
+			return sent, err
+		}
+		sent++
+
+		s.mu.Lock()
+		s.items = s.items[1:]
+		s.replayed++
+		var err error
+		if len(s.items) == 0 || s.replayed >= spoolCompactEvery {
+			err = s.rewrite()
+		}
+		s.mu.Unlock()
+		if err != nil {
+			return sent, err
+		}
+	}
+}
+
+// rewrite replaces the spool file with the items still pending. s.mu must
+// be held.
+func (s *spool) rewrite() error {
+	tmp := s.path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return fmt.Errorf("rewriting spool: %w", err)
+	}
+	w := bufio.NewWriter(f)
+	for _, it := range s.items {
+		b, err := marshalSpoolRecord(it)
+		if err != nil {
+			f.Close()
+			return fmt.Errorf("encoding spool entry: %w", err)
+		}
+		w.Write(b)
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return fmt.Errorf("rewriting spool: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("rewriting spool: %w", err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return fmt.Errorf("rewriting spool: %w", err)
+	}
+
+	s.f.Close()
+	s.f, err = os.OpenFile(s.path, os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return fmt.Errorf("reopening spool: %w", err)
+	}
+	s.replayed = 0
+	return nil
+}
+
+// close drops replayed items from the spool file, then syncs and closes it.
+// Items replayed since the last rewrite are sent again after a crash.
+func (s *spool) close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.replayed > 0 {
+		if err := s.rewrite(); err != nil {
+			return err
+		}
+	}
+	if err := s.f.Sync(); err != nil {
+		s.f.Close()
+		return err
+	}
+	return s.f.Close()
+}
@@ -0,0 +1,105 @@
+package storage
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/chrissnell/crabby/pkg/job"
+)
+
+func TestSpool_AppendReplayReopen(t *testing.T) {
+	dir := t.TempDir()
+	s, err := openSpool(dir, "influxdb", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, it := range []queueItem{
+		{metric: job.Metric{Job: "a", Timing: "dns", Value: 1, Tags: map[string]string{"env": "prod"}}},
+		{event: job.Event{Name: "a", ServerStatus: 503, Reason: "http: 503"}, isEvent: true},
+		{metric: job.Metric{Job: "b", Timing: "dns", Value: 2}},
+	} {
+		if err := s.append(it); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Deliver one item, then fail.
+	var got []queueItem
+	n, err := s.replay(func(it queueItem) error {
+		if len(got) == 1 {
+			return errors.New("unavailable")
+		}
+		got = append(got, it)
+		return nil
+	})
+	if n != 1 || err == nil {
+		t.Fatalf("replay() = %d, %v; want 1 and an error", n, err)
+	}
+	if err := s.close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// A cut-off line from a crash is skipped.
+	f, err := os.OpenFile(filepath.Join(dir, "influxdb.spool.jsonl"), os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"metric":{"Job":"c"`)
+	f.Close()
+
+	s, err = openSpool(dir, "influxdb", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.close()
+	if s.len() != 2 {
+		t.Fatalf("reopened spool has %d items, want 2", s.len())
+	}
+	if err := s.append(queueItem{metric: job.Metric{Job: "d"}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.replay(func(it queueItem) error {
+		got = append(got, it)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for _, it := range got {
+		if it.isEvent {
+			names = append(names, "event:"+it.event.Name+":"+it.event.Reason)
+		} else {
+			names = append(names, "metric:"+it.metric.Job)
+		}
+	}
+	if want := "metric:a,event:a:http: 503,metric:b,metric:d"; strings.Join(names, ",") != want {
+		t.Errorf("replayed %v, want %s", names, want)
+	}
+	if got[0].metric.Tags["env"] != "prod" {
+		t.Errorf("tags lost in spool: %+v", got[0].metric)
+	}
+	if s.len() != 0 {
+		t.Errorf("spool has %d items after replay, want 0", s.len())
+	}
+	if b, _ := os.ReadFile(filepath.Join(dir, "influxdb.spool.jsonl")); len(b) != 0 {
+		t.Errorf("spool file not emptied: %q", b)
+	}
+}
+
+func TestSpool_Full(t *testing.T) {
+	s, err := openSpool(t.TempDir(), "log", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.close()
+	if err := s.append(queueItem{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.append(queueItem{}); !errors.Is(err, errSpoolFull) {
+		t.Errorf("append() error = %v, want errSpoolFull", err)
+	}
+}
@@ -3,8 +3,9 @@ package storage
 import (
 	"context"
 	"fmt"
-	"log/slog"
+	"sync"
 
+	"github.com/chrissnell/crabby/pkg/config"
 	"github.com/chrissnell/crabby/pkg/job"
 )
 
@@ -18,6 +19,23 @@ type EventSender interface {
 	SendEvent(ctx context.Context, e job.Event) error
 }
 
+// BatchSender is implemented by backends that can deliver several metrics
+// and events in one request. Their queue workers pass along up to BatchSize
+// items that are already waiting instead of sending one at a time. Each call
+// holds only metrics or only events.
+type BatchSender interface {
+	BatchSize() int
+	SendBatch(ctx context.Context, metrics []job.Metric, events []job.Event) error
+}
+
+// EventAdmitter is implemented by event backends that decide once per event
+// whether to send it at all, for example to apply a rate limit. The queue
+// asks before an event's first attempt; retries and replays of an admitted
+// event aren't counted again.
+type EventAdmitter interface {
+	AdmitEvent(e job.Event) bool
+}
+
 // Backend is the lifecycle interface for storage backends.
 type Backend interface {
 	Name() string
@@ -25,33 +43,138 @@ type Backend interface {
 	Close() error
 }
 
-// Distributor fans out metrics and events to registered backends.
+// Distributor fans out metrics and events to registered backends. Each
+// backend that accepts metrics or events gets its own bounded queue and
+// workers, so a slow backend never delays the jobs or the other backends.
 type Distributor struct {
-	backends []Backend
+	backends  []namedBackend
+	queues    []*backendQueue
+	factories map[string]BackendFactory
+	// relabel is applied to every metric before it's dispatched.
+	relabel relabeler
+
+	mu     sync.RWMutex
+	closed bool
+}
+
+// namedBackend is a registered backend and the name of its instance.
+type namedBackend struct {
+	Backend
+	name string
+}
+
+// BackendOptions holds a backend instance's name and delivery settings.
+// They can be decoded from a backend's YAML configuration.
+type BackendOptions struct {
+	// Name identifies the backend instance in logs, spool files and
+	// internal metrics. It defaults to the backend's Name, and must be
+	// unique.
+	Name                  string `yaml:"name,omitempty"`
+	config.DeliveryConfig `yaml:",inline"`
 }
 
 // NewDistributor creates a new Distributor.
 func NewDistributor() *Distributor {
-	return &Distributor{}
+	return &Distributor{factories: make(map[string]BackendFactory)}
 }
 
-// AddBackend registers a backend with the distributor.
+// AddBackend registers a backend with the distributor using the default
+// delivery settings.
 func (d *Distributor) AddBackend(b Backend) {
-	d.backends = append(d.backends, b)
+	// The zero options are always valid.
+	_ = d.AddBackendWithOptions(b, BackendOptions{})
+}
+
+// AddBackendWithOptions registers a backend with the given delivery settings.
+func (d *Distributor) AddBackendWithOptions(b Backend, opts BackendOptions) error {
+	name := opts.Name
+	if name == "" {
+		name = b.Name()
+	}
+	for _, nb := range d.backends {
+		if nb.name == name {
+			return fmt.Errorf("duplicate backend name %q", name)
+		}
+	}
+	qo, err := parseQueueConfig(opts.Queue)
+	if err != nil {
+		return err
+	}
+	rp, err := parseRetryConfig(opts.Retry)
+	if err != nil {
+		return err
+	}
+	so, err := parseSpoolConfig(opts.Spool)
+	if err != nil {
+		return err
+	}
+	ro, err := parseRouteConfig(opts.Route)
+	if err != nil {
+		return err
+	}
+	rl, err := parseRelabelConfigs(opts.Relabel)
+	if err != nil {
+		return err
+	}
+	d.backends = append(d.backends, namedBackend{Backend: b, name: name})
+	_, isMetric := b.(MetricSender)
+	_, isEvent := b.(EventSender)
+	if isMetric || isEvent {
+		q := newBackendQueue(name, b, qo, rp, so, ro)
+		q.relabel = rl
+		d.queues = append(d.queues, q)
+	}
+	return nil
+}
+
+// SetRelabeling sets the relabel rules applied to every metric before it's
+// dispatched to the backends, replacing any set before.
+func (d *Distributor) SetRelabeling(cs []config.RelabelConfig) error {
+	r, err := parseRelabelConfigs(cs)
+	if err != nil {
+		return err
+	}
+	d.relabel = r
+	return nil
 }
 
-// Start starts all registered backends.
+// Start starts all registered backends, opens their spools and starts their
+// queue workers.
 func (d *Distributor) Start(ctx context.Context) error {
 	for _, b := range d.backends {
 		if err := b.Start(ctx); err != nil {
-			return fmt.Errorf("starting backend %s: %w", b.Name(), err)
+			return fmt.Errorf("starting backend %s: %w", b.name, err)
+		}
+	}
+	for _, q := range d.queues {
+		if err := q.start(ctx); err != nil {
+			return fmt.Errorf("starting queue for backend %s: %w", q.name, err)
 		}
 	}
 	return nil
 }
 
-// Close shuts down all backends.
+// Close stops accepting new items, flushes each backend's queue (bounded by
+// its flush timeout) and then shuts down all backends.
 func (d *Distributor) Close() error {
+	d.mu.Lock()
+	if d.closed {
+		d.mu.Unlock()
+		return nil
+	}
+	d.closed = true
+	d.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, q := range d.queues {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			q.close()
+		}()
+	}
+	wg.Wait()
+
 	var firstErr error
 	for _, b := range d.backends {
 		if err := b.Close(); err != nil && firstErr == nil {
@@ -61,32 +184,67 @@ func (d *Distributor) Close() error {
 	return firstErr
 }
 
-// SendMetrics fans out metrics to all backends implementing MetricSender.
+// SendMetrics relabels metrics and queues them for the backends
+// implementing MetricSender whose routes accept them.
 func (d *Distributor) SendMetrics(ctx context.Context, metrics []job.Metric) {
-	for _, b := range d.backends {
-		ms, ok := b.(MetricSender)
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	if d.closed {
+		return
+	}
+	for _, m := range metrics {
+		m, ok := d.relabel.apply(m)
 		if !ok {
 			continue
 		}
-		for _, m := range metrics {
-			if err := ms.SendMetric(ctx, m); err != nil {
-				slog.Error("sending metric", "backend", b.Name(), "error", err)
-			}
-		}
+		d.dispatch(ctx, queueItem{metric: m})
 	}
 }
 
-// SendEvents fans out events to all backends implementing EventSender.
+// SendEvents queues events for the backends implementing EventSender whose
+// routes accept them.
 func (d *Distributor) SendEvents(ctx context.Context, events []job.Event) {
-	for _, b := range d.backends {
-		es, ok := b.(EventSender)
-		if !ok {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	if d.closed {
+		return
+	}
+	for _, e := range events {
+		d.dispatch(ctx, queueItem{event: e, isEvent: true})
+	}
+}
+
+// dispatch queues it for each backend that accepts its kind and whose route
+// includes it, after applying the backend's relabel rules to metrics. A
+// backend with a default route gets it only if no other backend of the same
+// kind (by Backend.Name) included it by an include rule.
+func (d *Distributor) dispatch(ctx context.Context, it queueItem) {
+	var claimed map[string]bool
+	for _, q := range d.queues {
+		if q.route.fallback || !q.accepts(it) || !q.route.includes(it) {
 			continue
 		}
-		for _, e := range events {
-			if err := es.SendEvent(ctx, e); err != nil {
-				slog.Error("sending event", "backend", b.Name(), "error", err)
+		q.relabelAndEnqueue(ctx, it)
+		if q.route.routed() {
+			if claimed == nil {
+				claimed = make(map[string]bool)
 			}
+			claimed[q.backend.Name()] = true
 		}
 	}
+	for _, q := range d.queues {
+		if q.route.fallback && !claimed[q.backend.Name()] && q.accepts(it) && q.route.includes(it) {
+			q.relabelAndEnqueue(ctx, it)
+		}
+	}
+}
+
+// InternalMetrics reports each backend's queue depth, dropped items and mean
+// send latency.
+func (d *Distributor) InternalMetrics() []job.Metric {
+	var metrics []job.Metric
+	for _, q := range d.queues {
+		metrics = append(metrics, q.internalMetrics()...)
+	}
+	return metrics
 }
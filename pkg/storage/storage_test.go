@@ -202,7 +202,11 @@ func TestDistributor_SendMetrics(t *testing.T) {
 		{Job: "j1", Timing: "dns", Value: 1.0},
 		{Job: "j2", Timing: "connect", Value: 2.0},
 	}
+	if err := d.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
 	d.SendMetrics(context.Background(), metrics)
+	d.Close() // flushes the queues
 
 	if len(metricOnly.metrics) != 2 {
 		t.Errorf("metricOnly got %d metrics, want 2", len(metricOnly.metrics))
@@ -231,7 +235,11 @@ func TestDistributor_SendEvents(t *testing.T) {
 		{Name: "e1", ServerStatus: 200},
 		{Name: "e2", ServerStatus: 500},
 	}
+	if err := d.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
 	d.SendEvents(context.Background(), events)
+	d.Close() // flushes the queues
 
 	if len(eventOnly.events) != 2 {
 		t.Errorf("eventOnly got %d events, want 2", len(eventOnly.events))
@@ -0,0 +1,202 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/chrissnell/crabby/pkg/config"
+	"github.com/chrissnell/crabby/pkg/job"
+)
+
+// WebhookBackend sends events to an arbitrary HTTP endpoint, such as a Slack
+// or Teams incoming webhook, with a body rendered from a Go template.
+type WebhookBackend struct {
+	config   config.WebhookConfig
+	client   *http.Client
+	body     *template.Template
+	interval time.Duration
+	// now is the clock used for rate limiting; tests replace it.
+	now func() time.Time
+
+	mu sync.Mutex
+	// sent holds the start times of the requests in the current rate limit
+	// window.
+	sent []time.Time
+	// failing holds the last delivered state of each job.
+	failing map[string]bool
+}
+
+// webhookFuncs are the functions available to body templates.
+var webhookFuncs = template.FuncMap{
+	"json": func(v any) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+}
+
+// NewWebhookBackend creates a new webhook backend.
+func NewWebhookBackend(cfg config.WebhookConfig, requestTimeout time.Duration) (*WebhookBackend, error) {
+	if cfg.URL == "" {
+		return nil, errors.New("missing webhook url")
+	}
+	if cfg.Method == "" {
+		cfg.Method = http.MethodPost
+	}
+	cfg.Method = strings.ToUpper(cfg.Method)
+	if cfg.RateLimit < 0 {
+		return nil, errors.New("rate-limit must not be negative")
+	}
+	interval := time.Minute
+	if cfg.RateLimitInterval != "" {
+		d, err := time.ParseDuration(cfg.RateLimitInterval)
+		if err != nil {
+			return nil, fmt.Errorf("parsing rate-limit-interval: %w", err)
+		}
+		if d <= 0 {
+			return nil, errors.New("rate-limit-interval must be positive")
+		}
+		interval = d
+	}
+
+	var body *template.Template
+	if cfg.Body != "" {
+		t, err := template.New("webhook").Funcs(webhookFuncs).Option("missingkey=error").Parse(cfg.Body)
+		if err != nil {
+			return nil, fmt.Errorf("parsing webhook body template: %w", err)
+		}
+		body = t
+	}
+
+	client, err := newHTTPClient(cfg.CaCert, cfg.SkipCertificateValidation, requestTimeout)
+	if err != nil {
+		return nil, err
+	}
+	return &WebhookBackend{
+		config:   cfg,
+		client:   client,
+		body:     body,
+		interval: interval,
+		now:      time.Now,
+		failing:  make(map[string]bool),
+	}, nil
+}
+
+func (w *WebhookBackend) Name() string                  { return "webhook" }
+func (w *WebhookBackend) Start(_ context.Context) error { return nil }
+func (w *WebhookBackend) Close() error                  { return nil }
+
+// AdmitEvent reports whether e should be delivered. With
+// state-changes-only, events that don't change their job's state are turned
+// away; jobs start out healthy. Events over the rate limit are turned away
+// too. It implements EventAdmitter, so each event counts against the rate
+// limit once, however often it is retried.
+func (w *WebhookBackend) AdmitEvent(e job.Event) bool {
+	if w.config.StateChangesOnly && !w.stateChanged(e) {
+		return false
+	}
+	if !w.allow() {
+		slog.Warn("webhook rate limit reached, dropping event", "job", e.Name)
+		return false
+	}
+	return true
+}
+
+// SendEvent delivers e to the webhook. With state-changes-only, events that
+// don't change their job's state are skipped. The rate limit is applied by
+// AdmitEvent.
+func (w *WebhookBackend) SendEvent(ctx context.Context, e job.Event) error {
+	if w.config.StateChangesOnly && !w.stateChanged(e) {
+		return nil
+	}
+	body, err := w.render(e)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, w.config.Method, w.config.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "crabby")
+	for k, v := range w.config.Headers {
+		req.Header.Set(k, v)
+	}
+	res, err := w.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("webhook request failed: %w", err)
+	}
+	defer res.Body.Close()
+	if err := checkResponse("webhook", res); err != nil {
+		return err
+	}
+
+	if w.config.StateChangesOnly {
+		w.mu.Lock()
+		w.failing[e.Name] = e.Failed()
+		w.mu.Unlock()
+	}
+	return nil
+}
+
+// render returns the request body for e: the body template executed with
+// e as its data or, without a template, e as a JSON object.
+func (w *WebhookBackend) render(e job.Event) ([]byte, error) {
+	if w.body == nil {
+		return json.Marshal(struct {
+			Name       string            `json:"name"`
+			Status     int               `json:"status"`
+			Failed     bool              `json:"failed"`
+			Severity   job.Severity      `json:"severity"`
+			Reason     string            `json:"reason,omitempty"`
+			URL        string            `json:"url,omitempty"`
+			DurationMs float64           `json:"duration_ms,omitempty"`
+			Message    string            `json:"message"`
+			Timestamp  time.Time         `json:"timestamp"`
+			Tags       map[string]string `json:"tags,omitempty"`
+		}{e.Name, e.ServerStatus, e.Failed(), e.Level(), e.Reason, e.URL, e.Duration.Seconds() * 1000, e.Summary(), e.Timestamp, e.Tags})
+	}
+	var b bytes.Buffer
+	if err := w.body.Execute(&b, e); err != nil {
+		return nil, fmt.Errorf("rendering webhook body: %w", err)
+	}
+	return b.Bytes(), nil
+}
+
+// stateChanged reports whether e's state differs from the last one
+// delivered for its job.
+func (w *WebhookBackend) stateChanged(e job.Event) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.failing[e.Name] != e.Failed()
+}
+
+// allow reports whether another request fits in the rate limit, and if so
+// counts it.
+func (w *WebhookBackend) allow() bool {
+	if w.config.RateLimit == 0 {
+		return true
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	now := w.now()
+	i := 0
+	for i < len(w.sent) && now.Sub(w.sent[i]) >= w.interval {
+		i++
+	}
+	w.sent = w.sent[i:]
+	if len(w.sent) >= w.config.RateLimit {
+		return false
+	}
+	w.sent = append(w.sent, now)
+	return true
+}
@@ -0,0 +1,200 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/chrissnell/crabby/pkg/config"
+	"github.com/chrissnell/crabby/pkg/job"
+)
+
+// webhookRecorder is a test webhook endpoint that records request bodies.
+type webhookRecorder struct {
+	mu       sync.Mutex
+	bodies   []string
+	requests []*http.Request
+}
+
+func (rec *webhookRecorder) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	body, _ := io.ReadAll(r.Body)
+	rec.bodies = append(rec.bodies, string(body))
+	rec.requests = append(rec.requests, r)
+}
+
+func startWebhook(t *testing.T, cfg config.WebhookConfig) (*WebhookBackend, *webhookRecorder) {
+	t.Helper()
+	rec := &webhookRecorder{}
+	srv := httptest.NewServer(rec)
+	t.Cleanup(srv.Close)
+	cfg.URL = srv.URL
+	w, err := NewWebhookBackend(cfg, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return w, rec
+}
+
+func TestWebhookBackend_defaultBody(t *testing.T) {
+	w, rec := startWebhook(t, config.WebhookConfig{Headers: map[string]string{"X-Token": "secret"}})
+	e := job.Event{Name: "web", Reason: "connect: connection refused", Timestamp: time.Unix(1700000000, 0).UTC(), Tags: map[string]string{"team": "payments"}}
+	if err := w.SendEvent(context.Background(), e); err != nil {
+		t.Fatalf("SendEvent() error = %v", err)
+	}
+
+	var got map[string]any
+	if err := json.Unmarshal([]byte(rec.bodies[0]), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got["name"] != "web" || got["failed"] != true || got["reason"] != "connect: connection refused" || got["timestamp"] != "2023-11-14T22:13:20Z" {
+		t.Errorf("body = %s", rec.bodies[0])
+	}
+	if got["severity"] != "critical" || got["message"] != "web failed: connect: connection refused" {
+		t.Errorf("body = %s, want critical severity and a message", rec.bodies[0])
+	}
+	r := rec.requests[0]
+	if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" || r.Header.Get("X-Token") != "secret" {
+		t.Errorf("request = %s %v", r.Method, r.Header)
+	}
+}
+
+func TestWebhookBackend_template(t *testing.T) {
+	w, rec := startWebhook(t, config.WebhookConfig{
+		Method: "put",
+		Body:   `{"text": {{ printf "%s is %s" .Name (or .Reason "up") | json }}, "failed": {{ .Failed }}}`,
+	})
+	for _, e := range []job.Event{
+		{Name: "web", ServerStatus: 200},
+		{Name: "api", Reason: `read "body": EOF`},
+	} {
+		if err := w.SendEvent(context.Background(), e); err != nil {
+			t.Fatalf("SendEvent() error = %v", err)
+		}
+	}
+	want := []string{
+		`{"text": "web is up", "failed": false}`,
+		`{"text": "api is read \"body\": EOF", "failed": true}`,
+	}
+	for i := range want {
+		if rec.bodies[i] != want[i] {
+			t.Errorf("body %d = %s, want %s", i, rec.bodies[i], want[i])
+		}
+	}
+	if rec.requests[0].Method != http.MethodPut {
+		t.Errorf("method = %s, want PUT", rec.requests[0].Method)
+	}
+}
+
+func TestWebhookBackend_stateChangesOnly(t *testing.T) {
+	w, rec := startWebhook(t, config.WebhookConfig{StateChangesOnly: true})
+	for _, e := range []job.Event{
+		{Name: "web", ServerStatus: 200}, // healthy to begin with: skipped
+		{Name: "web", ServerStatus: 503},
+		{Name: "web", ServerStatus: 500}, // still failing: skipped
+		{Name: "api", ServerStatus: 200}, // other job, healthy: skipped
+		{Name: "web", ServerStatus: 200},
+	} {
+		if err := w.SendEvent(context.Background(), e); err != nil {
+			t.Fatalf("SendEvent() error = %v", err)
+		}
+	}
+	if len(rec.bodies) != 2 || !strings.Contains(rec.bodies[0], `"status":503`) || !strings.Contains(rec.bodies[1], `"status":200`) {
+		t.Errorf("delivered %q, want the 503 and the recovery", rec.bodies)
+	}
+}
+
+func TestWebhookBackend_rateLimit(t *testing.T) {
+	w, rec := startWebhook(t, config.WebhookConfig{RateLimit: 2, RateLimitInterval: "10s"})
+	now := time.Unix(1700000000, 0)
+	w.now = func() time.Time { return now }
+
+	send := func() {
+		t.Helper()
+		e := job.Event{Name: "web", ServerStatus: 503}
+		if !w.AdmitEvent(e) {
+			return
+		}
+		if err := w.SendEvent(context.Background(), e); err != nil {
+			t.Fatalf("SendEvent() error = %v", err)
+		}
+	}
+	send()
+	send()
+	send() // over the limit: dropped
+	if len(rec.bodies) != 2 {
+		t.Fatalf("delivered %d events, want 2", len(rec.bodies))
+	}
+	now = now.Add(10 * time.Second)
+	send()
+	if len(rec.bodies) != 3 {
+		t.Errorf("delivered %d events after the interval, want 3", len(rec.bodies))
+	}
+}
+
+func TestWebhookBackend_rateLimitRetries(t *testing.T) {
+	// The endpoint fails the first two requests; the retries of the first
+	// event mustn't use up the rate limit.
+	var mu sync.Mutex
+	var bodies []string
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		body, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+		if len(bodies) <= 2 {
+			rw.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+
+	w, err := NewWebhookBackend(config.WebhookConfig{URL: srv.URL, RateLimit: 2, Body: "{{ .Name }}"}, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := NewDistributor()
+	if err := d.AddBackendWithOptions(w, BackendOptions{DeliveryConfig: config.DeliveryConfig{
+		Retry: config.RetryConfig{Attempts: 3, InitialBackoff: "1ms"},
+	}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	d.SendEvents(context.Background(), []job.Event{{Name: "web", ServerStatus: 503}})
+	d.SendEvents(context.Background(), []job.Event{{Name: "api", ServerStatus: 503}})
+	d.Close()
+
+	if got, want := strings.Join(bodies, ","), "web,web,web,api"; got != want {
+		t.Errorf("requests = %s, want %s", got, want)
+	}
+}
+
+func TestNewWebhookBackend_invalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     config.WebhookConfig
+		wantErr string
+	}{
+		{name: "no url", wantErr: "missing webhook url"},
+		{name: "bad template", cfg: config.WebhookConfig{URL: "http://x", Body: "{{ .Name "}, wantErr: "parsing webhook body template"},
+		{name: "bad interval", cfg: config.WebhookConfig{URL: "http://x", RateLimitInterval: "often"}, wantErr: "rate-limit-interval"},
+		{name: "negative rate limit", cfg: config.WebhookConfig{URL: "http://x", RateLimit: -1}, wantErr: "rate-limit"},
+		{name: "missing CA", cfg: config.WebhookConfig{URL: "http://x", CaCert: "/nonexistent/ca.pem"}, wantErr: "reading ca-cert"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewWebhookBackend(tt.cfg, 0)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error = %v, want containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}